@@ -0,0 +1,473 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/api"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/internal/services"
+	"github.com/mlorentedev/mlorente-backend/internal/validation"
+	"github.com/mlorentedev/mlorente-backend/pkg/config"
+)
+
+// healthTimeout es el tiempo máximo de espera de la consulta de estado
+const healthTimeout = 10 * time.Second
+
+// fieldErrors convierte errores de validación en un único error
+func fieldErrors(errs []models.FieldError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Field+": "+err.Message)
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
+
+// parseFlags analiza las opciones de un comando, sin argumentos posicionales
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	flags.SetOutput(io.Discard)
+	if err := flags.Parse(args); err != nil || flags.NArg() > 0 {
+		return errUsage
+	}
+	return nil
+}
+
+// lookupSubscriber valida un email y busca su suscriptor
+func lookupSubscriber(email string) (*models.Subscriber, error) {
+	if err := fieldErrors(validation.ValidateEmail("email", &email)); err != nil {
+		return nil, err
+	}
+
+	subscriberCheck, err := services.CheckSubscriber(email)
+	if err != nil {
+		return nil, err
+	}
+	if !subscriberCheck.Success || subscriberCheck.Subscriber == nil {
+		return nil, services.ErrNotSubscribed
+	}
+	return subscriberCheck.Subscriber, nil
+}
+
+// runConfigCheck carga y valida la configuración e informa de las funciones desactivadas
+func runConfigCheck(args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+
+	conf, err := config.GetConfig()
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	warnings := []string{}
+	if !services.ValidateEmailConfiguration() {
+		warnings = append(warnings, "email configuration is incomplete, emails cannot be sent")
+	}
+	if conf.Security.LinkSecret == "" {
+		warnings = append(warnings, "LINK_SIGNING_SECRET is not set, signed links are disabled")
+	}
+	if len(conf.Admin.APIKeys) == 0 && conf.Admin.User == "" {
+		warnings = append(warnings, "no admin credentials are set, the admin API rejects every request")
+	}
+
+	return printJSON(map[string]interface{}{
+		"valid":    true,
+		"env":      conf.Env,
+		"version":  conf.Version,
+		"dataDir":  conf.Store.Dir,
+		"warnings": warnings,
+	})
+}
+
+// runSubscriberGet muestra el suscriptor de un email
+func runSubscriberGet(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	subscriber, err := lookupSubscriber(args[0])
+	if err != nil {
+		return err
+	}
+	return printJSON(subscriber)
+}
+
+// runSubscriberTag añade etiquetas a un suscriptor
+func runSubscriberTag(args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+
+	tags := args[1:]
+	if err := fieldErrors(validation.ValidateTags("tags", &tags, services.AllowedTags())); err != nil {
+		return err
+	}
+
+	subscriber, err := lookupSubscriber(args[0])
+	if err != nil {
+		return err
+	}
+
+	if failed, err := services.AddTagsToSubscriber(actor(), subscriber.ID, tags); len(failed) > 0 {
+		return fmt.Errorf("adding tags %s failed: %w", strings.Join(failed, ", "), err)
+	}
+	return printJSON(map[string]interface{}{"email": subscriber.Email, "tags": tags})
+}
+
+// runSubscriberUnsubscribe da de baja a un suscriptor
+func runSubscriberUnsubscribe(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	email := args[0]
+	if err := fieldErrors(validation.ValidateEmail("email", &email)); err != nil {
+		return err
+	}
+
+	result, err := services.UnsubscribeUser(actor(), email)
+	if err != nil {
+		return err
+	}
+	if !result.Success {
+		return errors.New(result.Message)
+	}
+	return printJSON(result)
+}
+
+// runSubscriberImport importa suscriptores desde un CSV. Al interrumpirla con Ctrl+C,
+// volver a lanzar el mismo fichero continúa donde se quedó.
+func runSubscriberImport(args []string) error {
+	flags := flag.NewFlagSet("subscriber import", flag.ContinueOnError)
+	file := flags.String("file", "", "")
+	dryRun := flags.Bool("dry-run", false, "")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errUsage
+	}
+
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	report, err := services.ImportSubscribers(ctx, actor(), data, *dryRun)
+	if report != nil {
+		if err := printJSON(report); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// runSubscriberExport exporta los suscriptores a stdout o a un fichero
+func runSubscriberExport(args []string) error {
+	flags := flag.NewFlagSet("subscriber export", flag.ContinueOnError)
+	format := flags.String("format", string(models.ExportFormatCSV), "")
+	status := flags.String("status", "", "")
+	tags := flags.String("tags", "", "")
+	output := flags.String("output", "", "")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	filter := models.SubscriptionFilter{Status: *status}
+	if *tags != "" {
+		filter.Tags = strings.Split(*tags, ",")
+	}
+
+	switch models.ExportFormat(*format) {
+	case models.ExportFormatCSV, models.ExportFormatJSONL:
+	default:
+		return errUsage
+	}
+
+	if *output == "" {
+		_, err := services.ExportSubscribers(os.Stdout, models.ExportFormat(*format), filter)
+		return err
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	count, err := services.ExportSubscribers(file, models.ExportFormat(*format), filter)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return printJSON(map[string]interface{}{"output": *output, "subscribers": count})
+}
+
+// runEmailSendTest envía un email de prueba para comprobar la configuración SMTP
+func runEmailSendTest(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	email := args[0]
+	if err := fieldErrors(validation.ValidateEmail("email", &email)); err != nil {
+		return err
+	}
+
+	if err := services.SendTestEmail(email); err != nil {
+		return err
+	}
+	return printJSON(map[string]interface{}{"email": email, "sent": true})
+}
+
+// runResourceSend envía un recurso por email sin suscribir al destinatario
+func runResourceSend(args []string) error {
+	flags := flag.NewFlagSet("resource send", flag.ContinueOnError)
+	email := flags.String("email", "", "")
+	resourceID := flags.String("resource", "", "")
+	fileID := flags.String("file", "", "")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	var errs []models.FieldError
+	errs = append(errs, validation.ValidateEmail("email", email)...)
+	errs = append(errs, validation.ValidateResourceID("resource", resourceID)...)
+	errs = append(errs, validation.ValidateFileID("file", fileID)...)
+	if err := fieldErrors(errs); err != nil {
+		return err
+	}
+
+	sent, err := services.SendResourceEmail(actor(), models.ResourceEmailOptions{
+		Email:         *email,
+		ResourceID:    *resourceID,
+		ResourceTitle: services.GenerateResourceTitle(*resourceID, ""),
+		ResourceLink:  services.GenerateResourceURL(*fileID),
+	})
+	if err != nil {
+		return err
+	}
+	if !sent {
+		return errors.New("sending resource email failed")
+	}
+	return printJSON(map[string]interface{}{"email": *email, "resource": *resourceID, "sent": true})
+}
+
+// runJobsList lista las tareas programadas, opcionalmente filtradas por estado
+func runJobsList(args []string) error {
+	flags := flag.NewFlagSet("jobs list", flag.ContinueOnError)
+	status := flags.String("status", "", "")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	switch models.JobStatus(*status) {
+	case "", models.JobStatusPending, models.JobStatusRunning, models.JobStatusDone, models.JobStatusFailed, models.JobStatusCancelled:
+	default:
+		return errUsage
+	}
+
+	jobs, err := services.ListJobs(models.JobStatus(*status))
+	if err != nil {
+		return err
+	}
+	if jobs == nil {
+		jobs = []models.Job{}
+	}
+	return printJSON(jobs)
+}
+
+// runJobsRetry programa una tarea para que vuelva a ejecutarse en la próxima pasada del worker
+func runJobsRetry(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	job, err := services.RetryJob(args[0])
+	if err != nil {
+		return err
+	}
+	return printJSON(job)
+}
+
+// runMirrorStatus muestra el tamaño de la réplica local y su última reconciliación
+func runMirrorStatus(args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+
+	status, err := services.GetMirrorStatus()
+	if err != nil {
+		return err
+	}
+	return printJSON(status)
+}
+
+// runMirrorReconcile reconcilia la réplica local con el proveedor y muestra las diferencias corregidas
+func runMirrorReconcile(args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+
+	report, err := services.ReconcileMirror()
+	if report != nil {
+		if err := printJSON(report); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// runProvidersDivergences muestra las operaciones que los proveedores secundarios no recibieron
+func runProvidersDivergences(args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+
+	divergences, err := services.ListDivergences()
+	if err != nil {
+		return err
+	}
+	return printJSON(divergences)
+}
+
+// runOutboxList muestra las suscripciones de la bandeja de salida, opcionalmente filtradas por estado
+func runOutboxList(args []string) error {
+	flags := flag.NewFlagSet("outbox list", flag.ContinueOnError)
+	status := flags.String("status", "", "")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	switch models.OutboxStatus(*status) {
+	case "", models.OutboxPending, models.OutboxDone, models.OutboxFailed:
+	default:
+		return errUsage
+	}
+
+	entries, err := services.ListOutbox(models.OutboxStatus(*status))
+	if err != nil {
+		return err
+	}
+	return printJSON(entries)
+}
+
+// runOutboxGet muestra una solicitud de la bandeja de salida con el estado de cada paso
+func runOutboxGet(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	entry, err := services.GetOutboxEntry(args[0])
+	if err != nil {
+		return err
+	}
+	return printJSON(entry)
+}
+
+// runOutboxReplay ejecuta los pasos pendientes de la bandeja de salida y muestra cuántas solicitudes completó
+func runOutboxReplay(args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+
+	completed, err := services.ReplayOutbox()
+	if err != nil {
+		return err
+	}
+	return printJSON(map[string]int{"completed": completed})
+}
+
+// runDripList muestra las secuencias de seguimiento programadas con el estado de cada email
+func runDripList(args []string) error {
+	flags := flag.NewFlagSet("drip list", flag.ContinueOnError)
+	email := flags.String("email", "", "")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if *email != "" {
+		if err := fieldErrors(validation.ValidateEmail("email", email)); err != nil {
+			return err
+		}
+	}
+
+	enrollments, err := services.ListDrips(*email)
+	if err != nil {
+		return err
+	}
+	return printJSON(enrollments)
+}
+
+// runDripStop cancela los emails de seguimiento pendientes de un email, o solo los de un recurso
+func runDripStop(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	flags := flag.NewFlagSet("drip stop", flag.ContinueOnError)
+	resource := flags.String("resource", "", "")
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+
+	email := args[0]
+	if err := fieldErrors(validation.ValidateEmail("email", &email)); err != nil {
+		return err
+	}
+
+	stopped, err := services.StopDrips(email, *resource)
+	if err != nil {
+		return err
+	}
+	return printJSON(map[string]int{"cancelled": stopped})
+}
+
+// runHealth consulta el endpoint de estado de un servidor en marcha y falla si no está sano
+func runHealth(args []string) error {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	flags := flag.NewFlagSet("health", flag.ContinueOnError)
+	url := flags.String("url", "http://localhost:"+port, "")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: healthTimeout}
+	resp, err := client.Get(strings.TrimRight(*url, "/") + "/health")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var health api.HealthCheckResponse
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return fmt.Errorf("unexpected health response (HTTP %d): %w", resp.StatusCode, err)
+	}
+	if err := printJSON(health); err != nil {
+		return err
+	}
+	if health.Status != "healthy" {
+		return fmt.Errorf("server is %s", health.Status)
+	}
+	return nil
+}
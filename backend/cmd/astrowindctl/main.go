@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/internal/services"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Códigos de salida, pensados para usar la herramienta desde scripts
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// errUsage indica que los argumentos de un comando no son válidos
+var errUsage = errors.New("invalid arguments")
+
+// command describe un comando de la herramienta
+type command struct {
+	name        string
+	args        string
+	description string
+	// skipConfig evita cargar la configuración antes de ejecutar el comando
+	skipConfig bool
+	run        func(args []string) error
+}
+
+var commands = []command{
+	{name: "config check", description: "Valida la configuración del entorno", skipConfig: true, run: runConfigCheck},
+	{name: "subscriber get", args: "<email>", description: "Muestra un suscriptor", run: runSubscriberGet},
+	{name: "subscriber tag", args: "<email> <tag>...", description: "Añade etiquetas a un suscriptor", run: runSubscriberTag},
+	{name: "subscriber unsubscribe", args: "<email>", description: "Da de baja a un suscriptor", run: runSubscriberUnsubscribe},
+	{name: "subscriber import", args: "--file <csv> [--dry-run]", description: "Importa suscriptores desde un CSV", run: runSubscriberImport},
+	{name: "subscriber export", args: "[--format csv|jsonl] [--status <status>] [--tags <tag,...>] [--output <file>]", description: "Exporta los suscriptores", run: runSubscriberExport},
+	{name: "email send-test", args: "<email>", description: "Envía un email de prueba", run: runEmailSendTest},
+	{name: "resource send", args: "--email <email> --resource <id> [--file <id>]", description: "Envía un recurso por email", run: runResourceSend},
+	{name: "jobs list", args: "[--status pending|running|done|failed|cancelled]", description: "Lista las tareas programadas", run: runJobsList},
+	{name: "jobs retry", args: "<id>", description: "Vuelve a ejecutar una tarea", run: runJobsRetry},
+	{name: "mirror status", description: "Muestra el estado de la réplica local de suscriptores", run: runMirrorStatus},
+	{name: "mirror reconcile", description: "Reconcilia la réplica local con el proveedor de la newsletter", run: runMirrorReconcile},
+	{name: "providers divergences", description: "Lista las operaciones que no llegaron a los proveedores secundarios", run: runProvidersDivergences},
+	{name: "outbox list", args: "[--status pending|done|failed]", description: "Lista las solicitudes de suscripción de la bandeja de salida", run: runOutboxList},
+	{name: "outbox get", args: "<id>", description: "Muestra una solicitud de la bandeja de salida con el estado de cada paso", run: runOutboxGet},
+	{name: "outbox replay", description: "Ejecuta los pasos pendientes de la bandeja de salida", run: runOutboxReplay},
+	{name: "drip list", args: "[--email <email>]", description: "Lista las secuencias de seguimiento con el estado de cada email", run: runDripList},
+	{name: "drip stop", args: "<email> [--resource <id>]", description: "Cancela los emails de seguimiento pendientes de un email", run: runDripStop},
+	{name: "health", args: "[--url <url>]", description: "Consulta el estado de un servidor en marcha", skipConfig: true, run: runHealth},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run ejecuta la herramienta y devuelve el código de salida
+func run(args []string) int {
+	flags := flag.NewFlagSet("astrowindctl", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	verbose := flags.Bool("v", false, "")
+	if err := flags.Parse(args); err != nil {
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+
+	// Los logs van a stderr para que stdout contenga solo el resultado
+	level := zerolog.WarnLevel
+	if *verbose {
+		level = zerolog.DebugLevel
+	}
+	log.Logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).Level(level).With().Timestamp().Logger()
+
+	cmd, rest := findCommand(flags.Args())
+	if cmd == nil {
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+
+	if !cmd.skipConfig {
+		if _, err := services.LoadConfig(); err != nil {
+			fmt.Fprintf(os.Stderr, "error: invalid configuration: %v\n", err)
+			return exitFailure
+		}
+	}
+
+	err := cmd.run(rest)
+	switch {
+	case errors.Is(err, errUsage):
+		fmt.Fprintf(os.Stderr, "usage: astrowindctl %s %s\n", cmd.name, cmd.args)
+		return exitUsage
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// findCommand busca el comando que corresponde a los primeros argumentos
+// y devuelve el resto de argumentos
+func findCommand(args []string) (*command, []string) {
+	for i := range commands {
+		words := strings.Fields(commands[i].name)
+		if len(args) < len(words) {
+			continue
+		}
+		if strings.Join(args[:len(words)], " ") == commands[i].name {
+			return &commands[i], args[len(words):]
+		}
+	}
+	return nil, nil
+}
+
+// printUsage muestra la lista de comandos
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: astrowindctl [-v] <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(table, "  %s\t%s\n", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.description)
+	}
+	table.Flush()
+}
+
+// printJSON escribe un resultado en stdout como JSON
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// actor identifica al usuario del sistema en el registro de auditoría
+func actor() models.Actor {
+	if current, err := user.Current(); err == nil && current.Username != "" {
+		return models.CLIActor(current.Username)
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return models.CLIActor(name)
+	}
+	return models.CLIActor("unknown")
+}
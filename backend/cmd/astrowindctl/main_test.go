@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureStderr runs fn and returns what it wrote to stderr
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = writer
+	defer func() { os.Stderr = stderr }()
+
+	fn()
+	writer.Close()
+	output, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(output)
+}
+
+func TestConfigCheckReportsInvalidEnvironment(t *testing.T) {
+	t.Setenv("ENV", "bogus")
+
+	code := exitOK
+	output := captureStderr(t, func() {
+		code = run([]string{"config", "check"})
+	})
+	if code != exitFailure {
+		t.Errorf("exit code = %d, want %d", code, exitFailure)
+	}
+	if !strings.Contains(output, "invalid environment: bogus") {
+		t.Errorf("stderr = %q, want the validation error", output)
+	}
+}
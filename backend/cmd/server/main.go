@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mlorentedev/mlorente-backend/internal/api"
+	"github.com/mlorentedev/mlorente-backend/internal/services"
 	"github.com/mlorentedev/mlorente-backend/pkg/config"
 	"github.com/mlorentedev/mlorente-backend/pkg/logger"
 )
@@ -14,7 +17,7 @@ func main() {
 	logger := logger.NewLogger()
 
 	// Cargar variables de entorno
-	_, err := config.GetConfig()
+	conf, err := config.GetConfig()
 	if err != nil {
 		logger.Fatal().Err(err).Msg("Error al cargar la configuración")
 	}
@@ -25,6 +28,12 @@ func main() {
 	// Configurar router sin Logger y Recovery por defecto
 	r := gin.New() // Usar gin.New() en lugar de gin.Default()
 
+	// Confiar en X-Forwarded-For solo si viene de los proxies configurados, para que la IP
+	// del cliente (y con ella los límites por IP) no se pueda falsear con esa cabecera
+	if err := r.SetTrustedProxies(conf.Security.TrustedProxies); err != nil {
+		logger.Fatal().Err(err).Msg("Error al configurar los proxies de confianza")
+	}
+
 	// Usar middlewares personalizados (Logger, Recovery)
 	r.Use(gin.Logger())
 	r.Use(gin.Recovery())
@@ -35,6 +44,17 @@ func main() {
 	// Configurar rutas
 	api.SetupRoutes(r)
 
+	// Procesar en segundo plano la cola de tareas programadas
+	services.StartJobWorker(context.Background(), 30*time.Second)
+
+	// Reintentar los pasos pendientes de las solicitudes de la bandeja de salida
+	services.StartOutboxReplayer(context.Background(), 30*time.Second)
+
+	// Reconciliar periódicamente la réplica local con el proveedor, si permite recorrer su lista
+	if conf.Mirror.ReconcileHours > 0 && services.ProviderSupportsListing() {
+		services.StartMirrorReconciler(context.Background(), time.Duration(conf.Mirror.ReconcileHours)*time.Hour)
+	}
+
 	// Iniciar servidor
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -0,0 +1,482 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/internal/services"
+	"github.com/mlorentedev/mlorente-backend/internal/validation"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+const (
+	// defaultAdminErrorsLimit is how many recent errors or audit entries are listed when no limit is given
+	defaultAdminErrorsLimit = 50
+	// maxImportBytes is the largest CSV accepted by the import endpoint
+	maxImportBytes = 10 << 20
+)
+
+// adminRespond writes an admin API response. The admin API always answers JSON.
+func adminRespond(c *gin.Context, httpCode int, message string, data interface{}) {
+	c.JSON(httpCode, models.AdminResult{
+		HttpCode: httpCode,
+		Success:  httpCode < 400,
+		Message:  message,
+		Data:     data,
+	})
+}
+
+// adminValidationErrors writes field validation errors using the common error envelope, always as JSON
+func adminValidationErrors(c *gin.Context, errs []models.FieldError) {
+	c.JSON(http.StatusBadRequest, models.ErrorResponse{
+		HttpCode: http.StatusBadRequest,
+		Success:  false,
+		Message:  constants.Messages.Frontend.Errors["ValidationError"],
+		Errors:   errs,
+	})
+}
+
+// adminServerError logs a failed admin operation and answers with a generic server error
+func adminServerError(c *gin.Context, err error) {
+	logger.LogFunction("error", constants.Messages.Backend.Error["AdminError"], map[string]string{
+		"actor": c.GetString(AdminActorKey),
+		"path":  c.FullPath(),
+		"error": err.Error(),
+	})
+	adminRespond(c, http.StatusInternalServerError, constants.Messages.Frontend.Errors["ServerError"], nil)
+}
+
+// adminSubscriber validates the email path parameter and looks up its subscriber,
+// writing the error response itself when there is none
+func adminSubscriber(c *gin.Context) (*models.Subscriber, bool) {
+	email := c.Param("email")
+	if errs := validation.ValidateEmail("email", &email); len(errs) > 0 {
+		adminValidationErrors(c, errs)
+		return nil, false
+	}
+
+	subscriberCheck, err := services.CheckSubscriber(email)
+	if err != nil {
+		adminServerError(c, err)
+		return nil, false
+	}
+	if !subscriberCheck.Success || subscriberCheck.Subscriber == nil {
+		adminRespond(c, http.StatusNotFound, constants.Messages.Frontend.Errors["EmailNotSubscribed"], nil)
+		return nil, false
+	}
+	return subscriberCheck.Subscriber, true
+}
+
+// AdminGetSubscriberHandler looks up a subscriber by email
+func AdminGetSubscriberHandler(c *gin.Context) {
+	subscriber, ok := adminSubscriber(c)
+	if !ok {
+		return
+	}
+	adminRespond(c, http.StatusOK, constants.Messages.Frontend.Success["Done"], subscriber)
+}
+
+// AdminAddTagsHandler adds tags to a subscriber
+func AdminAddTagsHandler(c *gin.Context) {
+	var request models.AdminTagsRequest
+
+	// Bind JSON body
+	if err := c.ShouldBindJSON(&request); err != nil {
+		adminValidationErrors(c, validation.BindingErrors(err))
+		return
+	}
+	if errs := validation.ValidateTags("tags", &request.Tags, services.AllowedTags()); len(errs) > 0 {
+		adminValidationErrors(c, errs)
+		return
+	}
+
+	subscriber, ok := adminSubscriber(c)
+	if !ok {
+		return
+	}
+
+	if failed, _ := services.AddTagsToSubscriber(models.AdminActor(c.GetString(AdminActorKey)), subscriber.ID, request.Tags); len(failed) > 0 {
+		adminRespond(c, http.StatusBadGateway, constants.Messages.Frontend.Errors["TagsUpdateError"], failed)
+		return
+	}
+	adminRespond(c, http.StatusOK, constants.Messages.Frontend.Success["Done"], request.Tags)
+}
+
+// AdminRemoveTagHandler removes a tag from a subscriber
+func AdminRemoveTagHandler(c *gin.Context) {
+	// Tags added before the whitelist was configured can still be removed, so only their format is checked
+	tags := []string{c.Param("tag")}
+	if errs := validation.ValidateTags("tag", &tags, nil); len(errs) > 0 {
+		adminValidationErrors(c, errs)
+		return
+	}
+	if len(tags) == 0 {
+		adminValidationErrors(c, []models.FieldError{{Field: "tag", Message: constants.Messages.Frontend.Errors["RequiredField"]}})
+		return
+	}
+
+	subscriber, ok := adminSubscriber(c)
+	if !ok {
+		return
+	}
+
+	if !services.RemoveTagFromSubscriber(models.AdminActor(c.GetString(AdminActorKey)), subscriber.ID, tags[0]) {
+		adminRespond(c, http.StatusBadGateway, constants.Messages.Frontend.Errors["TagsUpdateError"], nil)
+		return
+	}
+	adminRespond(c, http.StatusOK, constants.Messages.Frontend.Success["Done"], nil)
+}
+
+// AdminSendResourceHandler sends a resource email right away, without subscribing the recipient
+func AdminSendResourceHandler(c *gin.Context) {
+	var request models.AdminResourceRequest
+
+	// Bind JSON body
+	if err := c.ShouldBindJSON(&request); err != nil {
+		adminValidationErrors(c, validation.BindingErrors(err))
+		return
+	}
+
+	var errs []models.FieldError
+	errs = append(errs, validation.ValidateEmail("email", &request.Email)...)
+	errs = append(errs, validation.ValidateResourceID("resource_id", &request.ResourceID)...)
+	errs = append(errs, validation.ValidateFileID("file_id", &request.FileID)...)
+	if len(errs) > 0 {
+		adminValidationErrors(c, errs)
+		return
+	}
+
+	sent, err := services.SendResourceEmail(models.AdminActor(c.GetString(AdminActorKey)), models.ResourceEmailOptions{
+		Email:         request.Email,
+		ResourceID:    request.ResourceID,
+		ResourceTitle: services.GenerateResourceTitle(request.ResourceID, ""),
+		ResourceLink:  services.GenerateResourceURL(request.FileID),
+	})
+	if err != nil || !sent {
+		if err == nil {
+			err = errors.New(constants.Messages.Service.Email["Failed"])
+		}
+		adminServerError(c, err)
+		return
+	}
+	adminRespond(c, http.StatusOK, constants.Messages.Frontend.Success["ResourceSent"], nil)
+}
+
+// AdminListJobsHandler lists scheduled jobs, optionally filtered by the "status" query parameter
+func AdminListJobsHandler(c *gin.Context) {
+	status := models.JobStatus(c.Query("status"))
+	switch status {
+	case "", models.JobStatusPending, models.JobStatusRunning, models.JobStatusDone, models.JobStatusFailed, models.JobStatusCancelled:
+	default:
+		adminValidationErrors(c, []models.FieldError{{
+			Field:   "status",
+			Message: constants.Messages.Frontend.Errors["IncompleteData"],
+		}})
+		return
+	}
+
+	jobs, err := services.ListJobs(status)
+	if err != nil {
+		adminServerError(c, err)
+		return
+	}
+	if jobs == nil {
+		jobs = []models.Job{}
+	}
+	adminRespond(c, http.StatusOK, constants.Messages.Frontend.Success["Done"], jobs)
+}
+
+// AdminRetryJobHandler schedules a failed or pending job to run again right away
+func AdminRetryJobHandler(c *gin.Context) {
+	job, err := services.RetryJob(c.Param("id"))
+	switch {
+	case errors.Is(err, services.ErrJobNotFound):
+		adminRespond(c, http.StatusNotFound, constants.Messages.Frontend.Errors["NotFound"], nil)
+	case errors.Is(err, services.ErrJobRunning):
+		adminRespond(c, http.StatusConflict, err.Error(), nil)
+	case err != nil:
+		adminServerError(c, err)
+	default:
+		adminRespond(c, http.StatusOK, constants.Messages.Frontend.Success["Done"], job)
+	}
+}
+
+// AdminRecentErrorsHandler lists the most recent errors logged by the server, newest first
+func AdminRecentErrorsHandler(c *gin.Context) {
+	limit := defaultAdminErrorsLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			adminValidationErrors(c, []models.FieldError{{
+				Field:   "limit",
+				Message: constants.Messages.Frontend.Errors["IncompleteData"],
+			}})
+			return
+		}
+		limit = parsed
+	}
+
+	adminRespond(c, http.StatusOK, constants.Messages.Frontend.Success["Done"], logger.RecentErrors(limit))
+}
+
+// AdminConsentsHandler lists the consent ledger entries of the email given in the "email" query parameter
+func AdminConsentsHandler(c *gin.Context) {
+	email := c.Query("email")
+	if errs := validation.ValidateEmail("email", &email); len(errs) > 0 {
+		adminValidationErrors(c, errs)
+		return
+	}
+
+	consents, err := services.FindConsents(email)
+	if err != nil {
+		adminServerError(c, err)
+		return
+	}
+	adminRespond(c, http.StatusOK, constants.Messages.Frontend.Success["Done"], consents)
+}
+
+// AdminAuditHandler lists audit log entries, newest first. The "actor" (prefix), "action",
+// "target", "since" (RFC 3339) and "limit" query parameters narrow the result.
+func AdminAuditHandler(c *gin.Context) {
+	filter := models.AuditFilter{
+		Actor:  models.Actor(c.Query("actor")),
+		Action: models.AuditAction(c.Query("action")),
+		Target: c.Query("target"),
+		Limit:  defaultAdminErrorsLimit,
+	}
+
+	var errs []models.FieldError
+	if value := c.Query("since"); value != "" {
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			errs = append(errs, models.FieldError{Field: "since", Message: constants.Messages.Frontend.Errors["IncompleteData"]})
+		} else {
+			filter.Since = since
+		}
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			errs = append(errs, models.FieldError{Field: "limit", Message: constants.Messages.Frontend.Errors["IncompleteData"]})
+		} else {
+			filter.Limit = limit
+		}
+	}
+	if len(errs) > 0 {
+		adminValidationErrors(c, errs)
+		return
+	}
+
+	entries, err := services.QueryAudit(filter)
+	if err != nil {
+		adminServerError(c, err)
+		return
+	}
+	adminRespond(c, http.StatusOK, constants.Messages.Frontend.Success["Done"], entries)
+}
+
+// AdminImportHandler imports subscribers from the CSV sent as the request body. With
+// "dry_run=true" it only validates the file; otherwise the import runs in the background
+// and GET /imports/:id reports its progress.
+func AdminImportHandler(c *gin.Context) {
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes))
+	if err != nil {
+		adminRespond(c, http.StatusRequestEntityTooLarge, constants.Messages.Frontend.Errors["InvalidImport"], err.Error())
+		return
+	}
+
+	var report *models.ImportReport
+	httpCode := http.StatusAccepted
+	if c.Query("dry_run") == "true" {
+		report, err = services.ImportSubscribers(c.Request.Context(), models.AdminActor(c.GetString(AdminActorKey)), data, true)
+		httpCode = http.StatusOK
+	} else {
+		report, err = services.StartImport(models.AdminActor(c.GetString(AdminActorKey)), data)
+	}
+
+	switch {
+	case errors.Is(err, services.ErrInvalidImport):
+		adminRespond(c, http.StatusBadRequest, constants.Messages.Frontend.Errors["InvalidImport"], err.Error())
+	case errors.Is(err, services.ErrImportRunning):
+		adminRespond(c, http.StatusConflict, err.Error(), nil)
+	case err != nil:
+		adminServerError(c, err)
+	default:
+		adminRespond(c, httpCode, constants.Messages.Frontend.Success["Done"], report)
+	}
+}
+
+// AdminGetImportHandler reports the progress and result of an import
+func AdminGetImportHandler(c *gin.Context) {
+	report, found, err := services.GetImport(c.Param("id"))
+	switch {
+	case err != nil:
+		adminServerError(c, err)
+	case !found:
+		adminRespond(c, http.StatusNotFound, constants.Messages.Frontend.Errors["NotFound"], nil)
+	default:
+		adminRespond(c, http.StatusOK, constants.Messages.Frontend.Success["Done"], report)
+	}
+}
+
+// AdminExportHandler returns every subscription as a CSV ("format=csv", the default) or
+// JSON Lines ("format=jsonl") download, optionally filtered by the "status" query parameter
+// and by one or more "tag" query parameters
+func AdminExportHandler(c *gin.Context) {
+	format := models.ExportFormat(c.DefaultQuery("format", string(models.ExportFormatCSV)))
+	contentType := "text/csv; charset=utf-8"
+	switch format {
+	case models.ExportFormatCSV:
+	case models.ExportFormatJSONL:
+		contentType = "application/x-ndjson"
+	default:
+		adminValidationErrors(c, []models.FieldError{{
+			Field:   "format",
+			Message: constants.Messages.Frontend.Errors["IncompleteData"],
+		}})
+		return
+	}
+
+	// The file is built before answering, so a provider error can still be reported as JSON
+	var buffer bytes.Buffer
+	filter := models.SubscriptionFilter{Status: c.Query("status"), Tags: c.QueryArray("tag")}
+	if _, err := services.ExportSubscribers(&buffer, format, filter); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["ExportError"], err.Error())
+		adminRespond(c, http.StatusBadGateway, constants.Messages.Frontend.Errors["ServerError"], nil)
+		return
+	}
+
+	filename := "suscriptores-" + time.Now().UTC().Format(time.DateOnly) + "." + string(format)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, contentType, buffer.Bytes())
+}
+
+// AdminMirrorStatusHandler reports the size of the local subscriber mirror and its last reconciliation
+func AdminMirrorStatusHandler(c *gin.Context) {
+	status, err := services.GetMirrorStatus()
+	if err != nil {
+		adminServerError(c, err)
+		return
+	}
+	adminRespond(c, http.StatusOK, constants.Messages.Frontend.Success["Done"], status)
+}
+
+// AdminReconcileMirrorHandler reconciles the local subscriber mirror with the newsletter provider right away
+// and returns the drift report
+func AdminReconcileMirrorHandler(c *gin.Context) {
+	report, err := services.ReconcileMirror()
+	switch {
+	case errors.Is(err, services.ErrReconcileRunning):
+		adminRespond(c, http.StatusConflict, err.Error(), nil)
+	case err != nil:
+		adminRespond(c, http.StatusBadGateway, constants.Messages.Frontend.Errors["ServerError"], report)
+	default:
+		adminRespond(c, http.StatusOK, constants.Messages.Frontend.Success["Done"], report)
+	}
+}
+
+// AdminDeadLettersHandler lists the outbound notifications that ran out of attempts
+func AdminDeadLettersHandler(c *gin.Context) {
+	letters, err := services.ListDeadLetters()
+	if err != nil {
+		adminServerError(c, err)
+		return
+	}
+	adminRespond(c, http.StatusOK, constants.Messages.Frontend.Success["Done"], letters)
+}
+
+// AdminRedeliverHandler schedules a dead letter for delivery again and returns its new job
+func AdminRedeliverHandler(c *gin.Context) {
+	job, err := services.RedeliverDeadLetter(c.Param("id"))
+	switch {
+	case errors.Is(err, services.ErrDeadLetterNotFound):
+		adminRespond(c, http.StatusNotFound, constants.Messages.Frontend.Errors["NotFound"], nil)
+	case err != nil:
+		adminServerError(c, err)
+	default:
+		adminRespond(c, http.StatusAccepted, constants.Messages.Frontend.Success["Done"], job)
+	}
+}
+
+// AdminDivergencesHandler lists the operations the secondary newsletter providers missed
+func AdminDivergencesHandler(c *gin.Context) {
+	divergences, err := services.ListDivergences()
+	if err != nil {
+		adminServerError(c, err)
+		return
+	}
+	adminRespond(c, http.StatusOK, constants.Messages.Frontend.Success["Done"], divergences)
+}
+
+// AdminMetricsHandler reports the circuit breakers of the newsletter provider APIs and counts the
+// subscription requests of the outbox by status
+func AdminMetricsHandler(c *gin.Context) {
+	metrics, err := services.GetProviderMetrics()
+	if err != nil {
+		adminServerError(c, err)
+		return
+	}
+	adminRespond(c, http.StatusOK, constants.Messages.Frontend.Success["Done"], metrics)
+}
+
+// AdminOutboxHandler lists the subscription requests of the outbox with the status of their steps,
+// optionally filtered by status
+func AdminOutboxHandler(c *gin.Context) {
+	status := models.OutboxStatus(c.Query("status"))
+	switch status {
+	case "", models.OutboxPending, models.OutboxDone, models.OutboxFailed:
+	default:
+		adminValidationErrors(c, []models.FieldError{{
+			Field:   "status",
+			Message: constants.Messages.Frontend.Errors["IncompleteData"],
+		}})
+		return
+	}
+
+	entries, err := services.ListOutbox(status)
+	if err != nil {
+		adminServerError(c, err)
+		return
+	}
+	adminRespond(c, http.StatusOK, constants.Messages.Frontend.Success["Done"], entries)
+}
+
+// AdminGetOutboxEntryHandler returns a subscription request of the outbox with the status of its steps
+func AdminGetOutboxEntryHandler(c *gin.Context) {
+	entry, err := services.GetOutboxEntry(c.Param("id"))
+	switch {
+	case errors.Is(err, services.ErrOutboxEntryNotFound):
+		adminRespond(c, http.StatusNotFound, constants.Messages.Frontend.Errors["NotFound"], nil)
+	case err != nil:
+		adminServerError(c, err)
+	default:
+		adminRespond(c, http.StatusOK, constants.Messages.Frontend.Success["Done"], entry)
+	}
+}
+
+// AdminDripsHandler lists the runs of follow-up sequences with the status of each email,
+// optionally only those of the "email" query parameter
+func AdminDripsHandler(c *gin.Context) {
+	email := c.Query("email")
+	if email != "" {
+		if errs := validation.ValidateEmail("email", &email); len(errs) > 0 {
+			adminValidationErrors(c, errs)
+			return
+		}
+	}
+
+	enrollments, err := services.ListDrips(email)
+	if err != nil {
+		adminServerError(c, err)
+		return
+	}
+	adminRespond(c, http.StatusOK, constants.Messages.Frontend.Success["Done"], enrollments)
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminRemoveTagRejectsInvalidTag(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, tag := range []string{"Bad Tag", "-tag", " "} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodDelete, "/admin/api/subscribers/ana@example.com/tags/x", nil)
+		c.Params = gin.Params{{Key: "email", Value: "ana@example.com"}, {Key: "tag", Value: tag}}
+
+		AdminRemoveTagHandler(c)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("removing tag %q answered %d, want 400", tag, w.Code)
+		}
+	}
+}
+
+func TestAdminAuditRejectsInvalidLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, limit := range []string{"abc", "0", "-5"} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/admin/api/audit?limit="+limit, nil)
+
+		AdminAuditHandler(c)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("limit %q answered %d, want 400", limit, w.Code)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+)
+
+// captureAttribution completes the attribution sent in the form with the UTM parameters
+// found in the request query string and in the page that issued the HTMX request
+// (HX-Current-URL). Values sent explicitly in the form always take precedence.
+func captureAttribution(c *gin.Context, attribution *models.Attribution) {
+	sources := []url.Values{c.Request.URL.Query()}
+
+	currentURL, err := url.Parse(c.GetHeader("HX-Current-URL"))
+	if err != nil || currentURL.Host == "" {
+		currentURL = nil
+	}
+	if currentURL != nil {
+		sources = append(sources, currentURL.Query())
+	}
+
+	fill := func(field *string, key string) {
+		if *field != "" {
+			return
+		}
+		for _, values := range sources {
+			if value := values.Get(key); value != "" {
+				*field = value
+				return
+			}
+		}
+	}
+
+	fill(&attribution.UtmSource, "utm_source")
+	fill(&attribution.UtmMedium, "utm_medium")
+	fill(&attribution.UtmCampaign, "utm_campaign")
+	fill(&attribution.UtmTerm, "utm_term")
+	fill(&attribution.UtmContent, "utm_content")
+	fill(&attribution.ReferringSite, "referring_site")
+	fill(&attribution.LandingPage, "landing_page")
+
+	// The page hosting the form is the landing page unless the form says otherwise
+	if attribution.LandingPage == "" && currentURL != nil {
+		attribution.LandingPage = currentURL.String()
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/internal/services"
+	"github.com/mlorentedev/mlorente-backend/internal/validation"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+// maxSlotDays limits how many days of availability can be listed in a single request
+const maxSlotDays = 31
+
+// BookingSlotsHandler lists the free booking slots. Accepts optional "from" (YYYY-MM-DD,
+// in the booking timezone) and "days" query parameters.
+func BookingSlotsHandler(c *gin.Context) {
+	var response models.BookingSlotsResult
+	location := services.BookingLocation()
+	response.Timezone = location.String()
+
+	now := time.Now().In(location)
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, location)
+		if err != nil {
+			respondValidationErrors(c, []models.FieldError{{
+				Field:   "from",
+				Message: constants.Messages.Frontend.Errors["InvalidDate"],
+			}})
+			return
+		}
+		from = parsed
+	}
+
+	days := 7
+	if value := c.Query("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			respondValidationErrors(c, []models.FieldError{{
+				Field:   "days",
+				Message: constants.Messages.Frontend.Errors["IncompleteData"],
+			}})
+			return
+		}
+		days = min(parsed, maxSlotDays)
+	}
+
+	slots, err := services.AvailableSlots(from, days)
+	if err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["BookingError"], err.Error())
+		response.HttpCode = http.StatusInternalServerError
+		response.Message = constants.Messages.Frontend.Errors["ServerError"]
+		respond(c, response.HttpCode, response.Message, response, "")
+		return
+	}
+
+	response.HttpCode = http.StatusOK
+	response.Success = true
+	response.Message = constants.Messages.Frontend.Success["SlotsListed"]
+	response.Slots = slots
+
+	// Text representations list the slots in the booking timezone
+	formatted := make([]string, 0, len(slots))
+	for _, slot := range slots {
+		formatted = append(formatted, slot.Start.In(location).Format("02/01/2006 15:04"))
+	}
+	respond(c, response.HttpCode, response.Message+": "+strings.Join(formatted, ", "), response, "")
+}
+
+// BookingHoldHandler holds a slot for a few minutes while the visitor fills in the booking form
+func BookingHoldHandler(c *gin.Context) {
+	var request models.BookingHoldRequest
+	var response models.BookingResult
+
+	// Bind form data
+	if err := c.ShouldBind(&request); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["IncompleteData"], err.Error())
+		respondValidationErrors(c, validation.BindingErrors(err))
+		return
+	}
+
+	start, errs := validation.ValidateBookingHoldRequest(&request)
+	if len(errs) > 0 {
+		logger.LogFunction("error", constants.Messages.Backend.Error["ValidationError"], errs)
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	hold, err := services.HoldSlot(start)
+	if err != nil {
+		response.HttpCode, response.Message = bookingErrorResponse(err)
+		respond(c, response.HttpCode, response.Message, response, "")
+		return
+	}
+
+	response.HttpCode = http.StatusCreated
+	response.Success = true
+	response.Message = constants.Messages.Frontend.Success["SlotHeld"]
+	response.HoldID = hold.ID
+	response.Start = &hold.Start
+	response.End = &hold.End
+	response.ExpiresAt = hold.ExpiresAt
+	respond(c, response.HttpCode, response.Message, response, "")
+}
+
+// BookingHandler confirms a booking and emails the calendar invite to both parties
+func BookingHandler(c *gin.Context) {
+	var request models.BookingRequest
+	var response models.BookingResult
+
+	// Bind form data
+	if err := c.ShouldBind(&request); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["IncompleteData"], err.Error())
+		respondValidationErrors(c, validation.BindingErrors(err))
+		return
+	}
+
+	start, errs := validation.ValidateBookingRequest(&request)
+	if len(errs) > 0 {
+		logger.LogFunction("error", constants.Messages.Backend.Error["ValidationError"], errs)
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	booking, err := services.ConfirmBooking(request, start)
+	if err != nil {
+		response.HttpCode, response.Message = bookingErrorResponse(err)
+		respond(c, response.HttpCode, response.Message, response, "")
+		return
+	}
+
+	response.HttpCode = http.StatusCreated
+	response.Success = true
+	response.Message = constants.Messages.Frontend.Success["BookingConfirmed"]
+	response.BookingID = booking.ID
+	response.Start = &booking.Start
+	response.End = &booking.End
+	respond(c, response.HttpCode, response.Message, response, constants.URLs.SuccessPages.Booking)
+}
+
+// bookingErrorResponse maps booking service errors to an HTTP status and a frontend message
+func bookingErrorResponse(err error) (int, string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidSlot):
+		logger.LogFunction("warn", constants.Messages.Backend.Warn["BookingRejected"], err.Error())
+		return http.StatusBadRequest, constants.Messages.Frontend.Errors["InvalidSlot"]
+	case errors.Is(err, services.ErrSlotUnavailable):
+		logger.LogFunction("warn", constants.Messages.Backend.Warn["BookingRejected"], err.Error())
+		return http.StatusConflict, constants.Messages.Frontend.Errors["SlotUnavailable"]
+	case errors.Is(err, services.ErrHoldExpired):
+		logger.LogFunction("warn", constants.Messages.Backend.Warn["BookingRejected"], err.Error())
+		return http.StatusConflict, constants.Messages.Frontend.Errors["HoldExpired"]
+	default:
+		logger.LogFunction("error", constants.Messages.Backend.Error["BookingError"], err.Error())
+		return http.StatusInternalServerError, constants.Messages.Frontend.Errors["ServerError"]
+	}
+}
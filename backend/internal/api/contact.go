@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/internal/services"
+	"github.com/mlorentedev/mlorente-backend/internal/validation"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+// ContactHandler handles messages sent from the contact form
+func ContactHandler(c *gin.Context) {
+	var request models.ContactRequest
+	var response models.ContactResult
+
+	// Helper function to set the common response attributes
+	setResponse := func(httpCode int, success bool, message string) {
+		response.HttpCode = httpCode
+		response.Success = success
+		response.Message = message
+	}
+
+	// Bind form data
+	if err := c.ShouldBind(&request); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["IncompleteData"], err.Error())
+		respondValidationErrors(c, validation.BindingErrors(err))
+		return
+	}
+
+	// Normalize and validate request fields
+	if errs := validation.ValidateContactRequest(&request); len(errs) > 0 {
+		logger.LogFunction("error", constants.Messages.Backend.Error["ValidationError"], errs)
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	// Spam is answered as a success so bots get no signal, but nothing is sent
+	if services.IsLikelySpam(request) {
+		logger.LogFunction("warn", constants.Messages.Backend.Warn["SpamDetected"], map[string]string{
+			"email": request.Email,
+			"ip":    c.ClientIP(),
+		})
+		setResponse(http.StatusOK, true, constants.Messages.Frontend.Success["ContactSent"])
+		respond(c, response.HttpCode, response.Message, response, constants.URLs.SuccessPages.Contact)
+		return
+	}
+
+	if err := services.ProcessContact(request); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["ContactError"], err.Error())
+		setResponse(http.StatusInternalServerError, false, constants.Messages.Frontend.Errors["ServerError"])
+		respond(c, response.HttpCode, response.Message, response, "")
+		return
+	}
+
+	setResponse(http.StatusOK, true, constants.Messages.Frontend.Success["ContactSent"])
+	respond(c, response.HttpCode, response.Message, response, constants.URLs.SuccessPages.Contact)
+}
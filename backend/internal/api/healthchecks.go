@@ -2,11 +2,15 @@ package api
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/internal/services"
 	"github.com/mlorentedev/mlorente-backend/pkg/config"
 	"github.com/mlorentedev/mlorente-backend/pkg/logger"
 )
@@ -69,11 +73,6 @@ func HealthCheckHandler(c *gin.Context) {
 
 			mu.Lock()
 			checks = append(checks, result)
-
-			// Update overall status if any check fails
-			if result.Status != "healthy" {
-				response.Status = "degraded"
-			}
 			mu.Unlock()
 		}(check)
 	}
@@ -85,17 +84,28 @@ func HealthCheckHandler(c *gin.Context) {
 	response.Checks = checks
 
 	// Determine final status
-	for _, check := range checks {
-		if check.Status != "healthy" {
-			response.Status = "unhealthy"
-			break
-		}
-	}
+	response.Status = overallStatus(checks)
 
 	// Respond with health check results
 	c.JSON(http.StatusOK, response)
 }
 
+// overallStatus is "unhealthy" when a check reports it, "degraded" when any other check is
+// not healthy and "healthy" otherwise
+func overallStatus(checks []HealthCheckResult) string {
+	status := "healthy"
+	for _, check := range checks {
+		switch check.Status {
+		case "healthy":
+		case "unhealthy":
+			return "unhealthy"
+		default:
+			status = "degraded"
+		}
+	}
+	return status
+}
+
 // checkDatabaseConnection verifies database connectivity
 func checkDatabaseConnection(ctx context.Context) HealthCheckResult {
 	start := time.Now()
@@ -114,18 +124,23 @@ func checkDatabaseConnection(ctx context.Context) HealthCheckResult {
 	return createHealthCheckResult("database", "healthy", "Database connection successful", latency)
 }
 
-// checkExternalServices verifies external API dependencies
+// checkExternalServices reports the circuit breakers of the newsletter provider APIs. An open
+// circuit degrades the service: signups are queued in the outbox until the provider recovers.
 func checkExternalServices(ctx context.Context) HealthCheckResult {
 	start := time.Now()
 
-	// Check Beehiiv API connectivity
-	// Example:
-	// resp, err := http.Get("https://api.beehiiv.com/v1/some-endpoint")
-	// if err != nil {
-	//     return createHealthCheckResult("external_services", "unhealthy", err.Error(), 0)
-	// }
+	var open []string
+	for _, circuit := range services.CircuitStatuses() {
+		if circuit.State != models.CircuitClosed {
+			open = append(open, fmt.Sprintf("%s (%s)", circuit.Host, circuit.State))
+		}
+	}
 
 	latency := time.Since(start).Milliseconds()
+	if len(open) > 0 {
+		return createHealthCheckResult("external_services", "degraded",
+			"Newsletter provider circuit not closed, signups queued in the outbox: "+strings.Join(open, ", "), latency)
+	}
 	return createHealthCheckResult("external_services", "healthy", "All external services operational", latency)
 }
 
@@ -0,0 +1,24 @@
+package api
+
+import "testing"
+
+func TestOverallStatus(t *testing.T) {
+	cases := []struct {
+		statuses []string
+		want     string
+	}{
+		{[]string{"healthy", "healthy"}, "healthy"},
+		{[]string{"healthy", "degraded"}, "degraded"},
+		{[]string{"degraded", "unknown"}, "degraded"},
+		{[]string{"degraded", "unhealthy", "healthy"}, "unhealthy"},
+	}
+	for _, tc := range cases {
+		var checks []HealthCheckResult
+		for _, status := range tc.statuses {
+			checks = append(checks, HealthCheckResult{Status: status})
+		}
+		if got := overallStatus(checks); got != tc.want {
+			t.Errorf("overallStatus(%v) = %q, want %q", tc.statuses, got, tc.want)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/mlorentedev/mlorente-backend/internal/constants"
 	"github.com/mlorentedev/mlorente-backend/internal/models"
 	"github.com/mlorentedev/mlorente-backend/internal/services"
+	"github.com/mlorentedev/mlorente-backend/internal/validation"
 	"github.com/mlorentedev/mlorente-backend/pkg/logger"
 )
 
@@ -25,21 +26,40 @@ func LeadMagnetHandler(c *gin.Context) {
 	// Bind form data
 	if err := c.ShouldBind(&request); err != nil {
 		logger.LogFunction("error", constants.Messages.Backend.Error["IncompleteData"], err.Error())
-		setResponse(http.StatusBadRequest, false, constants.Messages.Frontend.Errors["IncompleteData"])
-		c.String(response.HttpCode, response.Message)
+		respondValidationErrors(c, validation.BindingErrors(err))
 		return
 	}
 
 	logger.LogFunction("info", constants.Messages.Backend.Info["RequestProcessing"], request)
 
-	// Validate email format
-	if request.Email == "" || !services.IsValidEmailFormat(request.Email) {
-		logger.LogFunction("error", constants.Messages.Backend.Error["InvalidEmail"], request.Email)
-		setResponse(http.StatusBadRequest, false, constants.Messages.Frontend.Errors["InvalidEmail"])
-		c.String(response.HttpCode, response.Message)
+	// Complete attribution from the query string and the HTMX page
+	captureAttribution(c, &request.Attribution)
+
+	// Normalize and validate request fields
+	if errs := validation.ValidateResourceRequest(&request, services.AllowedTags()); len(errs) > 0 {
+		logger.LogFunction("error", constants.Messages.Backend.Error["ValidationError"], errs)
+		respondValidationErrors(c, errs)
 		return
 	}
 
+	// Without an idempotency key, repeated requests for the same resource are absorbed for a while
+	if c.GetString(IdempotencyKeyContext) == "" {
+		if !services.ClaimResourceRequest(request.Email, request.ResourceID) {
+			logger.LogFunction("info", constants.Messages.Backend.Info["ResourceRequestDeduplicated"], map[string]string{
+				"email":      request.Email,
+				"resourceId": request.ResourceID,
+			})
+			setResponse(http.StatusCreated, true, constants.Messages.Frontend.Success["ResourceSent"])
+			respond(c, response.HttpCode, response.Message, response, constants.URLs.SuccessPages.Resource)
+			return
+		}
+		defer func() {
+			if !response.Success {
+				services.ReleaseResourceRequest(request.Email, request.ResourceID)
+			}
+		}()
+	}
+
 	// Process tags
 	var tags []string
 	if len(request.Tags) > 0 {
@@ -57,55 +77,53 @@ func LeadMagnetHandler(c *gin.Context) {
 		"tags":       tags,
 	})
 
-	result, err := services.ProcessSubscription(request.Email, string(models.SubscriptionSourceLeadMagnet), tags)
+	// Lead magnet signups are attributed to the lead magnet unless the form says otherwise
+	if request.UtmSource == "" {
+		request.UtmSource = string(models.SubscriptionSourceLeadMagnet)
+	}
+
+	// Keep proof of the opt-in before adding the email to the newsletter
+	if _, err := services.RecordConsent(request.Email, models.SubscriptionSourceLeadMagnet, c.ClientIP(), c.Request.UserAgent()); err != nil {
+		setResponse(http.StatusInternalServerError, false, constants.Messages.Frontend.Errors["ServerError"])
+		respond(c, response.HttpCode, response.Message, response, "")
+		return
+	}
+
+	// The request is recorded in the outbox and its steps run right away: the subscription, its
+	// tags, the resource email and the notification either all complete, or the completed ones
+	// are undone. Steps that must be retried, for instance while the provider is unreachable,
+	// run in the background and the request is accepted as queued.
+	resource := &models.ResourceEmailJobPayload{ResourceID: request.ResourceID, FileID: request.FileID}
+	entry, err := services.SubmitSubscription(models.FormActor("lead-magnet"), request.Email, request.Attribution, tags, resource)
 	if err != nil {
 		logger.LogFunction("error", constants.Messages.Backend.Error["SubscriptionError"], err.Error())
 		setResponse(http.StatusInternalServerError, false, constants.Messages.Frontend.Errors["ServerError"])
-		c.String(response.HttpCode, response.Message)
+		respond(c, response.HttpCode, response.Message, response, "")
 		return
 	}
-
-	// Handle subscription result
-	if result.AlreadySubscribed {
-		// Schedule resource email for existing subscriber
-		logger.LogFunction("info", constants.Messages.Backend.Info["SubscriberExists"], map[string]string{
-			"email":        request.Email,
-			"subscriberId": result.SubscriberID,
+	response.RequestID = entry.ID
+
+	switch entry.Status {
+	case models.OutboxPending:
+		setResponse(http.StatusAccepted, true, constants.Messages.Frontend.Success["ResourceQueued"])
+		response.Queued = true
+		respond(c, response.HttpCode, response.Message, response, constants.URLs.SuccessPages.Resource)
+
+	case models.OutboxFailed:
+		logger.LogFunction("error", constants.Messages.Backend.Error["SubscriptionError"], map[string]interface{}{
+			"email":   request.Email,
+			"request": entry.ID,
+			"steps":   entry.Steps,
 		})
+		setResponse(http.StatusInternalServerError, false, constants.Messages.Frontend.Errors["ServerError"])
+		respond(c, response.HttpCode, response.Message, response, "")
 
-		err := services.ScheduleResourceEmail(models.ResourceEmailScheduleOptions{
-			Email:        request.Email,
-			ResourceID:   request.ResourceID,
-			FileID:       request.FileID,
-			DelayMinutes: 1,
-		})
-
-		if err != nil {
-			logger.LogFunction("error", constants.Messages.Backend.Error["ServerError"], err.Error())
-			setResponse(http.StatusInternalServerError, false, constants.Messages.Frontend.Errors["ServerError"])
-			c.String(response.HttpCode, response.Message)
-			return
-		}
-
-		logger.LogFunction("info", constants.Messages.Backend.Info["DelayedEmailScheduled"], map[string]string{
+	default:
+		logger.LogFunction("info", constants.Messages.Backend.Info["ResourceSent"], map[string]string{
 			"email":      request.Email,
 			"resourceId": request.ResourceID,
 		})
-	} else {
-		// For new subscribers, resource email is handled within ProcessSubscription
-		logger.LogFunction("info", constants.Messages.Backend.Info["NewSubscriber"], map[string]string{
-			"email":        request.Email,
-			"subscriberId": result.SubscriberID,
-		})
+		setResponse(http.StatusCreated, true, constants.Messages.Frontend.Success["ResourceSent"])
+		respond(c, response.HttpCode, response.Message, response, constants.URLs.SuccessPages.Resource)
 	}
-
-	// Success response
-	logger.LogFunction("info", constants.Messages.Backend.Info["ResourceSent"], map[string]string{
-		"email":      request.Email,
-		"resourceId": request.ResourceID,
-	})
-
-	setResponse(http.StatusCreated, true, constants.Messages.Frontend.Success["ResourceSent"])
-	c.Header("HX-Redirect", constants.URLs.SuccessPages.Resource)
-	c.String(response.HttpCode, response.Message)
 }
@@ -1,9 +1,40 @@
 package api
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/pkg/config"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+const (
+	// AdminActorKey es la clave del contexto con la identidad del administrador autenticado
+	AdminActorKey = "adminActor"
+	// IdempotencyKeyContext es la clave del contexto con la clave de idempotencia de la solicitud
+	IdempotencyKeyContext = "idempotencyKey"
+
+	// IdempotencyHeader es la cabecera con la clave de idempotencia que envían los clientes
+	IdempotencyHeader = "Idempotency-Key"
+	// idempotencyField es el campo oculto de formulario alternativo a la cabecera
+	idempotencyField = "idempotency_key"
+	// maxIdempotencyKeyLength limita la longitud de las claves de idempotencia aceptadas
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBodyBytes limita el cuerpo que se lee en memoria para calcular su huella
+	maxIdempotentBodyBytes = 1 << 20
 )
 
 // CorsMiddleware configura CORS para la API
@@ -17,11 +48,11 @@ func CorsMiddleware() gin.HandlerFunc {
 		// Allow all HTMX headers and other common headers
 		c.Writer.Header().Set("Access-Control-Allow-Headers",
 			"Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, "+
-				"HX-Request, HX-Trigger, HX-Trigger-Name, HX-Target, HX-Current-URL, HX-Boost")
+				"HX-Request, HX-Trigger, HX-Trigger-Name, HX-Target, HX-Current-URL, HX-Boost, Idempotency-Key")
 
 		// Expose HTMX-specific response headers
 		c.Writer.Header().Set("Access-Control-Expose-Headers",
-			"HX-Redirect, HX-Trigger, HX-Refresh, HX-Location")
+			"HX-Redirect, HX-Trigger, HX-Refresh, HX-Location, Retry-After, Idempotent-Replayed")
 
 		// Allow credentials
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
@@ -34,3 +65,276 @@ func CorsMiddleware() gin.HandlerFunc {
 
 	}
 }
+
+// RateLimitMiddleware limita el número de solicitudes por IP de cliente dentro de una ventana fija
+func RateLimitMiddleware(limit int, window time.Duration) gin.HandlerFunc {
+	type counter struct {
+		count   int
+		resetAt time.Time
+	}
+
+	var mu sync.Mutex
+	clients := make(map[string]*counter)
+
+	return func(c *gin.Context) {
+		now := time.Now()
+		ip := c.ClientIP()
+
+		mu.Lock()
+		// Drop expired windows so the map does not grow without bound
+		for key, entry := range clients {
+			if now.After(entry.resetAt) {
+				delete(clients, key)
+			}
+		}
+
+		entry, ok := clients[ip]
+		if !ok {
+			entry = &counter{resetAt: now.Add(window)}
+			clients[ip] = entry
+		}
+		entry.count++
+		exceeded := entry.count > limit
+		retryAfter := int(entry.resetAt.Sub(now).Seconds()) + 1
+		mu.Unlock()
+
+		if exceeded {
+			logger.LogFunction("warn", constants.Messages.Backend.Warn["RateLimited"], map[string]string{
+				"ip":   ip,
+				"path": c.FullPath(),
+			})
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			message := constants.Messages.Frontend.Errors["TooManyRequests"]
+			respond(c, http.StatusTooManyRequests, message, models.ErrorResponse{
+				HttpCode: http.StatusTooManyRequests,
+				Success:  false,
+				Message:  message,
+			}, "")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// idempotentResponse es la respuesta guardada para una clave de idempotencia. done se cierra
+// cuando la primera solicitud termina; a partir de ahí los demás campos no cambian.
+type idempotentResponse struct {
+	fingerprint string
+	done        chan struct{}
+	stored      bool
+	status      int
+	header      http.Header
+	body        []byte
+	expiresAt   time.Time
+}
+
+// recordingWriter copia el cuerpo de la respuesta mientras se escribe al cliente
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware guarda durante ttl las respuestas correctas de las solicitudes con
+// clave de idempotencia, en la cabecera Idempotency-Key o en el campo idempotency_key, y las
+// repite ante solicitudes con la misma clave y ruta sin volver a ejecutar el handler. Las
+// repeticiones que llegan mientras la primera sigue en curso esperan a su resultado. Los
+// errores no se guardan, para que el cliente pueda corregir los datos y reintentar.
+func IdempotencyMiddleware(ttl time.Duration) gin.HandlerFunc {
+	var mu sync.Mutex
+	responses := make(map[string]*idempotentResponse)
+
+	return func(c *gin.Context) {
+		// Read the body once to fingerprint it, and put it back for the handler
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentBodyBytes))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.AbortWithStatus(http.StatusRequestEntityTooLarge)
+				return
+			}
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		key := c.GetHeader(IdempotencyHeader)
+		if key == "" {
+			key = bodyIdempotencyKey(c, body)
+		}
+		if key == "" || len(key) > maxIdempotencyKeyLength {
+			c.Next()
+			return
+		}
+		c.Set(IdempotencyKeyContext, key)
+
+		sum := sha256.Sum256(append([]byte(c.ContentType()+"\n"), body...))
+		fingerprint := hex.EncodeToString(sum[:])
+		cacheKey := c.FullPath() + "|" + key
+
+		for {
+			now := time.Now()
+			mu.Lock()
+			// Drop expired responses so the map does not grow without bound
+			for k, entry := range responses {
+				if entry.stored && now.After(entry.expiresAt) {
+					delete(responses, k)
+				}
+			}
+			entry, found := responses[cacheKey]
+			if !found {
+				entry = &idempotentResponse{fingerprint: fingerprint, done: make(chan struct{})}
+				responses[cacheKey] = entry
+			}
+			mu.Unlock()
+
+			if !found {
+				recorder := &recordingWriter{ResponseWriter: c.Writer}
+				c.Writer = recorder
+				// Deferred so that requests waiting on this one are released even after a panic
+				defer func() {
+					mu.Lock()
+					if status := recorder.Status(); recorder.Written() && status >= 200 && status < 300 {
+						entry.status = status
+						entry.header = recorder.Header().Clone()
+						entry.body = recorder.body.Bytes()
+						entry.expiresAt = time.Now().Add(ttl)
+						entry.stored = true
+					} else {
+						delete(responses, cacheKey)
+					}
+					mu.Unlock()
+					close(entry.done)
+				}()
+				c.Next()
+				return
+			}
+
+			if entry.fingerprint != fingerprint {
+				logger.LogFunction("warn", constants.Messages.Backend.Warn["IdempotencyConflict"], map[string]string{
+					"path": c.FullPath(),
+					"key":  key,
+				})
+				message := constants.Messages.Frontend.Errors["IdempotencyConflict"]
+				respond(c, http.StatusUnprocessableEntity, message, models.ErrorResponse{
+					HttpCode: http.StatusUnprocessableEntity,
+					Success:  false,
+					Message:  message,
+				}, "")
+				c.Abort()
+				return
+			}
+
+			select {
+			case <-entry.done:
+			case <-c.Request.Context().Done():
+				c.Abort()
+				return
+			}
+
+			// The first request failed and was forgotten: this one runs in its place
+			if !entry.stored {
+				continue
+			}
+
+			logger.LogFunction("info", constants.Messages.Backend.Info["IdempotentReplay"], map[string]string{
+				"path": c.FullPath(),
+				"key":  key,
+			})
+			for name, values := range entry.header {
+				c.Writer.Header()[name] = values
+			}
+			c.Header("Idempotent-Replayed", "true")
+			c.Writer.WriteHeader(entry.status)
+			c.Writer.Write(entry.body)
+			c.Abort()
+			return
+		}
+	}
+}
+
+// bodyIdempotencyKey lee la clave de idempotencia del campo idempotency_key del cuerpo, que
+// los formularios envían codificado en JSON o como formulario
+func bodyIdempotencyKey(c *gin.Context, body []byte) string {
+	if c.ContentType() == gin.MIMEJSON {
+		var fields struct {
+			IdempotencyKey string `json:"idempotency_key"`
+		}
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return ""
+		}
+		return fields.IdempotencyKey
+	}
+
+	key := c.PostForm(idempotencyField)
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return key
+}
+
+// secureCompare compara dos secretos en tiempo constante, también cuando sus longitudes difieren
+func secureCompare(given, expected string) bool {
+	givenSum := sha256.Sum256([]byte(given))
+	expectedSum := sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(givenSum[:], expectedSum[:]) == 1
+}
+
+// AdminAuthMiddleware exige una API key de administración como bearer token o las credenciales
+// de basic auth configuradas. Sin credenciales configuradas rechaza todas las solicitudes.
+func AdminAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conf, err := config.GetConfig()
+		if err != nil {
+			logger.LogFunction("error", constants.Messages.Backend.Error["ServerError"], err.Error())
+			c.AbortWithStatusJSON(http.StatusInternalServerError, models.ErrorResponse{
+				HttpCode: http.StatusInternalServerError,
+				Message:  constants.Messages.Frontend.Errors["ServerError"],
+			})
+			return
+		}
+
+		actor := ""
+		authorization := c.GetHeader("Authorization")
+		if token, found := strings.CutPrefix(authorization, "Bearer "); found {
+			// Check every key so the time taken does not reveal which one matched
+			for _, key := range conf.Admin.APIKeys {
+				if secureCompare(token, key) {
+					fingerprint := sha256.Sum256([]byte(key))
+					actor = "key:" + hex.EncodeToString(fingerprint[:4])
+				}
+			}
+		} else if user, password, ok := c.Request.BasicAuth(); ok && conf.Admin.User != "" {
+			userMatches := secureCompare(user, conf.Admin.User)
+			passwordMatches := secureCompare(password, conf.Admin.Password)
+			if userMatches && passwordMatches {
+				actor = "basic:" + conf.Admin.User
+			}
+		}
+
+		if actor == "" {
+			logger.LogFunction("warn", constants.Messages.Backend.Warn["AdminAuthFailed"], map[string]string{
+				"ip":   c.ClientIP(),
+				"path": c.FullPath(),
+			})
+			c.Header("WWW-Authenticate", `Basic realm="admin", charset="UTF-8"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
+				HttpCode: http.StatusUnauthorized,
+				Message:  constants.Messages.Frontend.Errors["Unauthorized"],
+			})
+			return
+		}
+
+		c.Set(AdminActorKey, actor)
+		c.Next()
+	}
+}
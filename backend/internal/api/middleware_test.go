@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// idempotentRouter serves a handler behind the idempotency middleware and counts its runs
+func idempotentRouter(runs *int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/subscribe", IdempotencyMiddleware(time.Hour), func(c *gin.Context) {
+		*runs++
+		var request struct {
+			Email string `json:"email"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"email": request.Email})
+	})
+	return r
+}
+
+func TestIdempotencyKeyFromJSONBodyReplaysResponse(t *testing.T) {
+	runs := 0
+	r := idempotentRouter(&runs)
+	body := `{"email":"ana@example.com","idempotency_key":"form-render-1"}`
+
+	var responses []*httptest.ResponseRecorder
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/subscribe", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		responses = append(responses, w)
+	}
+
+	if runs != 1 {
+		t.Fatalf("handler ran %d times, want 1", runs)
+	}
+	first, replay := responses[0], responses[1]
+	if first.Code != http.StatusCreated || !strings.Contains(first.Body.String(), "ana@example.com") {
+		t.Fatalf("first request answered %d %s, want 201 with the bound email", first.Code, first.Body)
+	}
+	if replay.Code != http.StatusCreated || replay.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry answered %d with Idempotent-Replayed %q, want a replayed 201", replay.Code, replay.Header().Get("Idempotent-Replayed"))
+	}
+	if replay.Body.String() != first.Body.String() {
+		t.Errorf("retry body %s, want %s", replay.Body, first.Body)
+	}
+}
+
+func TestIdempotencyMiddlewareRejectsOversizedBody(t *testing.T) {
+	runs := 0
+	r := idempotentRouter(&runs)
+	body := `{"email":"` + strings.Repeat("a", maxIdempotentBodyBytes) + `@example.com"}`
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/subscribe", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body answered %d, want 413", w.Code)
+	}
+	if runs != 0 {
+		t.Errorf("handler ran %d times for an oversized body, want 0", runs)
+	}
+}
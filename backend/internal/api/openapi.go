@@ -0,0 +1,108 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// APIVersionPrefix is the base path of the current public API version
+	APIVersionPrefix = "/api/v1"
+	// WebhooksPrefix is the base path of the inbound provider webhooks
+	WebhooksPrefix = "/webhooks"
+)
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// OpenAPIHandler serves the OpenAPI 3 document of the public API
+func OpenAPIHandler(c *gin.Context) {
+	c.Data(http.StatusOK, gin.MIMEJSON+"; charset=utf-8", openAPISpec)
+}
+
+// openAPIOperations returns the "METHOD /path" pairs declared in the OpenAPI document. Paths
+// are relative to the versioned API, except those declaring their own server, which are
+// returned with the server URL in front.
+func openAPIOperations() ([]string, error) {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		return nil, err
+	}
+
+	var operations []string
+	for path, item := range spec.Paths {
+		if raw, ok := item["servers"]; ok {
+			var servers []struct {
+				URL string `json:"url"`
+			}
+			if err := json.Unmarshal(raw, &servers); err != nil || len(servers) == 0 {
+				return nil, fmt.Errorf("invalid servers of path %s", path)
+			}
+			path = servers[0].URL + path
+		}
+		for method := range item {
+			if method == "servers" {
+				continue
+			}
+			operations = append(operations, strings.ToUpper(method)+" "+path)
+		}
+	}
+	sort.Strings(operations)
+	return operations, nil
+}
+
+// CheckOpenAPISpec compares the routes registered under the versioned API group and the
+// webhooks with the operations declared in the OpenAPI document and describes every
+// mismatch found
+func CheckOpenAPISpec(routes gin.RoutesInfo) []string {
+	declared, err := openAPIOperations()
+	if err != nil {
+		return []string{fmt.Sprintf("invalid OpenAPI document: %v", err)}
+	}
+
+	registered := map[string]bool{}
+	for _, route := range routes {
+		switch {
+		case strings.HasPrefix(route.Path, APIVersionPrefix+"/"):
+			path := strings.TrimPrefix(route.Path, APIVersionPrefix)
+			registered[route.Method+" "+ginPathToOpenAPI(path)] = true
+		case strings.HasPrefix(route.Path, WebhooksPrefix+"/"):
+			registered[route.Method+" "+ginPathToOpenAPI(route.Path)] = true
+		}
+	}
+
+	var mismatches []string
+	documented := map[string]bool{}
+	for _, operation := range declared {
+		documented[operation] = true
+		if !registered[operation] {
+			mismatches = append(mismatches, "documented but not registered: "+operation)
+		}
+	}
+	for operation := range registered {
+		if !documented[operation] {
+			mismatches = append(mismatches, "registered but not documented: "+operation)
+		}
+	}
+	sort.Strings(mismatches)
+	return mismatches
+}
+
+// ginPathToOpenAPI converts gin path parameters (":id", "*path") to OpenAPI templates ("{id}")
+func ginPathToOpenAPI(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
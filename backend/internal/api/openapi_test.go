@@ -0,0 +1,31 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOpenAPISpecMatchesRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	SetupRoutes(r)
+
+	for _, mismatch := range CheckOpenAPISpec(r.Routes()) {
+		t.Error(mismatch)
+	}
+}
+
+func TestGinPathToOpenAPI(t *testing.T) {
+	cases := map[string]string{
+		"/subscribe":                    "/subscribe",
+		"/bookings/:id":                 "/bookings/{id}",
+		"/files/*path":                  "/files/{path}",
+		"/subscribers/:email/tags/:tag": "/subscribers/{email}/tags/{tag}",
+	}
+	for path, want := range cases {
+		if got := ginPathToOpenAPI(path); got != want {
+			t.Errorf("ginPathToOpenAPI(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/internal/services"
+	"github.com/mlorentedev/mlorente-backend/internal/validation"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+// PreferencesHandler shows the topics and pause state of the subscriber identified by the
+// signed "token" query parameter
+func PreferencesHandler(c *gin.Context) {
+	var response models.PreferencesResult
+
+	email, ok := verifySignedToken(c, c.Query("token"), services.LinkPurposePreferences)
+	if !ok {
+		return
+	}
+
+	preferences, err := services.GetPreferences(email)
+	if err != nil {
+		response.HttpCode, response.Message = preferencesErrorResponse(err)
+		respond(c, response.HttpCode, response.Message, response, "")
+		return
+	}
+
+	response.HttpCode = http.StatusOK
+	response.Success = true
+	response.Message = constants.Messages.Frontend.Success["PreferencesLoaded"]
+	response.Preferences = preferences
+	respond(c, response.HttpCode, describePreferences(response.Message, preferences), response, "")
+}
+
+// UpdatePreferencesHandler updates the topic tags of a subscriber and pauses or resumes their subscription
+func UpdatePreferencesHandler(c *gin.Context) {
+	var request models.PreferencesRequest
+	var response models.PreferencesResult
+
+	// Bind form data
+	if err := c.ShouldBind(&request); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["IncompleteData"], err.Error())
+		respondValidationErrors(c, validation.BindingErrors(err))
+		return
+	}
+
+	// Normalize and validate request fields
+	if errs := validation.ValidatePreferencesRequest(&request, services.NewsletterTopics()); len(errs) > 0 {
+		logger.LogFunction("error", constants.Messages.Backend.Error["ValidationError"], errs)
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	email, ok := verifySignedToken(c, request.Token, services.LinkPurposePreferences)
+	if !ok {
+		return
+	}
+
+	preferences, err := services.UpdatePreferences(models.FormActor("preferences"), email, request.Topics, request.PauseWeeks, request.Resume)
+	if err != nil {
+		response.HttpCode, response.Message = preferencesErrorResponse(err)
+		respond(c, response.HttpCode, response.Message, response, "")
+		return
+	}
+
+	response.HttpCode = http.StatusOK
+	response.Success = true
+	response.Message = constants.Messages.Frontend.Success["PreferencesUpdated"]
+	response.Preferences = preferences
+	respond(c, response.HttpCode, describePreferences(response.Message, preferences), response, "")
+}
+
+// PreferencesLinkHandler emails the preference center link to a subscriber. The response is
+// the same whether or not the email is subscribed.
+func PreferencesLinkHandler(c *gin.Context) {
+	var request models.PreferencesLinkRequest
+	var response models.PreferencesResult
+
+	// Bind form data
+	if err := c.ShouldBind(&request); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["IncompleteData"], err.Error())
+		respondValidationErrors(c, validation.BindingErrors(err))
+		return
+	}
+
+	// Normalize and validate request fields
+	if errs := validation.ValidatePreferencesLinkRequest(&request); len(errs) > 0 {
+		logger.LogFunction("error", constants.Messages.Backend.Error["ValidationError"], errs)
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	if err := services.SendPreferencesLink(request.Email); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["PreferencesError"], err.Error())
+		response.HttpCode = http.StatusInternalServerError
+		response.Message = constants.Messages.Frontend.Errors["ServerError"]
+		respond(c, response.HttpCode, response.Message, response, "")
+		return
+	}
+
+	response.HttpCode = http.StatusOK
+	response.Success = true
+	response.Message = constants.Messages.Frontend.Success["PreferencesLinkSent"]
+	respond(c, response.HttpCode, response.Message, response, "")
+}
+
+// verifySignedToken returns the email a signed link token was issued for,
+// writing the error response itself when the token is not valid for the purpose
+func verifySignedToken(c *gin.Context, token, purpose string) (string, bool) {
+	email, err := services.VerifyEmailToken(strings.TrimSpace(token), purpose)
+	if err == nil {
+		return email, true
+	}
+
+	response := models.ErrorResponse{HttpCode: http.StatusUnauthorized}
+	if errors.Is(err, services.ErrSignedLinksDisabled) {
+		logger.LogFunction("error", constants.Messages.Backend.Error["ServerError"], err.Error())
+		response.HttpCode = http.StatusServiceUnavailable
+		response.Message = constants.Messages.Frontend.Errors["ServerError"]
+	} else {
+		logger.LogFunction("warn", constants.Messages.Backend.Warn["InvalidToken"], err.Error())
+		response.Message = constants.Messages.Frontend.Errors["InvalidToken"]
+	}
+	respond(c, response.HttpCode, response.Message, response, "")
+	return "", false
+}
+
+// preferencesErrorResponse maps preference service errors to an HTTP status and a frontend message
+func preferencesErrorResponse(err error) (int, string) {
+	if errors.Is(err, services.ErrNotSubscribed) {
+		logger.LogFunction("info", constants.Messages.Backend.Info["SubscriberNotFound"], err.Error())
+		return http.StatusNotFound, constants.Messages.Frontend.Errors["EmailNotSubscribed"]
+	}
+	logger.LogFunction("error", constants.Messages.Backend.Error["PreferencesError"], err.Error())
+	return http.StatusInternalServerError, constants.Messages.Frontend.Errors["TagsUpdateError"]
+}
+
+// describePreferences renders the preferences as text for non-JSON clients
+func describePreferences(message string, preferences *models.Preferences) string {
+	var topics []string
+	for _, topic := range preferences.Topics {
+		if topic.Subscribed {
+			topics = append(topics, topic.Topic)
+		}
+	}
+
+	message += ": " + strings.Join(topics, ", ")
+	if preferences.PausedUntil != nil {
+		message += " (pausa hasta " + preferences.PausedUntil.Format("02/01/2006") + ")"
+	}
+	return message
+}
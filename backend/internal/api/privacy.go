@@ -0,0 +1,104 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/internal/services"
+	"github.com/mlorentedev/mlorente-backend/internal/validation"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+// PrivacyLinkHandler emails the signed link that confirms a data export or erasure request
+func PrivacyLinkHandler(c *gin.Context) {
+	var request models.PrivacyLinkRequest
+	var response models.PrivacyResult
+
+	// Bind form data
+	if err := c.ShouldBind(&request); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["IncompleteData"], err.Error())
+		respondValidationErrors(c, validation.BindingErrors(err))
+		return
+	}
+
+	// Normalize and validate request fields
+	if errs := validation.ValidatePrivacyLinkRequest(&request); len(errs) > 0 {
+		logger.LogFunction("error", constants.Messages.Backend.Error["ValidationError"], errs)
+		respondValidationErrors(c, errs)
+		return
+	}
+
+	if err := services.SendPrivacyLink(request.Email, request.Action); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["PrivacyError"], err.Error())
+		response.HttpCode = http.StatusInternalServerError
+		response.Message = constants.Messages.Frontend.Errors["ServerError"]
+		respond(c, response.HttpCode, response.Message, response, "")
+		return
+	}
+
+	response.HttpCode = http.StatusOK
+	response.Success = true
+	response.Message = constants.Messages.Frontend.Success["PrivacyLinkSent"]
+	respond(c, response.HttpCode, response.Message, response, "")
+}
+
+// DataExportHandler returns, as a downloadable JSON document, everything stored about the
+// email identified by the signed "token" query parameter
+func DataExportHandler(c *gin.Context) {
+	var response models.PrivacyResult
+
+	email, ok := verifySignedToken(c, c.Query("token"), services.LinkPurposeDataExport)
+	if !ok {
+		return
+	}
+
+	export, err := services.ExportData(email)
+	if err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["PrivacyError"], err.Error())
+		response.HttpCode = http.StatusInternalServerError
+		response.Message = constants.Messages.Frontend.Errors["ServerError"]
+		respond(c, response.HttpCode, response.Message, response, "")
+		return
+	}
+
+	// The export is always JSON, whatever the client negotiates
+	filename := "datos-" + export.GeneratedAt.Format(time.DateOnly) + ".json"
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, export)
+}
+
+// DataErasureHandler deletes the subscription and every local record of the email
+// identified by the signed token
+func DataErasureHandler(c *gin.Context) {
+	var request models.PrivacyEraseRequest
+	var response models.PrivacyResult
+
+	// Bind form data
+	if err := c.ShouldBind(&request); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["IncompleteData"], err.Error())
+		respondValidationErrors(c, validation.BindingErrors(err))
+		return
+	}
+
+	email, ok := verifySignedToken(c, request.Token, services.LinkPurposeDataErasure)
+	if !ok {
+		return
+	}
+
+	if _, err := services.EraseData(models.FormActor("privacy"), email); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["PrivacyError"], err.Error())
+		response.HttpCode = http.StatusInternalServerError
+		response.Message = constants.Messages.Frontend.Errors["ServerError"]
+		respond(c, response.HttpCode, response.Message, response, "")
+		return
+	}
+
+	response.HttpCode = http.StatusOK
+	response.Success = true
+	response.Message = constants.Messages.Frontend.Success["DataErased"]
+	respond(c, response.HttpCode, response.Message, response, "")
+}
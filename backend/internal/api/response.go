@@ -0,0 +1,66 @@
+package api
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+)
+
+// wantsJSON reports whether the client asked for a JSON representation
+func wantsJSON(c *gin.Context) bool {
+	return strings.Contains(c.GetHeader("Accept"), gin.MIMEJSON)
+}
+
+// isHTMXRequest reports whether the request was issued by HTMX
+func isHTMXRequest(c *gin.Context) bool {
+	return c.GetHeader("HX-Request") == "true"
+}
+
+// respond writes a handler result in the representation negotiated with the client:
+// the structured result as JSON for API clients, an HTML fragment for HTMX requests
+// and plain text otherwise. The HX-Redirect header is only set for non-JSON clients.
+func respond(c *gin.Context, httpCode int, message string, result interface{}, redirect string) {
+	c.Header("Vary", "Accept, HX-Request")
+
+	if wantsJSON(c) {
+		c.JSON(httpCode, result)
+		return
+	}
+
+	if redirect != "" {
+		c.Header("HX-Redirect", redirect)
+	}
+
+	if isHTMXRequest(c) {
+		status := "success"
+		if httpCode >= 400 {
+			status = "error"
+		}
+		fragment := fmt.Sprintf(`<p class="status-message %s">%s</p>`, status, html.EscapeString(message))
+		c.Data(httpCode, gin.MIMEHTML+"; charset=utf-8", []byte(fragment))
+		return
+	}
+
+	c.String(httpCode, message)
+}
+
+// respondValidationErrors writes field-level validation errors using the common error envelope
+func respondValidationErrors(c *gin.Context, errs []models.FieldError) {
+	messages := make([]string, 0, len(errs))
+	for _, fe := range errs {
+		messages = append(messages, fe.Message)
+	}
+
+	response := models.ErrorResponse{
+		HttpCode: http.StatusBadRequest,
+		Success:  false,
+		Message:  constants.Messages.Frontend.Errors["ValidationError"],
+		Errors:   errs,
+	}
+	respond(c, response.HttpCode, strings.Join(messages, ". "), response, "")
+}
@@ -1,26 +1,127 @@
 package api
 
 import (
+	"time"
+
 	"github.com/gin-gonic/gin"
 )
 
+// contactLimiter limita los mensajes de contacto por IP. Se comparte entre
+// la ruta versionada y su alias para que el límite no se duplique.
+var contactLimiter = RateLimitMiddleware(5, time.Hour)
+
+// bookingLimiter limita las reservas provisionales y confirmaciones por IP
+var bookingLimiter = RateLimitMiddleware(10, time.Hour)
+
+// preferencesLinkLimiter limita las solicitudes del enlace de preferencias por IP
+var preferencesLinkLimiter = RateLimitMiddleware(5, time.Hour)
+
+// privacyLinkLimiter limita las solicitudes de exportación y borrado de datos por IP
+var privacyLinkLimiter = RateLimitMiddleware(5, time.Hour)
+
+// idempotent repite durante un día la respuesta de las solicitudes con clave de idempotencia
+var idempotent = IdempotencyMiddleware(24 * time.Hour)
+
 // SetupRoutes configura todas las rutas de la API
 func SetupRoutes(r *gin.Engine) {
 
 	// Health check routes
 	RegisterHealthCheckRoutes(r)
 
-	// Grupo API
-	api := r.Group("/api")
-	{
-		// Suscripción
-		api.POST("/subscribe", SubscribeHandler)
+	// Grupo API versionado
+	registerPublicAPIRoutes(r.Group(APIVersionPrefix))
+
+	// Alias sin versión de la versión actual
+	registerPublicAPIRoutes(r.Group("/api"))
+
+	// API de administración autenticada
+	registerAdminRoutes(r.Group("/admin/api", AdminAuthMiddleware()))
+
+	// Webhooks entrantes de proveedores, autenticados por firma
+	r.POST(WebhooksPrefix+"/beehiiv", BeehiivWebhookHandler)
+}
+
+// registerPublicAPIRoutes registra las rutas públicas en el grupo indicado
+func registerPublicAPIRoutes(api *gin.RouterGroup) {
+	// Suscripción
+	api.POST("/subscribe", idempotent, SubscribeHandler)
+
+	// Cancelación de suscripción
+	api.POST("/unsubscribe", UnsubscribeHandler)
+	api.POST("/unsubscribe/one-click", OneClickUnsubscribeHandler)
+
+	// Lead magnet
+	api.POST("/lead-magnet", idempotent, LeadMagnetHandler)
+
+	// Contacto
+	api.POST("/contact", contactLimiter, idempotent, ContactHandler)
+
+	// Reservas
+	api.GET("/booking/slots", BookingSlotsHandler)
+	api.POST("/booking/holds", bookingLimiter, BookingHoldHandler)
+	api.POST("/booking", bookingLimiter, idempotent, BookingHandler)
+
+	// Centro de preferencias
+	api.GET("/preferences", PreferencesHandler)
+	api.POST("/preferences", UpdatePreferencesHandler)
+	api.POST("/preferences/link", preferencesLinkLimiter, PreferencesLinkHandler)
+
+	// Derechos sobre los datos personales (RGPD)
+	api.POST("/privacy/link", privacyLinkLimiter, PrivacyLinkHandler)
+	api.GET("/privacy/export", DataExportHandler)
+	api.POST("/privacy/erase", DataErasureHandler)
+
+	// Salud del servicio
+	api.GET("/health", HealthCheckHandler)
+
+	// Especificación OpenAPI
+	api.GET("/openapi.json", OpenAPIHandler)
+}
+
+// registerAdminRoutes registra las rutas de administración en el grupo indicado
+func registerAdminRoutes(admin *gin.RouterGroup) {
+	// Suscriptores
+	admin.GET("/subscribers/:email", AdminGetSubscriberHandler)
+	admin.POST("/subscribers/:email/tags", AdminAddTagsHandler)
+	admin.DELETE("/subscribers/:email/tags/:tag", AdminRemoveTagHandler)
+
+	// Recursos
+	admin.POST("/resources/send", AdminSendResourceHandler)
+
+	// Tareas programadas
+	admin.GET("/jobs", AdminListJobsHandler)
+	admin.POST("/jobs/:id/retry", AdminRetryJobHandler)
+
+	// Errores recientes
+	admin.GET("/errors", AdminRecentErrorsHandler)
+
+	// Registro de consentimientos
+	admin.GET("/consents", AdminConsentsHandler)
+
+	// Registro de auditoría
+	admin.GET("/audit", AdminAuditHandler)
+
+	// Importación y exportación masiva de suscriptores
+	admin.POST("/imports", AdminImportHandler)
+	admin.GET("/imports/:id", AdminGetImportHandler)
+	admin.GET("/exports/subscribers", AdminExportHandler)
+
+	// Réplica local de suscriptores
+	admin.GET("/mirror", AdminMirrorStatusHandler)
+	admin.POST("/mirror/reconcile", AdminReconcileMirrorHandler)
+
+	// Notificaciones salientes no entregadas
+	admin.GET("/dead-letters", AdminDeadLettersHandler)
+	admin.POST("/dead-letters/:id/redeliver", AdminRedeliverHandler)
 
-		// Cancelación de suscripción
-		api.POST("/unsubscribe", UnsubscribeHandler)
+	// Divergencias con los proveedores secundarios de la newsletter
+	admin.GET("/divergences", AdminDivergencesHandler)
 
-		// Lead magnet
-		api.POST("/lead-magnet", LeadMagnetHandler)
+	// Estado de las APIs de los proveedores y solicitudes de suscripción con sus pasos
+	admin.GET("/metrics", AdminMetricsHandler)
+	admin.GET("/outbox", AdminOutboxHandler)
+	admin.GET("/outbox/:id", AdminGetOutboxEntryHandler)
 
-	}
+	// Secuencias de seguimiento de los lead magnets
+	admin.GET("/drips", AdminDripsHandler)
 }
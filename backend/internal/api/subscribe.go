@@ -7,6 +7,7 @@ import (
 	"github.com/mlorentedev/mlorente-backend/internal/constants"
 	"github.com/mlorentedev/mlorente-backend/internal/models"
 	"github.com/mlorentedev/mlorente-backend/internal/services"
+	"github.com/mlorentedev/mlorente-backend/internal/validation"
 	"github.com/mlorentedev/mlorente-backend/pkg/logger"
 )
 
@@ -27,16 +28,17 @@ func SubscribeHandler(c *gin.Context) {
 	// Bind form data
 	if err := c.ShouldBind(&request); err != nil {
 		logger.LogFunction("error", constants.Messages.Backend.Error["IncompleteData"], err.Error())
-		setResponse(http.StatusBadRequest, false, constants.Messages.Frontend.Errors["IncompleteData"], false, "")
-		c.String(response.HttpCode, response.Message)
+		respondValidationErrors(c, validation.BindingErrors(err))
 		return
 	}
 
-	// Validate email format
-	if request.Email == "" || !services.IsValidEmailFormat(request.Email) {
-		logger.LogFunction("error", constants.Messages.Backend.Error["InvalidEmail"], request.Email)
-		setResponse(http.StatusBadRequest, false, constants.Messages.Frontend.Errors["InvalidEmail"], false, "")
-		c.String(response.HttpCode, response.Message)
+	// Complete attribution from the query string and the HTMX page
+	captureAttribution(c, &request.Attribution)
+
+	// Normalize and validate request fields
+	if errs := validation.ValidateSubscriptionRequest(&request, services.AllowedTags()); len(errs) > 0 {
+		logger.LogFunction("error", constants.Messages.Backend.Error["ValidationError"], errs)
+		respondValidationErrors(c, errs)
 		return
 	}
 
@@ -49,22 +51,23 @@ func SubscribeHandler(c *gin.Context) {
 		})
 	}
 
-	// Check if the subscriber already exists
+	// Check if the subscriber already exists. When the provider is unreachable the question
+	// stays open until the subscription is replayed from the outbox.
 	existingSubscriber, err := services.CheckSubscriber(request.Email)
-	if err != nil {
+	if err != nil && !services.IsProviderUnavailable(err) {
 		logger.LogFunction("error", constants.Messages.Backend.Error["CheckSubscriberError"], err.Error())
 		setResponse(http.StatusInternalServerError, false, constants.Messages.Frontend.Errors["ServerError"], false, "")
-		c.String(response.HttpCode, response.Message)
+		respond(c, response.HttpCode, response.Message, response, "")
 		return
 	}
 
-	if existingSubscriber.Success && existingSubscriber.Subscriber != nil {
+	if err == nil && existingSubscriber.Success && existingSubscriber.Subscriber != nil {
 		logger.LogFunction("info", constants.Messages.Backend.Info["SubscriberExists"], map[string]string{
 			"email": request.Email,
 			"id":    existingSubscriber.Subscriber.ID,
 		})
 		setResponse(http.StatusConflict, false, constants.Messages.Frontend.Errors["SubscriptionError"], true, existingSubscriber.Subscriber.ID)
-		c.String(response.HttpCode, response.Message)
+		respond(c, response.HttpCode, response.Message, response, "")
 		return
 	}
 
@@ -78,12 +81,34 @@ func SubscribeHandler(c *gin.Context) {
 		})
 	}
 
+	// Keep proof of the opt-in before adding the email to the newsletter
+	if _, err := services.RecordConsent(request.Email, models.SubscriptionSourceNewsletter, c.ClientIP(), c.Request.UserAgent()); err != nil {
+		setResponse(http.StatusInternalServerError, false, constants.Messages.Frontend.Errors["ServerError"], false, "")
+		respond(c, response.HttpCode, response.Message, response, "")
+		return
+	}
+
 	// Process the subscription
-	result, err := services.ProcessSubscription(request.Email, request.UtmSource, tags)
+	actor := models.FormActor("subscribe")
+	result, err := services.ProcessSubscription(actor, request.Email, request.Attribution, tags)
+
+	// While the provider is unreachable the signup is accepted and replayed later
+	if services.IsProviderUnavailable(err) {
+		if _, err := services.QueueSubscription(actor, request.Email, request.Attribution, tags, nil); err != nil {
+			setResponse(http.StatusInternalServerError, false, constants.Messages.Frontend.Errors["ServerError"], false, "")
+			respond(c, response.HttpCode, response.Message, response, "")
+			return
+		}
+		setResponse(http.StatusAccepted, true, constants.Messages.Frontend.Success["SubscriptionQueued"], false, "")
+		response.Queued = true
+		respond(c, response.HttpCode, response.Message, response, constants.URLs.SuccessPages.Subscription)
+		return
+	}
+
 	if err != nil {
 		logger.LogFunction("error", constants.Messages.Backend.Error["SubscriptionError"], err.Error())
 		setResponse(http.StatusInternalServerError, false, constants.Messages.Frontend.Errors["ServerError"], false, "")
-		c.String(response.HttpCode, response.Message)
+		respond(c, response.HttpCode, response.Message, response, "")
 		return
 	}
 
@@ -94,6 +119,6 @@ func SubscribeHandler(c *gin.Context) {
 	})
 
 	setResponse(http.StatusCreated, true, constants.Messages.Frontend.Success["SubscriptionNew"], false, result.SubscriberID)
-	c.Header("HX-Redirect", constants.URLs.SuccessPages.Subscription)
-	c.String(response.HttpCode, response.Message)
+	response.PendingTags = result.PendingTags
+	respond(c, response.HttpCode, response.Message, response, constants.URLs.SuccessPages.Subscription)
 }
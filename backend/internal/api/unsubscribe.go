@@ -7,6 +7,7 @@ import (
 	"github.com/mlorentedev/mlorente-backend/internal/constants"
 	"github.com/mlorentedev/mlorente-backend/internal/models"
 	"github.com/mlorentedev/mlorente-backend/internal/services"
+	"github.com/mlorentedev/mlorente-backend/internal/validation"
 	"github.com/mlorentedev/mlorente-backend/pkg/logger"
 )
 
@@ -25,16 +26,14 @@ func UnsubscribeHandler(c *gin.Context) {
 	// Bind form data
 	if err := c.ShouldBind(&request); err != nil {
 		logger.LogFunction("error", constants.Messages.Backend.Error["IncompleteData"], err.Error())
-		setResponse(http.StatusBadRequest, false, constants.Messages.Frontend.Errors["IncompleteData"])
-		c.String(response.HttpCode, response.Message)
+		respondValidationErrors(c, validation.BindingErrors(err))
 		return
 	}
 
-	// Validate email format
-	if request.Email == "" || !services.IsValidEmailFormat(request.Email) {
-		logger.LogFunction("error", constants.Messages.Backend.Error["InvalidEmail"], request.Email)
-		setResponse(http.StatusBadRequest, false, constants.Messages.Frontend.Errors["InvalidEmail"])
-		c.String(response.HttpCode, response.Message)
+	// Normalize and validate request fields
+	if errs := validation.ValidateUnsubscriptionRequest(&request); len(errs) > 0 {
+		logger.LogFunction("error", constants.Messages.Backend.Error["ValidationError"], errs)
+		respondValidationErrors(c, errs)
 		return
 	}
 
@@ -43,7 +42,7 @@ func UnsubscribeHandler(c *gin.Context) {
 	if err != nil {
 		logger.LogFunction("error", constants.Messages.Backend.Error["CheckSubscriberError"], err.Error())
 		setResponse(http.StatusInternalServerError, false, constants.Messages.Frontend.Errors["ServerError"])
-		c.String(response.HttpCode, response.Message)
+		respond(c, response.HttpCode, response.Message, response, "")
 		return
 	}
 
@@ -56,11 +55,11 @@ func UnsubscribeHandler(c *gin.Context) {
 			"action": "unsubscribe",
 		})
 
-		result, err := services.UnsubscribeUser(request.Email)
+		result, err := services.UnsubscribeUser(models.FormActor("unsubscribe"), request.Email)
 		if err != nil {
 			logger.LogFunction("error", constants.Messages.Backend.Error["UnsubscribeError"], err.Error())
 			setResponse(http.StatusInternalServerError, false, constants.Messages.Frontend.Errors["ServerError"])
-			c.String(response.HttpCode, response.Message)
+			respond(c, response.HttpCode, response.Message, response, "")
 			return
 		}
 
@@ -71,12 +70,11 @@ func UnsubscribeHandler(c *gin.Context) {
 			})
 
 			setResponse(http.StatusOK, true, constants.Messages.Frontend.Success["Unsubscription"])
-			c.Header("HX-Redirect", constants.URLs.SuccessPages.Unsubscribe)
-			c.String(response.HttpCode, response.Message)
+			respond(c, response.HttpCode, response.Message, response, constants.URLs.SuccessPages.Unsubscribe)
 		} else {
 			logger.LogFunction("error", constants.Messages.Backend.Error["UnsubscribeError"], result.Message)
 			setResponse(http.StatusInternalServerError, false, constants.Messages.Frontend.Errors["UnsubscriptionError"])
-			c.String(response.HttpCode, response.Message)
+			respond(c, response.HttpCode, response.Message, response, "")
 		}
 	} else {
 		// Email not subscribed
@@ -86,7 +84,32 @@ func UnsubscribeHandler(c *gin.Context) {
 		})
 
 		setResponse(http.StatusConflict, false, constants.Messages.Frontend.Errors["EmailNotSubscribed"])
-		c.String(response.HttpCode, response.Message)
+		respond(c, response.HttpCode, response.Message, response, "")
 		return
 	}
 }
+
+// OneClickUnsubscribeHandler unsubscribes the email identified by the signed "token" query
+// parameter, without a form body, as mail clients do for the List-Unsubscribe-Post header
+// (RFC 8058). Emails that are no longer subscribed are reported as unsubscribed.
+func OneClickUnsubscribeHandler(c *gin.Context) {
+	var response models.UnsubscriptionResult
+
+	email, ok := verifySignedToken(c, c.Query("token"), services.LinkPurposeUnsubscribe)
+	if !ok {
+		return
+	}
+
+	if _, err := services.UnsubscribeUser(models.FormActor("one-click-unsubscribe"), email); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["UnsubscribeError"], err.Error())
+		response.HttpCode = http.StatusInternalServerError
+		response.Message = constants.Messages.Frontend.Errors["ServerError"]
+		respond(c, response.HttpCode, response.Message, response, "")
+		return
+	}
+
+	response.HttpCode = http.StatusOK
+	response.Success = true
+	response.Message = constants.Messages.Frontend.Success["Unsubscription"]
+	respond(c, response.HttpCode, response.Message, response, constants.URLs.SuccessPages.Unsubscribe)
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/internal/services"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+// maxWebhookBytes caps the size of an inbound webhook body
+const maxWebhookBytes = 1 << 20
+
+// webhookRespond writes a webhook result as JSON
+func webhookRespond(c *gin.Context, httpCode int, message string, eventID string, duplicate bool) {
+	c.JSON(httpCode, models.WebhookResult{
+		HttpCode:  httpCode,
+		Success:   httpCode < 400,
+		Message:   message,
+		EventID:   eventID,
+		Duplicate: duplicate,
+	})
+}
+
+// BeehiivWebhookHandler receives the subscription and tag events sent by Beehiiv. The body is
+// only parsed once its signature and timestamp have been verified.
+func BeehiivWebhookHandler(c *gin.Context) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBytes))
+	if err != nil {
+		webhookRespond(c, http.StatusRequestEntityTooLarge, constants.Messages.Frontend.Errors["IncompleteData"], "", false)
+		return
+	}
+
+	err = services.VerifyBeehiivWebhook(
+		c.GetHeader(services.BeehiivTimestampHeader),
+		c.GetHeader(services.BeehiivSignatureHeader),
+		body,
+	)
+	if err != nil {
+		logger.LogFunction("warn", constants.Messages.Backend.Warn["WebhookRejected"], map[string]string{
+			"ip":    c.ClientIP(),
+			"error": err.Error(),
+		})
+		if errors.Is(err, services.ErrWebhooksDisabled) {
+			webhookRespond(c, http.StatusServiceUnavailable, err.Error(), "", false)
+			return
+		}
+		webhookRespond(c, http.StatusUnauthorized, constants.Messages.Frontend.Errors["Unauthorized"], "", false)
+		return
+	}
+
+	eventID, duplicate, err := services.HandleBeehiivWebhook(body)
+	switch {
+	case errors.Is(err, services.ErrInvalidWebhook):
+		webhookRespond(c, http.StatusBadRequest, err.Error(), "", false)
+	case err != nil:
+		webhookRespond(c, http.StatusInternalServerError, constants.Messages.Frontend.Errors["ServerError"], eventID, false)
+	default:
+		webhookRespond(c, http.StatusOK, constants.Messages.Frontend.Success["Done"], eventID, duplicate)
+	}
+}
@@ -0,0 +1,8 @@
+package constants
+
+// ConsentTexts are the consent statements shown next to each subscription form, by source.
+// They are recorded verbatim in the consent ledger, so change them together with the forms.
+var ConsentTexts = map[string]string{
+	"newsletter":  "Acepto la política de privacidad",
+	"lead_magnet": "Acepto la política de privacidad",
+}
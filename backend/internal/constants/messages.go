@@ -33,13 +33,46 @@ var Messages = struct {
 			"TagsUpdateError":     "Error al actualizar los tags del suscriptor",
 			"SubscriptionError":   "Ya estás suscrito",
 			"UnsubscriptionError": "Error al cancelar la suscripción",
+			"ValidationError":     "Revisa los datos del formulario",
+			"RequiredField":       "Este campo es obligatorio",
+			"InvalidTag":          "Etiqueta no válida",
+			"TooManyTags":         "Demasiadas etiquetas",
+			"InvalidResourceID":   "Identificador de recurso no válido",
+			"InvalidFileID":       "Identificador de archivo no válido",
+			"FieldTooLong":        "El valor es demasiado largo",
+			"FieldTooShort":       "El valor es demasiado corto",
+			"TooManyRequests":     "Demasiadas solicitudes, inténtalo de nuevo más tarde",
+			"InvalidSlot":         "Ese horario no está disponible para reservas",
+			"SlotUnavailable":     "Ese horario ya está reservado, elige otro",
+			"HoldExpired":         "Tu reserva provisional ha caducado, vuelve a elegir horario",
+			"InvalidDate":         "Fecha no válida",
+			"InvalidToken":        "El enlace no es válido o ha caducado",
+			"InvalidTopic":        "Tema no válido",
+			"InvalidPause":        "Duración de la pausa no válida",
+			"InvalidAction":       "Acción no válida",
+			"Unauthorized":        "No autorizado",
+			"NotFound":            "No encontrado",
+			"InvalidImport":       "Fichero de importación no válido",
+			"IdempotencyConflict": "Esta solicitud ya se envió con otros datos",
 		},
 		Success: map[string]string{
 			"SubscriptionNew":     "Nuevo suscriptor añadido",
 			"SubscriptionUpdated": "Suscriptor existente actualizado",
+			"SubscriptionQueued":  "Hemos recibido tu suscripción, la confirmaremos en unos minutos",
 			"Unsubscription":      "Se ha cancelado tu suscripción correctamente",
 			"ResourceSent":        "Recurso enviado correctamente",
+			"ResourceQueued":      "Hemos recibido tu solicitud, la procesaremos en unos minutos",
 			"EmailSent":           "Email enviado correctamente",
+			"ContactSent":         "Mensaje enviado correctamente",
+			"SlotsListed":         "Horarios disponibles",
+			"SlotHeld":            "Horario reservado provisionalmente",
+			"BookingConfirmed":    "Reserva confirmada",
+			"PreferencesLoaded":   "Tus preferencias",
+			"PreferencesUpdated":  "Preferencias actualizadas",
+			"PreferencesLinkSent": "Si el email está suscrito, recibirás un enlace para gestionar tus preferencias",
+			"PrivacyLinkSent":     "Te hemos enviado un enlace para confirmar la solicitud",
+			"DataErased":          "Tus datos se han borrado correctamente",
+			"Done":                "Operación completada",
 		},
 	},
 	Backend: struct {
@@ -49,9 +82,11 @@ var Messages = struct {
 	}{
 		Error: map[string]string{
 			// General errors
-			"InvalidEmail":   "Invalid email format",
-			"IncompleteData": "Incomplete data for operation",
-			"ServerError":    "Internal server error",
+			"InvalidEmail":    "Invalid email format",
+			"IncompleteData":  "Incomplete data for operation",
+			"ServerError":     "Internal server error",
+			"ValidationError": "Request validation failed",
+			"ConfigError":     "Invalid configuration",
 
 			// API and request errors
 			"ApiError":              "API error",
@@ -69,11 +104,52 @@ var Messages = struct {
 			"UnsubscribeError":      "Error unsubscribing user",
 			"EmailNotSubscribed":    "Email not subscribed",
 			"TagsUpdateError":       "Error updating subscriber tags",
+			"AttributionError":      "Error recording subscription attribution",
+			"ListError":             "Error listing Beehiiv resources",
+			"ProviderError":         "Newsletter provider request failed",
 
 			// Email errors
 			"EmailConfigError":   "Email configuration error",
 			"EmailConfigMissing": "Missing email configuration",
 			"SendEmailError":     "Error sending email",
+
+			// Contact errors
+			"ContactError": "Error delivering contact message",
+
+			// Booking errors
+			"BookingError": "Error processing booking",
+
+			// Preferences errors
+			"PreferencesError": "Error updating subscriber preferences",
+			"RemoveTagError":   "Error removing tag from subscriber",
+
+			// Privacy errors
+			"PrivacyError": "Error processing data subject request",
+			"ConsentError": "Error recording subscription consent",
+
+			// Admin errors
+			"AdminError": "Admin API operation failed",
+			"AuditError": "Error writing audit log",
+
+			// Job errors
+			"JobError":  "Error updating job queue",
+			"JobFailed": "Job failed permanently",
+
+			// Bulk errors
+			"ImportError": "Error importing subscribers",
+			"ExportError": "Error exporting subscribers",
+
+			// Mirror errors
+			"MirrorError":    "Error updating local subscriber mirror",
+			"ReconcileError": "Error reconciling subscriber mirror with the newsletter provider",
+
+			// Webhook errors
+			"WebhookError": "Error processing inbound webhook",
+			"NotifyError":  "Error scheduling outbound notification",
+			"DeadLetter":   "Outbound notification moved to dead letters",
+
+			"DivergenceError": "Error recording newsletter provider divergence",
+			"OutboxError":     "Error updating subscription outbox",
 		},
 		Info: map[string]string{
 			// General info
@@ -92,11 +168,78 @@ var Messages = struct {
 			"DelayedEmailScheduled": "Delayed email has been scheduled",
 			"DelayedEmailSent":      "Delayed email sent successfully",
 			"ResourceSent":          "Resource sent successfully",
+
+			// Contact info
+			"ContactReceived": "Contact message received",
+			"ContactSent":     "Contact message delivered",
+
+			// Booking info
+			"SlotHeld":         "Booking slot held",
+			"BookingConfirmed": "Booking confirmed",
+
+			// Preferences info
+			"TagRemoved":          "Tag removed from subscriber",
+			"PreferencesUpdated":  "Subscriber preferences updated",
+			"PreferencesLinkSent": "Preferences link sent",
+			"SubscriptionPaused":  "Subscription paused",
+			"SubscriptionResumed": "Subscription resumed",
+
+			// Privacy info
+			"DataExported":    "Subscriber data exported",
+			"DataErased":      "Subscriber data erased",
+			"PrivacyLinkSent": "Data subject request link sent",
+			"ConsentRecorded": "Subscription consent recorded",
+
+			// Job info
+			"JobScheduled": "Job scheduled",
+			"JobCompleted": "Job completed",
+			"JobCancelled": "Job cancelled",
+
+			// Bulk info
+			"ImportStarted":       "Subscriber import started",
+			"ImportCompleted":     "Subscriber import finished",
+			"SubscribersExported": "Subscribers exported",
+
+			// Mirror info
+			"MirrorReconciled": "Subscriber mirror reconciled with the newsletter provider",
+
+			// Webhook info
+			"WebhookProcessed": "Inbound webhook processed",
+			"WebhookDuplicate": "Inbound webhook already processed",
+			"NotificationSent": "Outbound notification delivered",
+
+			"IdempotentReplay":            "Idempotent request replayed from cache",
+			"ResourceRequestDeduplicated": "Repeated resource request absorbed",
+
+			"DivergenceResolved": "Secondary newsletter provider back in sync",
+			"CircuitClosed":      "Newsletter provider answering again, circuit closed",
+			"OutboxDispatched":   "Subscription request completed",
+			"DripStarted":        "Follow-up sequence scheduled",
+			"DripStopped":        "Pending follow-up emails cancelled",
 		},
 		Warn: map[string]string{
 			"EmptyTag":             "Empty tag not added",
 			"EmailDeliveryIssue":   "Email delivery issue",
 			"MinimumDelayEnforced": "Minimum delay enforced for email delivery",
+			"RateLimited":          "Rate limit exceeded",
+			"SpamDetected":         "Message flagged as spam",
+			"BookingRejected":      "Booking request rejected",
+			"AcknowledgementError": "Contact acknowledgement email could not be sent",
+			"InvalidToken":         "Invalid or expired signed link",
+			"JobRetry":             "Job failed, retry scheduled",
+			"AdminAuthFailed":      "Admin API authentication failed",
+			"MirrorFallback":       "Newsletter provider unreachable, subscriber served from local mirror",
+			"ReconcileSkipped":     "Mirror reconciliation skipped",
+			"WebhookRejected":      "Inbound webhook rejected",
+			"WebhookIgnored":       "Inbound webhook event type not handled",
+			"ProviderErasure":      "Subscriber unsubscribed but not erased: the newsletter provider does not support it",
+			"ProviderDivergence":   "Secondary newsletter provider diverged from the primary",
+			"TagsRetry":            "Tags not added to subscriber, retry scheduled",
+			"IdempotencyConflict":  "Idempotency key reused with a different request",
+			"CircuitOpened":        "Newsletter provider failing, circuit opened",
+			"SubscriptionQueued":   "Newsletter provider unreachable, subscription queued in the outbox",
+			"OutboxStepRetry":      "Subscription request step failed, retry scheduled",
+			"OutboxCompensated":    "Subscription request failed, completed steps undone",
 		},
 	},
 	Service: struct {
@@ -110,6 +253,7 @@ var Messages = struct {
 			"New":         "Nuevo suscriptor añadido.",
 			"Error":       "No se pudo completar la suscripción.",
 			"TagsError":   "Error al actualizar los tags del suscriptor.",
+			"TagsPending": "Suscripción completada. Algunos tags se aplicarán en unos minutos.",
 			"ServerError": "Error interno del servidor.",
 
 			// English messages for function returns
@@ -7,6 +7,7 @@ var URLs = struct {
 		Resource     string
 		Unsubscribe  string
 		Booking      string
+		Contact      string
 	}
 	ErrorPages struct {
 		NotFound string
@@ -17,11 +18,13 @@ var URLs = struct {
 		Resource     string
 		Unsubscribe  string
 		Booking      string
+		Contact      string
 	}{
 		Subscription: "/success/subscribe",
 		Resource:     "/success/resource",
 		Unsubscribe:  "/success/unsubscribe",
 		Booking:      "/success/booking",
+		Contact:      "/success/contact",
 	},
 	ErrorPages: struct {
 		NotFound string
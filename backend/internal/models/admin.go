@@ -0,0 +1,21 @@
+package models
+
+// AdminResult representa la respuesta de una operación de la API de administración
+type AdminResult struct {
+	HttpCode int         `json:"httpCode"`
+	Success  bool        `json:"success"`
+	Message  string      `json:"message"`
+	Data     interface{} `json:"data,omitempty"`
+}
+
+// AdminTagsRequest representa una solicitud de administración para añadir etiquetas a un suscriptor
+type AdminTagsRequest struct {
+	Tags []string `json:"tags" binding:"required"`
+}
+
+// AdminResourceRequest representa una solicitud de administración para reenviar un recurso
+type AdminResourceRequest struct {
+	Email      string `json:"email" binding:"required"`
+	ResourceID string `json:"resource_id" binding:"required"`
+	FileID     string `json:"file_id"`
+}
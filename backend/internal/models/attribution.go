@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Attribution agrupa los datos de campaña y origen de una suscripción
+type Attribution struct {
+	UtmSource     string `json:"utm_source"`
+	UtmMedium     string `json:"utm_medium"`
+	UtmCampaign   string `json:"utm_campaign"`
+	UtmTerm       string `json:"utm_term"`
+	UtmContent    string `json:"utm_content"`
+	ReferringSite string `json:"referring_site"`
+	LandingPage   string `json:"landing_page"`
+}
+
+// AttributionRecord representa el registro local de la atribución de una suscripción
+type AttributionRecord struct {
+	Email        string      `json:"email"`
+	SubscriberID string      `json:"subscriberId"`
+	NewSignup    bool        `json:"newSignup"`
+	Attribution  Attribution `json:"attribution"`
+	CreatedAt    time.Time   `json:"createdAt"`
+}
@@ -0,0 +1,81 @@
+package models
+
+import "time"
+
+// Actor identifica quién origina una operación: un formulario público, una clave de administración o una tarea
+type Actor string
+
+// ActorSystem identifica las operaciones que el servidor inicia por sí mismo
+const ActorSystem Actor = "system"
+
+// FormActor devuelve el actor de un formulario público
+func FormActor(form string) Actor {
+	return Actor("form:" + form)
+}
+
+// AdminActor devuelve el actor de una credencial de administración
+func AdminActor(credential string) Actor {
+	return Actor("admin:" + credential)
+}
+
+// CLIActor devuelve el actor de un usuario de la herramienta de línea de comandos
+func CLIActor(user string) Actor {
+	return Actor("cli:" + user)
+}
+
+// WebhookActor devuelve el actor de un webhook recibido de un proveedor externo
+func WebhookActor(provider string) Actor {
+	return Actor("webhook:" + provider)
+}
+
+// JobActor devuelve el actor de una tarea programada
+func JobActor(jobID string) Actor {
+	return Actor("job:" + jobID)
+}
+
+// AuditAction define las operaciones que modifican estado y quedan auditadas
+type AuditAction string
+
+const (
+	AuditActionSubscribe    AuditAction = "subscribe"
+	AuditActionUnsubscribe  AuditAction = "unsubscribe"
+	AuditActionAddTag       AuditAction = "tag.add"
+	AuditActionRemoveTag    AuditAction = "tag.remove"
+	AuditActionSendResource AuditAction = "resource.send"
+	AuditActionSendDrip     AuditAction = "drip.send"
+	AuditActionPause        AuditAction = "subscription.pause"
+	AuditActionResume       AuditAction = "subscription.resume"
+	AuditActionEraseData    AuditAction = "data.erase"
+)
+
+// AuditOutcome define el resultado de una operación auditada
+type AuditOutcome string
+
+const (
+	AuditOutcomeSuccess AuditOutcome = "success"
+	AuditOutcomeFailure AuditOutcome = "failure"
+)
+
+// AuditEntry representa una entrada del registro de auditoría
+type AuditEntry struct {
+	ID      string       `json:"id"`
+	Time    time.Time    `json:"time"`
+	Actor   Actor        `json:"actor"`
+	Action  AuditAction  `json:"action"`
+	Target  string       `json:"target"`
+	Before  interface{}  `json:"before,omitempty"`
+	After   interface{}  `json:"after,omitempty"`
+	Outcome AuditOutcome `json:"outcome"`
+	Error   string       `json:"error,omitempty"`
+	// Erased marca las entradas de un email borrado: el objetivo pasa a ser el hash del email y se quitan los detalles
+	Erased bool `json:"erased,omitempty"`
+}
+
+// AuditFilter representa los criterios de búsqueda en el registro de auditoría
+type AuditFilter struct {
+	Actor  Actor
+	Action AuditAction
+	Target string
+	Since  time.Time
+	Limit  int
+}
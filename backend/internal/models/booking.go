@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// BookingStatus define los estados de una reserva
+type BookingStatus string
+
+const (
+	BookingStatusHeld      BookingStatus = "held"
+	BookingStatusConfirmed BookingStatus = "confirmed"
+)
+
+// BookingSlot representa un hueco disponible en la agenda
+type BookingSlot struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Booking representa una reserva provisional (hold) o confirmada
+type Booking struct {
+	ID        string        `json:"id"`
+	Status    BookingStatus `json:"status"`
+	Start     time.Time     `json:"start"`
+	End       time.Time     `json:"end"`
+	ExpiresAt *time.Time    `json:"expiresAt,omitempty"`
+	Name      string        `json:"name,omitempty"`
+	Email     string        `json:"email,omitempty"`
+	Notes     string        `json:"notes,omitempty"`
+	CreatedAt time.Time     `json:"createdAt"`
+}
+
+// BookingHoldRequest representa una solicitud de reserva provisional de un hueco
+type BookingHoldRequest struct {
+	Start string `json:"start" binding:"required"`
+}
+
+// BookingRequest representa una solicitud de reserva
+type BookingRequest struct {
+	Name   string `json:"name" binding:"required"`
+	Email  string `json:"email" binding:"required"`
+	Notes  string `json:"notes"`
+	Start  string `json:"start" binding:"required"`
+	HoldID string `json:"hold_id"`
+}
+
+// BookingSlotsResult representa la lista de huecos disponibles
+type BookingSlotsResult struct {
+	HttpCode int           `json:"httpCode"`
+	Success  bool          `json:"success"`
+	Message  string        `json:"message"`
+	Timezone string        `json:"timezone"`
+	Slots    []BookingSlot `json:"slots"`
+}
+
+// BookingResult representa el resultado de una operación de reserva
+type BookingResult struct {
+	HttpCode  int        `json:"httpCode"`
+	Success   bool       `json:"success"`
+	Message   string     `json:"message"`
+	BookingID string     `json:"bookingId,omitempty"`
+	HoldID    string     `json:"holdId,omitempty"`
+	Start     *time.Time `json:"start,omitempty"`
+	End       *time.Time `json:"end,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
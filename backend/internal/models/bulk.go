@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// ImportStatus define los estados de una importación masiva de suscriptores
+type ImportStatus string
+
+const (
+	ImportStatusValidated   ImportStatus = "validated"
+	ImportStatusRunning     ImportStatus = "running"
+	ImportStatusCompleted   ImportStatus = "completed"
+	ImportStatusInterrupted ImportStatus = "interrupted"
+)
+
+// ExportFormat define los formatos de exportación de suscriptores
+type ExportFormat string
+
+const (
+	ExportFormatCSV   ExportFormat = "csv"
+	ExportFormatJSONL ExportFormat = "jsonl"
+)
+
+// ImportRow representa una fila válida de un CSV de importación
+type ImportRow struct {
+	Line        int         `json:"line"`
+	Email       string      `json:"email"`
+	Tags        []string    `json:"tags"`
+	Attribution Attribution `json:"attribution"`
+}
+
+// ImportRowError representa una fila de un CSV de importación que no es válida o no se pudo importar
+type ImportRowError struct {
+	Line   int          `json:"line"`
+	Email  string       `json:"email,omitempty"`
+	Errors []FieldError `json:"errors,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// ImportProgress representa una fila procesada, guardada para poder reanudar la importación
+type ImportProgress struct {
+	Line     int       `json:"line"`
+	Email    string    `json:"email"`
+	Imported bool      `json:"imported"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// ImportReport representa el estado y el resultado de una importación masiva
+type ImportReport struct {
+	ID              string           `json:"id"`
+	Status          ImportStatus     `json:"status"`
+	DryRun          bool             `json:"dryRun"`
+	Rows            int              `json:"rows"`
+	Valid           int              `json:"valid"`
+	Duplicates      int              `json:"duplicates"`
+	Invalid         []ImportRowError `json:"invalid"`
+	AlreadyImported int              `json:"alreadyImported"`
+	Imported        int              `json:"imported"`
+	Failed          []ImportRowError `json:"failed"`
+	Error           string           `json:"error,omitempty"`
+	StartedAt       *time.Time       `json:"startedAt,omitempty"`
+	FinishedAt      *time.Time       `json:"finishedAt,omitempty"`
+}
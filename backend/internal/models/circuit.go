@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// CircuitState define los estados del cortocircuito de la API de un proveedor
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// CircuitStatus representa el estado del cortocircuito de la API de un proveedor. Failures
+// cuenta los fallos consecutivos; Rejected, las peticiones descartadas sin enviarse.
+type CircuitStatus struct {
+	Host      string       `json:"host"`
+	State     CircuitState `json:"state"`
+	Failures  int          `json:"failures"`
+	Requests  int64        `json:"requests"`
+	Rejected  int64        `json:"rejected"`
+	Trips     int64        `json:"trips"`
+	LastError string       `json:"lastError,omitempty"`
+	OpenedAt  *time.Time   `json:"openedAt,omitempty"`
+	RetryAt   *time.Time   `json:"retryAt,omitempty"`
+}
+
+// ProviderMetrics representa el estado de las APIs de los proveedores y de las suscripciones
+// que esperan en la bandeja de salida
+type ProviderMetrics struct {
+	Provider string               `json:"provider"`
+	Circuits []CircuitStatus      `json:"circuits"`
+	Outbox   map[OutboxStatus]int `json:"outbox"`
+}
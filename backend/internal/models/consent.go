@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// ConsentRecord representa una entrada del registro de consentimientos. Solo guarda el hash del email.
+type ConsentRecord struct {
+	ID            string    `json:"id"`
+	EmailHash     string    `json:"emailHash"`
+	Source        string    `json:"source"`
+	IP            string    `json:"ip"`
+	UserAgent     string    `json:"userAgent"`
+	PolicyVersion string    `json:"policyVersion"`
+	ConsentText   string    `json:"consentText"`
+	CreatedAt     time.Time `json:"createdAt"`
+	// Erased marca los consentimientos de un email borrado, sin IP ni agente de usuario
+	Erased bool `json:"erased,omitempty"`
+}
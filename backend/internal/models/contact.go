@@ -0,0 +1,18 @@
+package models
+
+// ContactRequest representa un mensaje enviado desde el formulario de contacto
+type ContactRequest struct {
+	Name    string `json:"name" binding:"required"`
+	Email   string `json:"email" binding:"required"`
+	Subject string `json:"subject"`
+	Message string `json:"message" binding:"required"`
+	// Website es un campo trampa oculto en el formulario: solo los bots lo rellenan
+	Website string `json:"website"`
+}
+
+// ContactResult representa el resultado del envío de un mensaje de contacto
+type ContactResult struct {
+	HttpCode int    `json:"httpCode"`
+	Success  bool   `json:"success"`
+	Message  string `json:"message"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// DripStepStatus representa el estado de un email de una secuencia de seguimiento
+type DripStepStatus struct {
+	Step      int       `json:"step"`
+	Day       int       `json:"day"`
+	JobID     string    `json:"jobId"`
+	Status    JobStatus `json:"status"`
+	RunAt     time.Time `json:"runAt"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// DripEnrollment representa una ejecución de la secuencia de seguimiento de un recurso para un email
+type DripEnrollment struct {
+	ID         string           `json:"id"`
+	Email      string           `json:"email"`
+	ResourceID string           `json:"resourceId"`
+	StartedAt  time.Time        `json:"startedAt"`
+	Steps      []DripStepStatus `json:"steps"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// SecondaryOperation define las operaciones que se replican en los proveedores secundarios
+type SecondaryOperation string
+
+const (
+	SecondarySubscribe   SecondaryOperation = "subscribe"
+	SecondaryAddTag      SecondaryOperation = "add_tag"
+	SecondaryRemoveTag   SecondaryOperation = "remove_tag"
+	SecondaryUnsubscribe SecondaryOperation = "unsubscribe"
+)
+
+// SecondaryJobPayload representa una operación pendiente de reintentar en un proveedor secundario
+type SecondaryJobPayload struct {
+	Provider    string             `json:"provider"`
+	Operation   SecondaryOperation `json:"operation"`
+	Tag         string             `json:"tag,omitempty"`
+	Attribution Attribution        `json:"attribution"`
+}
+
+// ProviderDivergence representa una operación que el proveedor principal aplicó y un
+// secundario no, de modo que sus listas ya no coinciden. Email guarda el ID de suscripción
+// del proveedor principal cuando no se conoce el email.
+type ProviderDivergence struct {
+	ID          string             `json:"id"`
+	Provider    string             `json:"provider"`
+	Operation   SecondaryOperation `json:"operation"`
+	Email       string             `json:"email"`
+	Tag         string             `json:"tag,omitempty"`
+	LastError   string             `json:"lastError"`
+	Occurrences int                `json:"occurrences"`
+	Retrying    bool               `json:"retrying"`
+	FirstSeen   time.Time          `json:"firstSeen"`
+	LastSeen    time.Time          `json:"lastSeen"`
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// JobType define los tipos de tareas programadas
+type JobType string
+
+const (
+	JobTypeResourceEmail      JobType = "resource_email"
+	JobTypeResumeSubscription JobType = "resume_subscription"
+	JobTypeNotification       JobType = "notification"
+	JobTypeSecondarySync      JobType = "secondary_sync"
+	JobTypeAddTags            JobType = "add_tags"
+	JobTypeDripEmail          JobType = "drip_email"
+)
+
+// JobStatus define los estados de una tarea programada
+type JobStatus string
+
+const (
+	JobStatusPending   JobStatus = "pending"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusDone      JobStatus = "done"
+	JobStatusFailed    JobStatus = "failed"
+	JobStatusCancelled JobStatus = "cancelled"
+)
+
+// Job representa una tarea programada persistida en la cola local
+type Job struct {
+	ID          string          `json:"id"`
+	Type        JobType         `json:"type"`
+	Email       string          `json:"email"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Status      JobStatus       `json:"status"`
+	RunAt       time.Time       `json:"runAt"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"maxAttempts"`
+	LastError   string          `json:"lastError,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	UpdatedAt   time.Time       `json:"updatedAt"`
+}
+
+// ResourceEmailJobPayload son los datos de una tarea de envío de recurso
+type ResourceEmailJobPayload struct {
+	ResourceID string `json:"resourceId"`
+	FileID     string `json:"fileId"`
+}
+
+// TagsJobPayload son los datos de una tarea que reintenta añadir etiquetas a un suscriptor
+type TagsJobPayload struct {
+	SubscriberID string   `json:"subscriberId"`
+	Tags         []string `json:"tags"`
+}
+
+// DripJobPayload son los datos de una tarea que envía un email de una secuencia de seguimiento.
+// Enrollment identifica la ejecución de la secuencia a la que pertenece.
+type DripJobPayload struct {
+	Enrollment string `json:"enrollment"`
+	ResourceID string `json:"resourceId"`
+	FileID     string `json:"fileId"`
+	Step       int    `json:"step"`
+	Day        int    `json:"day"`
+}
@@ -0,0 +1,36 @@
+package models
+
+// SubscriptionFilter representa los criterios para recorrer las suscripciones de la publicación
+type SubscriptionFilter struct {
+	// Status filtra por estado en Beehiiv (active, inactive, pending...); vacío incluye todos
+	Status string
+	// Tags limita el recorrido a los suscriptores que tienen todas las etiquetas indicadas
+	Tags []string
+}
+
+// Post representa una publicación de la newsletter
+type Post struct {
+	ID          string   `json:"id"`
+	Title       string   `json:"title"`
+	Subtitle    string   `json:"subtitle,omitempty"`
+	Slug        string   `json:"slug,omitempty"`
+	Status      string   `json:"status"`
+	Audience    string   `json:"audience,omitempty"`
+	PublishDate int64    `json:"publish_date,omitempty"`
+	WebURL      string   `json:"web_url,omitempty"`
+	ContentTags []string `json:"content_tags,omitempty"`
+}
+
+// PostFilter representa los criterios para recorrer las publicaciones
+type PostFilter struct {
+	// Status filtra por estado en Beehiiv (draft, confirmed, archived); vacío incluye todos
+	Status string
+	// ContentTags limita el recorrido a las publicaciones con alguna de las etiquetas indicadas
+	ContentTags []string
+}
+
+// TagCount representa una etiqueta y el número de suscriptores que la tienen
+type TagCount struct {
+	Tag         string `json:"tag"`
+	Subscribers int    `json:"subscribers"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// MirrorStatusDeleted marca en la réplica local los suscriptores que ya no existen en Beehiiv
+const MirrorStatusDeleted = "deleted"
+
+// MirroredSubscriber representa un suscriptor en la réplica local de la audiencia
+type MirroredSubscriber struct {
+	Subscriber
+	UpdatedAt time.Time  `json:"updatedAt"`
+	SyncedAt  *time.Time `json:"syncedAt,omitempty"`
+}
+
+// DriftKind define los tipos de diferencia entre la réplica local y Beehiiv
+type DriftKind string
+
+const (
+	DriftMissingLocally  DriftKind = "missing_locally"
+	DriftMissingRemotely DriftKind = "missing_remotely"
+	DriftStatus          DriftKind = "status"
+	DriftTags            DriftKind = "tags"
+)
+
+// DriftEntry representa una diferencia encontrada y corregida durante una reconciliación
+type DriftEntry struct {
+	Kind   DriftKind   `json:"kind"`
+	Email  string      `json:"email"`
+	Local  interface{} `json:"local,omitempty"`
+	Remote interface{} `json:"remote,omitempty"`
+}
+
+// DriftReport representa el resultado de una reconciliación de la réplica local con Beehiiv
+type DriftReport struct {
+	StartedAt  time.Time         `json:"startedAt"`
+	FinishedAt time.Time         `json:"finishedAt"`
+	Remote     int               `json:"remote"`
+	Local      int               `json:"local"`
+	Counts     map[DriftKind]int `json:"counts"`
+	Entries    []DriftEntry      `json:"entries,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// MirrorStatus representa el estado de la réplica local
+type MirrorStatus struct {
+	Subscribers        int            `json:"subscribers"`
+	ByStatus           map[string]int `json:"byStatus"`
+	LastReconciliation *DriftReport   `json:"lastReconciliation,omitempty"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// NotificationEvent define los eventos que se notifican a las URLs configuradas
+type NotificationEvent string
+
+const (
+	NotificationSubscriberCreated      NotificationEvent = "subscriber.created"
+	NotificationResourceRequested      NotificationEvent = "resource.requested"
+	NotificationResourceDelivered      NotificationEvent = "resource.delivered"
+	NotificationSubscriberUnsubscribed NotificationEvent = "subscriber.unsubscribed"
+)
+
+// Notification representa el cuerpo JSON firmado que se envía a cada URL
+type Notification struct {
+	ID    string            `json:"id"`
+	Event NotificationEvent `json:"event"`
+	Time  time.Time         `json:"time"`
+	Email string            `json:"email"`
+	Data  interface{}       `json:"data,omitempty"`
+}
+
+// NotificationJobPayload representa la entrega de una notificación a una URL concreta
+type NotificationJobPayload struct {
+	URL          string       `json:"url"`
+	Notification Notification `json:"notification"`
+}
+
+// DeadLetter representa una notificación que agotó sus reintentos sin entregarse
+type DeadLetter struct {
+	ID           string       `json:"id"`
+	URL          string       `json:"url"`
+	Notification Notification `json:"notification"`
+	Attempts     int          `json:"attempts"`
+	LastError    string       `json:"lastError"`
+	FailedAt     time.Time    `json:"failedAt"`
+}
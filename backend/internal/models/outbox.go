@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// OutboxStatus define los estados de una solicitud en la bandeja de salida
+type OutboxStatus string
+
+const (
+	OutboxPending OutboxStatus = "pending"
+	OutboxDone    OutboxStatus = "done"
+	OutboxFailed  OutboxStatus = "failed"
+)
+
+// OutboxStepName define los pasos en que se descompone una solicitud de la bandeja de salida
+type OutboxStepName string
+
+const (
+	OutboxStepSubscribe     OutboxStepName = "subscribe"
+	OutboxStepTags          OutboxStepName = "tags"
+	OutboxStepDrip          OutboxStepName = "drip"
+	OutboxStepResourceEmail OutboxStepName = "resource_email"
+	OutboxStepNotify        OutboxStepName = "notify"
+)
+
+// OutboxStepStatus define los estados de un paso
+type OutboxStepStatus string
+
+const (
+	OutboxStepPending     OutboxStepStatus = "pending"
+	OutboxStepDone        OutboxStepStatus = "done"
+	OutboxStepSkipped     OutboxStepStatus = "skipped"
+	OutboxStepFailed      OutboxStepStatus = "failed"
+	OutboxStepCompensated OutboxStepStatus = "compensated"
+)
+
+// OutboxStep representa un paso de una solicitud, con sus intentos y el último error
+type OutboxStep struct {
+	Name      OutboxStepName   `json:"name"`
+	Status    OutboxStepStatus `json:"status"`
+	Attempts  int              `json:"attempts"`
+	LastError string           `json:"lastError,omitempty"`
+	UpdatedAt *time.Time       `json:"updatedAt,omitempty"`
+}
+
+// OutboxEntry representa una solicitud de suscripción registrada antes de ejecutarse, cuyos
+// pasos se ejecutan en orden y se deshacen si uno de ellos falla definitivamente. Resource
+// guarda el recurso pedido en un lead magnet. SubscriberID, Created, AddedTags y DripEnrollment
+// recogen lo que hicieron los pasos ya ejecutados, para poder deshacerlo.
+type OutboxEntry struct {
+	ID             string                   `json:"id"`
+	Actor          Actor                    `json:"actor"`
+	Email          string                   `json:"email"`
+	Attribution    Attribution              `json:"attribution"`
+	Tags           []string                 `json:"tags,omitempty"`
+	Resource       *ResourceEmailJobPayload `json:"resource,omitempty"`
+	Status         OutboxStatus             `json:"status"`
+	Steps          []OutboxStep             `json:"steps"`
+	SubscriberID   string                   `json:"subscriberId,omitempty"`
+	Created        bool                     `json:"created,omitempty"`
+	AddedTags      []string                 `json:"addedTags,omitempty"`
+	DripEnrollment string                   `json:"dripEnrollment,omitempty"`
+	NextAttemptAt  *time.Time               `json:"nextAttemptAt,omitempty"`
+	CreatedAt      time.Time                `json:"createdAt"`
+	UpdatedAt      time.Time                `json:"updatedAt"`
+}
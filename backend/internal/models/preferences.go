@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// SubscriptionTagPaused marca a los suscriptores con los envíos en pausa
+const SubscriptionTagPaused SubscriptionTag = "paused"
+
+// TopicPreference representa un tema del boletín y si el suscriptor lo recibe
+type TopicPreference struct {
+	Topic      string `json:"topic"`
+	Subscribed bool   `json:"subscribed"`
+}
+
+// SubscriptionPause representa una pausa temporal de los envíos
+type SubscriptionPause struct {
+	Email     string    `json:"email"`
+	Until     time.Time `json:"until"`
+	JobID     string    `json:"jobId,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Preferences representa las preferencias actuales de un suscriptor
+type Preferences struct {
+	Email       string            `json:"email"`
+	Topics      []TopicPreference `json:"topics"`
+	PausedUntil *time.Time        `json:"pausedUntil,omitempty"`
+}
+
+// PreferencesRequest representa una solicitud de actualización de preferencias.
+// Si Topics se omite, los temas no cambian; una lista vacía los desactiva todos.
+type PreferencesRequest struct {
+	Token      string   `json:"token" binding:"required"`
+	Topics     []string `json:"topics"`
+	PauseWeeks int      `json:"pause_weeks"`
+	Resume     bool     `json:"resume"`
+}
+
+// PreferencesLinkRequest representa una solicitud del enlace al centro de preferencias
+type PreferencesLinkRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+// PreferencesResult representa el resultado de una operación sobre las preferencias
+type PreferencesResult struct {
+	HttpCode    int          `json:"httpCode"`
+	Success     bool         `json:"success"`
+	Message     string       `json:"message"`
+	Preferences *Preferences `json:"preferences,omitempty"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// PrivacyAction define las solicitudes de derechos sobre los datos personales
+type PrivacyAction string
+
+const (
+	PrivacyActionExport PrivacyAction = "export"
+	PrivacyActionErase  PrivacyAction = "erase"
+)
+
+// PrivacyLinkRequest representa una solicitud del enlace para exportar o borrar los datos
+type PrivacyLinkRequest struct {
+	Email  string        `json:"email" binding:"required"`
+	Action PrivacyAction `json:"action" binding:"required"`
+}
+
+// PrivacyEraseRequest representa una solicitud de borrado de datos verificada con un enlace firmado
+type PrivacyEraseRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// DataExport agrupa todo lo que se guarda sobre un email, en Beehiiv y en los almacenes locales
+type DataExport struct {
+	Email        string              `json:"email"`
+	GeneratedAt  time.Time           `json:"generatedAt"`
+	Subscriber   *Subscriber         `json:"subscriber"`
+	Consents     []ConsentRecord     `json:"consents"`
+	Attributions []AttributionRecord `json:"attributions"`
+	Bookings     []Booking           `json:"bookings"`
+	Jobs         []Job               `json:"jobs"`
+	Pause        *SubscriptionPause  `json:"pause"`
+	Mirror       *MirroredSubscriber `json:"mirror"`
+}
+
+// ErasureRecord es la lápida que deja constancia de un borrado sin guardar el email
+type ErasureRecord struct {
+	EmailHash      string         `json:"emailHash"`
+	ErasedAt       time.Time      `json:"erasedAt"`
+	ProviderErased bool           `json:"providerErased"`
+	Records        map[string]int `json:"records"`
+}
+
+// PrivacyResult representa el resultado de una solicitud de derechos sobre los datos
+type PrivacyResult struct {
+	HttpCode int    `json:"httpCode"`
+	Success  bool   `json:"success"`
+	Message  string `json:"message"`
+}
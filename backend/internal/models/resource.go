@@ -2,18 +2,20 @@ package models
 
 // ResourceRequest representa una solicitud de recurso
 type ResourceRequest struct {
-	Email      string   `json:"email"`
-	ResourceID string   `json:"resource_id"`
+	Email      string   `json:"email" binding:"required"`
+	ResourceID string   `json:"resource_id" binding:"required"`
 	FileID     string   `json:"file_id"`
 	Tags       []string `json:"tags"`
-	UtmSource  string   `json:"utm_source"`
+	Attribution
 }
 
 // ResourceResult representa el resultado de una operación de recurso
 type ResourceResult struct {
-	HttpCode int    `json:"httpCode"`
-	Success  bool   `json:"success"`
-	Message  string `json:"message"`
+	HttpCode  int    `json:"httpCode"`
+	Success   bool   `json:"success"`
+	Message   string `json:"message"`
+	Queued    bool   `json:"queued,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
 }
 
 type ResourceEmailScheduleOptions struct {
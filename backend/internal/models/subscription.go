@@ -19,25 +19,33 @@ const (
 
 // Subscriber representa un suscriptor
 type Subscriber struct {
-	ID    string   `json:"id"`
-	Email string   `json:"email"`
-	Tags  []string `json:"tags"`
+	ID            string   `json:"id"`
+	Email         string   `json:"email"`
+	Tags          []string `json:"tags"`
+	Status        string   `json:"status,omitempty"`
+	Created       int64    `json:"created,omitempty"`
+	UtmSource     string   `json:"utm_source,omitempty"`
+	UtmMedium     string   `json:"utm_medium,omitempty"`
+	UtmCampaign   string   `json:"utm_campaign,omitempty"`
+	ReferringSite string   `json:"referring_site,omitempty"`
 }
 
 // SubscriptionRequest representa una solicitud de suscripción
 type SubscriptionRequest struct {
-	Email     string   `json:"email" binding:"required,email"`
-	Tags      []string `json:"tags"`
-	UtmSource string   `json:"utm_source"`
+	Email string   `json:"email" binding:"required"`
+	Tags  []string `json:"tags"`
+	Attribution
 }
 
 // SubscriptionResult representa el resultado de una operación de suscripción
 type SubscriptionResult struct {
-	HttpCode          int    `json:"httpCode"`
-	Success           bool   `json:"success"`
-	Message           string `json:"message"`
-	SubscriberID      string `json:"subscriberId,omitempty"`
-	AlreadySubscribed bool   `json:"alreadySubscribed,omitempty"`
+	HttpCode          int      `json:"httpCode"`
+	Success           bool     `json:"success"`
+	Message           string   `json:"message"`
+	SubscriberID      string   `json:"subscriberId,omitempty"`
+	AlreadySubscribed bool     `json:"alreadySubscribed,omitempty"`
+	PendingTags       []string `json:"pendingTags,omitempty"`
+	Queued            bool     `json:"queued,omitempty"`
 }
 
 // UnsubscriptionRequest representa una solicitud de cancelación de suscripción
@@ -0,0 +1,15 @@
+package models
+
+// FieldError describe un error de validación asociado a un campo de la solicitud
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ErrorResponse es el sobre común de las respuestas de error de validación
+type ErrorResponse struct {
+	HttpCode int          `json:"httpCode"`
+	Success  bool         `json:"success"`
+	Message  string       `json:"message"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WebhookEventType define los tipos de evento que envía Beehiiv por webhook
+type WebhookEventType string
+
+const (
+	WebhookEventSubscriptionCreated WebhookEventType = "subscription.created"
+	WebhookEventSubscriptionDeleted WebhookEventType = "subscription.deleted"
+	WebhookEventTagsAdded           WebhookEventType = "subscription.tags.added"
+	WebhookEventTagsRemoved         WebhookEventType = "subscription.tags.removed"
+)
+
+// WebhookOutcome define el resultado del procesamiento de un webhook recibido
+type WebhookOutcome string
+
+const (
+	WebhookOutcomeProcessed WebhookOutcome = "processed"
+	WebhookOutcomeIgnored   WebhookOutcome = "ignored"
+)
+
+// BeehiivWebhook representa el sobre común de los webhooks de Beehiiv
+type BeehiivWebhook struct {
+	ID      string           `json:"uid"`
+	Type    WebhookEventType `json:"event_type"`
+	Created int64            `json:"created,omitempty"`
+	Data    json.RawMessage  `json:"data"`
+}
+
+// SubscriptionCreatedEvent representa el alta de un suscriptor en Beehiiv
+type SubscriptionCreatedEvent struct {
+	ID         string `json:"-"`
+	Subscriber Subscriber
+}
+
+// SubscriptionDeletedEvent representa la baja o el rebote de un suscriptor en Beehiiv
+type SubscriptionDeletedEvent struct {
+	ID         string `json:"-"`
+	Subscriber Subscriber
+}
+
+// TagsEvent representa etiquetas añadidas o quitadas a un suscriptor en Beehiiv
+type TagsEvent struct {
+	ID             string   `json:"-"`
+	Added          bool     `json:"-"`
+	SubscriptionID string   `json:"subscription_id"`
+	Email          string   `json:"email"`
+	Tags           []string `json:"tags"`
+}
+
+// WebhookReceipt registra un webhook ya procesado para no aplicarlo dos veces
+type WebhookReceipt struct {
+	ID         string           `json:"id"`
+	Type       WebhookEventType `json:"type"`
+	Outcome    WebhookOutcome   `json:"outcome"`
+	ReceivedAt time.Time        `json:"receivedAt"`
+}
+
+// WebhookResult representa la respuesta a un webhook recibido
+type WebhookResult struct {
+	HttpCode  int    `json:"httpCode"`
+	Success   bool   `json:"success"`
+	Message   string `json:"message"`
+	EventID   string `json:"eventId,omitempty"`
+	Duplicate bool   `json:"duplicate,omitempty"`
+}
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/internal/store"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+var attributionLog = store.NewLog("attributions.jsonl")
+
+// RecordAttribution stores locally the campaign attribution of a subscription.
+// Failures are logged but never abort the subscription.
+func RecordAttribution(email, subscriberID string, newSignup bool, attribution models.Attribution) {
+	record := models.AttributionRecord{
+		Email:        email,
+		SubscriberID: subscriberID,
+		NewSignup:    newSignup,
+		Attribution:  attribution,
+		CreatedAt:    time.Now().UTC(),
+	}
+
+	if err := attributionLog.Append(record); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["AttributionError"], err.Error())
+	}
+}
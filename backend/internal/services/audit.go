@@ -0,0 +1,84 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/internal/store"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+var (
+	auditLogOnce sync.Once
+	auditLog     *store.Log
+)
+
+// auditStore returns the rotating audit log, created on first use once the configuration is loaded
+func auditStore() *store.Log {
+	auditLogOnce.Do(func() {
+		auditLog = store.NewRotatingLog("audit.jsonl", int64(conf().Audit.MaxSizeMB)<<20, conf().Audit.MaxFiles)
+	})
+	return auditLog
+}
+
+// RecordAudit appends a state-changing operation to the audit log. The outcome is a failure
+// when err is not nil or success is false. Failures to write are logged but never abort the operation.
+func RecordAudit(actor models.Actor, action models.AuditAction, target string, before, after interface{}, success bool, err error) {
+	entry := models.AuditEntry{
+		ID:      generateUniqueID(),
+		Time:    time.Now().UTC(),
+		Actor:   actor,
+		Action:  action,
+		Target:  target,
+		Before:  before,
+		After:   after,
+		Outcome: models.AuditOutcomeSuccess,
+	}
+	if err != nil || !success {
+		entry.Outcome = models.AuditOutcomeFailure
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	if err := auditStore().Append(entry); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["AuditError"], err.Error())
+	}
+}
+
+// QueryAudit returns the audit entries matching the filter, newest first
+func QueryAudit(filter models.AuditFilter) ([]models.AuditEntry, error) {
+	entries := []models.AuditEntry{}
+	err := auditStore().Scan(func(raw json.RawMessage) error {
+		var entry models.AuditEntry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return err
+		}
+
+		switch {
+		case filter.Actor != "" && !strings.HasPrefix(string(entry.Actor), string(filter.Actor)):
+		case filter.Action != "" && entry.Action != filter.Action:
+		case filter.Target != "" && entry.Target != filter.Target:
+		case !filter.Since.IsZero() && entry.Time.Before(filter.Since):
+		default:
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The log is read oldest first
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[:filter.Limit]
+	}
+	return entries, nil
+}
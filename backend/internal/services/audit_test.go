@@ -0,0 +1,50 @@
+package services
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+)
+
+func TestTagAuditRecordsProviderErrors(t *testing.T) {
+	fakeProviderAPI(t, "beehiiv", recordedAPI(t, map[string]recordedRoute{
+		"POST " + beehiivPath("subscriptions/"+beehiivSubscriptionID+"/tags"):   {http.StatusBadRequest, "beehiiv/invalid_tags.json"},
+		"DELETE " + beehiivPath("subscriptions/"+beehiivSubscriptionID+"/tags"): {http.StatusNotFound, "beehiiv/subscription_not_found.json"},
+	}))
+	mirrorSubscriber(models.Subscriber{ID: beehiivSubscriptionID, Email: "ana@example.com", Tags: []string{"Homelab"}})
+
+	actor := models.AdminActor("test")
+	if failed, err := AddTagsToSubscriber(actor, beehiivSubscriptionID, []string{"homelab", "devops"}); len(failed) != 2 || err == nil {
+		t.Fatalf("AddTagsToSubscriber = %v, %v; want both tags to fail", failed, err)
+	}
+	if RemoveTagFromSubscriber(actor, beehiivSubscriptionID, "homelab") {
+		t.Fatal("RemoveTagFromSubscriber succeeded against a failing provider")
+	}
+
+	entries, err := QueryAudit(models.AuditFilter{Target: beehiivSubscriptionID, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d audit entries, want 3", len(entries))
+	}
+
+	wantBefore := map[string]interface{}{
+		"homelab": map[string]interface{}{"tagged": true},
+		"devops":  map[string]interface{}{"tagged": false},
+	}
+	for _, entry := range entries {
+		if entry.Outcome != models.AuditOutcomeFailure || entry.Error == "" {
+			t.Errorf("entry %s %v = %s %q, want a failure with the provider error", entry.Action, entry.After, entry.Outcome, entry.Error)
+		}
+		if entry.Action != models.AuditActionAddTag {
+			continue
+		}
+		tag := entry.After.(map[string]interface{})["tag"].(string)
+		if !reflect.DeepEqual(entry.Before, wantBefore[tag]) {
+			t.Errorf("before of tag %s = %v, want %v", tag, entry.Before, wantBefore[tag])
+		}
+	}
+}
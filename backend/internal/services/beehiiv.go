@@ -1,143 +1,97 @@
 package services
 
 import (
-	"bytes"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io"
 	"net/http"
 
 	"github.com/mlorentedev/mlorente-backend/internal/constants"
 	"github.com/mlorentedev/mlorente-backend/internal/models"
-	"github.com/mlorentedev/mlorente-backend/pkg/config"
 	"github.com/mlorentedev/mlorente-backend/pkg/logger"
 )
 
-var conf *config.Config
+// beehiivProvider keeps the list in a Beehiiv publication
+type beehiivProvider struct{}
 
-func init() {
-	var err error
-	if conf == nil {
-		conf, err = config.GetConfig()
-		if err != nil {
-			panic(err)
-		}
-	}
+// beehiivSubscription is the envelope of the Beehiiv endpoints that answer with a subscription
+type beehiivSubscription struct {
+	Data *models.Subscriber `json:"data"`
 }
 
-// CheckSubscriber verifies if a subscriber exists by email
-func CheckSubscriber(email string) (*struct {
-	Success    bool
-	Subscriber *models.Subscriber
-}, error) {
-	url := fmt.Sprintf("https://api.beehiiv.com/v2/publications/%s/subscriptions/by_email/%s",
-		conf.Beehiiv.PubID, email)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		logger.LogFunction("error", constants.Messages.Backend.Error["RequestCreationError"], err.Error())
-		return nil, err
-	}
+// beehiivURL returns the API URL of a path under the configured publication
+func beehiivURL(path string) string {
+	return fmt.Sprintf("https://api.beehiiv.com/v2/publications/%s/%s", conf().Beehiiv.PubID, path)
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+conf.Beehiiv.APIKey)
+// authorize sets the bearer API key Beehiiv expects
+func (beehiivProvider) authorize(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+conf().Beehiiv.APIKey)
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		logger.LogFunction("error", constants.Messages.Backend.Error["RequestExecutionError"], err.Error())
-		return nil, err
-	}
-	defer resp.Body.Close()
+// Name identifies the provider
+func (beehiivProvider) Name() string {
+	return "beehiiv"
+}
 
-	body, err := io.ReadAll(resp.Body)
+// FindSubscriber asks Beehiiv whether a subscriber exists by email
+func (p beehiivProvider) FindSubscriber(email string) (*models.Subscriber, error) {
+	status, body, err := providerRequest("GET", beehiivURL("subscriptions/by_email/"+email+"?expand[]=tags"), nil, p.authorize)
 	if err != nil {
-		logger.LogFunction("error", constants.Messages.Backend.Error["ResponseReadError"], err.Error())
 		return nil, err
 	}
 
-	var result struct {
-		Data *models.Subscriber `json:"data"`
+	// Outages and rate limits must not be mistaken for an unknown subscriber
+	if status == http.StatusTooManyRequests || status >= http.StatusInternalServerError {
+		logger.LogFunction("error", constants.Messages.Backend.Error["CheckSubscriberError"], string(body))
+		return nil, fmt.Errorf("checking subscriber failed with status %d", status)
 	}
 
+	var result beehiivSubscription
 	if err := json.Unmarshal(body, &result); err != nil {
 		logger.LogFunction("error", constants.Messages.Backend.Error["UnmarshalError"], err.Error())
 		return nil, err
 	}
 
 	if result.Data == nil || result.Data.ID == "" {
-		logger.LogFunction("info", constants.Messages.Backend.Info["SubscriberNotFound"], email)
-		return &struct {
-			Success    bool
-			Subscriber *models.Subscriber
-		}{
-			Success: false,
-		}, nil
+		return nil, nil
 	}
-
-	logger.LogFunction("info", constants.Messages.Backend.Info["SubscriberExists"], email)
-	return &struct {
-		Success    bool
-		Subscriber *models.Subscriber
-	}{
-		Success:    true,
-		Subscriber: result.Data,
-	}, nil
+	return result.Data, nil
 }
 
-// SubscribeUser creates a new subscriber
-func SubscribeUser(email, utmSource string) (*struct {
-	Success    bool
-	Subscriber *models.Subscriber
-}, error) {
-	logger.LogFunction("info", constants.Messages.Backend.Info["SubscriptionProcessing"], map[string]string{
-		"email":     email,
-		"utmSource": utmSource,
-	})
-
-	url := fmt.Sprintf("https://api.beehiiv.com/v2/publications/%s/subscriptions", conf.Beehiiv.PubID)
-
+// CreateSubscriber creates a Beehiiv subscription with its campaign attribution, reactivating
+// it when the email had left
+func (p beehiivProvider) CreateSubscriber(email string, attribution models.Attribution) (*models.Subscriber, error) {
 	data := map[string]interface{}{
 		"email":               email,
-		"utm_source":          utmSource,
+		"utm_source":          attribution.UtmSource,
+		"utm_medium":          attribution.UtmMedium,
+		"utm_campaign":        attribution.UtmCampaign,
+		"referring_site":      attribution.ReferringSite,
 		"reactivate_existing": true,
 		"send_welcome_email":  true,
 	}
 
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		logger.LogFunction("error", constants.Messages.Backend.Error["MarshalError"], err.Error())
-		return nil, err
+	// Fields without a native Beehiiv attribute are sent as custom fields
+	var customFields []map[string]string
+	for _, field := range [][2]string{
+		{"utm_term", attribution.UtmTerm},
+		{"utm_content", attribution.UtmContent},
+		{"landing_page", attribution.LandingPage},
+	} {
+		if field[1] != "" {
+			customFields = append(customFields, map[string]string{"name": field[0], "value": field[1]})
+		}
 	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		logger.LogFunction("error", constants.Messages.Backend.Error["RequestCreationError"], err.Error())
-		return nil, err
+	if len(customFields) > 0 {
+		data["custom_fields"] = customFields
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+conf.Beehiiv.APIKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	_, body, err := providerRequest("POST", beehiivURL("subscriptions"), data, p.authorize)
 	if err != nil {
-		logger.LogFunction("error", constants.Messages.Backend.Error["RequestExecutionError"], err.Error())
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		logger.LogFunction("error", constants.Messages.Backend.Error["ResponseReadError"], err.Error())
-		return nil, err
-	}
-
-	var result struct {
-		Data *models.Subscriber `json:"data"`
-	}
 
+	var result beehiivSubscription
 	if err := json.Unmarshal(body, &result); err != nil {
 		logger.LogFunction("error", constants.Messages.Backend.Error["UnmarshalError"], err.Error())
 		return nil, err
@@ -145,148 +99,63 @@ func SubscribeUser(email, utmSource string) (*struct {
 
 	if result.Data == nil || result.Data.ID == "" {
 		logger.LogFunction("error", constants.Messages.Backend.Error["CreateSubscriberError"], string(body))
-		return &struct {
-			Success    bool
-			Subscriber *models.Subscriber
-		}{
-			Success: false,
-		}, nil
+		return nil, nil
 	}
-
-	logger.LogFunction("info", constants.Messages.Backend.Info["NewSubscriber"], email)
-	return &struct {
-		Success    bool
-		Subscriber *models.Subscriber
-	}{
-		Success:    true,
-		Subscriber: result.Data,
-	}, nil
+	return result.Data, nil
 }
 
-// AddTagToSubscriber adds a tag to an existing subscriber
-func AddTagToSubscriber(subscriptionID, tag string) bool {
-	if tag == "" {
-		logger.LogFunction("warn", constants.Messages.Backend.Warn["EmptyTag"], subscriptionID)
-		return false
-	}
-
-	url := fmt.Sprintf("https://api.beehiiv.com/v2/publications/%s/subscriptions/%s/tags",
-		conf.Beehiiv.PubID, subscriptionID)
+// AddTag adds a tag to a Beehiiv subscription
+func (p beehiivProvider) AddTag(subscriptionID, tag string) error {
+	return p.AddTags(subscriptionID, []string{tag})
+}
 
+// AddTags adds several tags to a Beehiiv subscription in a single request
+func (p beehiivProvider) AddTags(subscriptionID string, tags []string) error {
 	data := map[string]interface{}{
-		"tags": []string{tag},
-	}
-
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		logger.LogFunction("error", constants.Messages.Backend.Error["MarshalError"], err.Error())
-		return false
+		"tags": tags,
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	status, body, err := providerRequest("POST", beehiivURL("subscriptions/"+subscriptionID+"/tags"), data, p.authorize)
 	if err != nil {
-		logger.LogFunction("error", constants.Messages.Backend.Error["RequestCreationError"], err.Error())
-		return false
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+conf.Beehiiv.APIKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		logger.LogFunction("error", constants.Messages.Backend.Error["RequestExecutionError"], err.Error())
-		return false
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		logger.LogFunction("error", constants.Messages.Backend.Error["ResponseReadError"], err.Error())
-		return false
-	}
-
-	var result struct {
-		Data *models.Subscriber `json:"data"`
+		return err
 	}
 
+	var result beehiivSubscription
 	if err := json.Unmarshal(body, &result); err != nil {
 		logger.LogFunction("error", constants.Messages.Backend.Error["UnmarshalError"], err.Error())
-		return false
+		return err
 	}
 
 	if result.Data == nil || result.Data.ID == "" {
-		logger.LogFunction("error", constants.Messages.Backend.Error["AddTagError"], map[string]string{
-			"subscriptionId": subscriptionID,
-			"tag":            tag,
-			"response":       string(body),
-		})
-		return false
+		return providerStatusError(p.Name(), "add tag", status, body)
 	}
-
-	logger.LogFunction("info", constants.Messages.Backend.Info["TagAdded"], map[string]string{
-		"subscriptionId": subscriptionID,
-		"tag":            tag,
-	})
-	return true
+	return nil
 }
 
-// UnsubscribeUser unsubscribes a user from the newsletter
-func UnsubscribeUser(email string) (*models.SubscriptionResult, error) {
-	subscriberCheck, err := CheckSubscriber(email)
-	if err != nil {
-		return nil, err
-	}
-
-	if !subscriberCheck.Success || subscriberCheck.Subscriber == nil {
-		logger.LogFunction("warn", constants.Messages.Backend.Info["SubscriberNotFound"], map[string]string{
-			"action": "unsubscribe",
-			"email":  email,
-		})
-		return &models.SubscriptionResult{
-			Success: false,
-			Message: constants.Messages.Frontend.Errors["EmailNotSubscribed"],
-		}, nil
+// RemoveTag removes a tag from a Beehiiv subscription
+func (p beehiivProvider) RemoveTag(subscriptionID, tag string) error {
+	data := map[string]interface{}{
+		"tags": []string{tag},
 	}
 
-	subscriptionID := subscriberCheck.Subscriber.ID
-	logger.LogFunction("info", constants.Messages.Backend.Info["UserUnsubscribed"], map[string]string{
-		"email": email,
-		"id":    subscriptionID,
-	})
-
-	url := fmt.Sprintf("https://api.beehiiv.com/v2/publications/%s/subscriptions/%s",
-		conf.Beehiiv.PubID, subscriptionID)
-
-	req, err := http.NewRequest("DELETE", url, nil)
+	status, body, err := providerRequest("DELETE", beehiivURL("subscriptions/"+subscriptionID+"/tags"), data, p.authorize)
 	if err != nil {
-		logger.LogFunction("error", constants.Messages.Backend.Error["RequestCreationError"], err.Error())
-		return nil, err
+		return err
 	}
+	if !isSuccess(status) {
+		return providerStatusError(p.Name(), "remove tag", status, body)
+	}
+	return nil
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+conf.Beehiiv.APIKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// DeleteSubscriber deletes the Beehiiv subscription; Beehiiv keeps no record of it afterwards
+func (p beehiivProvider) DeleteSubscriber(subscriber models.Subscriber) error {
+	status, body, err := providerRequest("DELETE", beehiivURL("subscriptions/"+subscriber.ID), nil, p.authorize)
 	if err != nil {
-		logger.LogFunction("error", constants.Messages.Backend.Error["RequestExecutionError"], err.Error())
-		return nil, err
+		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == 204 {
-		logger.LogFunction("info", constants.Messages.Backend.Info["UserUnsubscribed"], email)
-		return &models.SubscriptionResult{
-			Success: true,
-			Message: constants.Messages.Frontend.Success["Unsubscription"],
-		}, nil
-	} else {
-		body, _ := io.ReadAll(resp.Body)
-		logger.LogFunction("error", constants.Messages.Backend.Error["UnsubscribeError"], string(body))
-		return &models.SubscriptionResult{
-			Success: false,
-			Message: constants.Messages.Frontend.Errors["ServerError"],
-		}, errors.New("error unsubscribing user")
+	if status != http.StatusNoContent {
+		return providerStatusError(p.Name(), "delete subscriber", status, body)
 	}
+	return nil
 }
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+// beehiivPageSize is the number of items requested per page, the Beehiiv maximum
+const beehiivPageSize = 100
+
+// beehiivPage is the envelope of the Beehiiv list endpoints. Endpoints with cursor
+// pagination fill HasMore and NextCursor; the others fill Page and TotalPages.
+type beehiivPage struct {
+	Data       json.RawMessage `json:"data"`
+	HasMore    bool            `json:"has_more"`
+	NextCursor string          `json:"next_cursor"`
+	Page       int             `json:"page"`
+	TotalPages int             `json:"total_pages"`
+}
+
+// fetchBeehiivPage requests a single page of a publication list endpoint
+func fetchBeehiivPage(path string, query url.Values) (*beehiivPage, error) {
+	status, body, err := providerRequest("GET", beehiivURL(path+"?"+query.Encode()), nil, beehiivProvider{}.authorize)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		logger.LogFunction("error", constants.Messages.Backend.Error["ListError"], map[string]interface{}{
+			"path":   path,
+			"status": status,
+			"body":   string(body),
+		})
+		return nil, fmt.Errorf("listing %s failed with status %d", path, status)
+	}
+
+	var page beehiivPage
+	if err := json.Unmarshal(body, &page); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["UnmarshalError"], err.Error())
+		return nil, err
+	}
+	return &page, nil
+}
+
+// eachBeehiivPage walks a publication list endpoint and calls fn with the data of every page.
+// It follows the cursor when the endpoint returns one and the page number otherwise, and
+// stops at the first error.
+func eachBeehiivPage(path string, query url.Values, fn func(data json.RawMessage) error) error {
+	query.Set("limit", strconv.Itoa(beehiivPageSize))
+
+	for number := 1; ; number++ {
+		page, err := fetchBeehiivPage(path, query)
+		if err != nil {
+			return err
+		}
+		if err := fn(page.Data); err != nil {
+			return err
+		}
+
+		switch {
+		case page.NextCursor != "":
+			if !page.HasMore {
+				return nil
+			}
+			query.Del("page")
+			query.Set("cursor", page.NextCursor)
+		case number < page.TotalPages:
+			query.Set("page", strconv.Itoa(number+1))
+		default:
+			return nil
+		}
+	}
+}
+
+// hasTags reports whether tags contains every one of wanted, ignoring case
+func hasTags(tags, wanted []string) bool {
+	current := map[string]bool{}
+	for _, tag := range tags {
+		current[strings.ToLower(tag)] = true
+	}
+	for _, tag := range wanted {
+		if !current[strings.ToLower(tag)] {
+			return false
+		}
+	}
+	return true
+}
+
+// EachSubscription walks every subscription of the publication with the given status, page
+// after page, and calls fn with each one. It stops at the first error, returning it.
+func (beehiivProvider) EachSubscription(status string, fn func(subscriber models.Subscriber) error) error {
+	query := url.Values{}
+	query.Set("expand[]", "tags")
+	if status != "" {
+		query.Set("status", status)
+	}
+
+	return eachBeehiivPage("subscriptions", query, func(data json.RawMessage) error {
+		var subscribers []models.Subscriber
+		if err := json.Unmarshal(data, &subscribers); err != nil {
+			return err
+		}
+		for _, subscriber := range subscribers {
+			if err := fn(subscriber); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// EachSubscription walks every subscriber of the primary provider matching the filter and
+// calls fn with each one. The provider filters by status; the tag filter is applied here since
+// not every provider has one. It stops at the first error, returning it.
+func EachSubscription(filter models.SubscriptionFilter, fn func(subscriber models.Subscriber) error) error {
+	lister, ok := primaryProvider().(SubscriptionLister)
+	if !ok {
+		return ErrListingUnsupported
+	}
+
+	return lister.EachSubscription(filter.Status, func(subscriber models.Subscriber) error {
+		if !hasTags(subscriber.Tags, filter.Tags) {
+			return nil
+		}
+		return fn(subscriber)
+	})
+}
+
+// ListSubscriptions returns every subscriber of the list matching the filter.
+// EachSubscription avoids holding the whole list in memory.
+func ListSubscriptions(filter models.SubscriptionFilter) ([]models.Subscriber, error) {
+	subscribers := []models.Subscriber{}
+	err := EachSubscription(filter, func(subscriber models.Subscriber) error {
+		subscribers = append(subscribers, subscriber)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return subscribers, nil
+}
+
+// EachPost walks every post of the Beehiiv publication matching the filter and calls fn with
+// each one, stopping at the first error. Posts only exist with the Beehiiv provider.
+func EachPost(filter models.PostFilter, fn func(post models.Post) error) error {
+	if newsletter().Name() != "beehiiv" {
+		return ErrListingUnsupported
+	}
+
+	query := url.Values{}
+	if filter.Status != "" {
+		query.Set("status", filter.Status)
+	}
+	for _, tag := range filter.ContentTags {
+		query.Add("content_tags[]", tag)
+	}
+
+	return eachBeehiivPage("posts", query, func(data json.RawMessage) error {
+		var posts []models.Post
+		if err := json.Unmarshal(data, &posts); err != nil {
+			return err
+		}
+		for _, post := range posts {
+			if err := fn(post); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListPosts returns every post of the publication matching the filter
+func ListPosts(filter models.PostFilter) ([]models.Post, error) {
+	posts := []models.Post{}
+	err := EachPost(filter, func(post models.Post) error {
+		posts = append(posts, post)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// ListTags returns the tags in use among the subscriptions with the given status and how
+// many subscribers have each one, the most used first. Providers have no tag counts, so the
+// whole list is walked.
+func ListTags(status string) ([]models.TagCount, error) {
+	counts := map[string]int{}
+	err := EachSubscription(models.SubscriptionFilter{Status: status}, func(subscriber models.Subscriber) error {
+		for _, tag := range subscriber.Tags {
+			counts[strings.ToLower(tag)]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]models.TagCount, 0, len(counts))
+	for tag, count := range counts {
+		tags = append(tags, models.TagCount{Tag: tag, Subscribers: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Subscribers != tags[j].Subscribers {
+			return tags[i].Subscribers > tags[j].Subscribers
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	return tags, nil
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+)
+
+const beehiivSubscriptionID = "sub_00000000-0000-0000-0000-000000000001"
+
+// beehiivPath returns the path of a publication endpoint as the fake API receives it
+func beehiivPath(path string) string {
+	return "/v2/publications/pub_test/" + path
+}
+
+func TestBeehiivFindSubscriber(t *testing.T) {
+	calls := fakeProviderAPI(t, "beehiiv", recordedAPI(t, map[string]recordedRoute{
+		"GET " + beehiivPath("subscriptions/by_email/ana@example.com"): {http.StatusOK, "beehiiv/subscription_tags.json"},
+		"GET " + beehiivPath("subscriptions/by_email/bob@example.com"): {http.StatusNotFound, "beehiiv/subscription_not_found.json"},
+		"GET " + beehiivPath("subscriptions/by_email/eva@example.com"): {http.StatusServiceUnavailable, ""},
+	}))
+
+	subscriber, err := (beehiivProvider{}).FindSubscriber("ana@example.com")
+	if err != nil {
+		t.Fatalf("FindSubscriber: %v", err)
+	}
+	if subscriber == nil || subscriber.ID != beehiivSubscriptionID || subscriber.Status != "active" || len(subscriber.Tags) != 1 {
+		t.Errorf("subscriber = %+v", subscriber)
+	}
+	if got := calls()[0].Query.Get("expand[]"); got != "tags" {
+		t.Errorf("expand = %q, want the tags", got)
+	}
+
+	if subscriber, err := (beehiivProvider{}).FindSubscriber("bob@example.com"); err != nil || subscriber != nil {
+		t.Errorf("unknown email: subscriber = %+v, err = %v; want neither", subscriber, err)
+	}
+	if _, err := (beehiivProvider{}).FindSubscriber("eva@example.com"); err == nil {
+		t.Error("an outage was taken for an unknown subscriber")
+	}
+}
+
+func TestBeehiivCreateSubscriber(t *testing.T) {
+	calls := fakeProviderAPI(t, "beehiiv", recordedAPI(t, map[string]recordedRoute{
+		"POST " + beehiivPath("subscriptions"): {http.StatusCreated, "beehiiv/subscription_tags.json"},
+	}))
+
+	subscriber, err := (beehiivProvider{}).CreateSubscriber("ana@example.com", models.Attribution{UtmSource: "blog", UtmTerm: "homelab"})
+	if err != nil || subscriber == nil || subscriber.ID != beehiivSubscriptionID {
+		t.Fatalf("CreateSubscriber = %+v, %v", subscriber, err)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(calls()[0].Body), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["utm_source"] != "blog" || body["reactivate_existing"] != true {
+		t.Errorf("body = %v", body)
+	}
+	fields, _ := body["custom_fields"].([]interface{})
+	if len(fields) != 1 {
+		t.Errorf("custom fields = %v, want utm_term only", body["custom_fields"])
+	}
+}
+
+func TestBeehiivCreateSubscriberRefused(t *testing.T) {
+	fakeProviderAPI(t, "beehiiv", recordedAPI(t, map[string]recordedRoute{
+		"POST " + beehiivPath("subscriptions"): {http.StatusBadRequest, "beehiiv/invalid_email.json"},
+	}))
+
+	subscriber, err := (beehiivProvider{}).CreateSubscriber("ana@example", models.Attribution{})
+	if err != nil || subscriber != nil {
+		t.Errorf("CreateSubscriber = %+v, %v; want a refusal without an error", subscriber, err)
+	}
+}
+
+func TestBeehiivAddTags(t *testing.T) {
+	calls := fakeProviderAPI(t, "beehiiv", recordedAPI(t, map[string]recordedRoute{
+		"POST " + beehiivPath("subscriptions/"+beehiivSubscriptionID+"/tags"): {http.StatusOK, "beehiiv/subscription_tags.json"},
+		"POST " + beehiivPath("subscriptions/sub_missing/tags"):               {http.StatusNotFound, "beehiiv/subscription_not_found.json"},
+	}))
+
+	if err := (beehiivProvider{}).AddTags(beehiivSubscriptionID, []string{"homelab", "devops"}); err != nil {
+		t.Fatalf("AddTags: %v", err)
+	}
+	if got := calls()[0].Body; got != `{"tags":["homelab","devops"]}` {
+		t.Errorf("body = %s", got)
+	}
+	if err := (beehiivProvider{}).AddTag("sub_missing", "homelab"); err == nil {
+		t.Error("tagging an unknown subscription succeeded")
+	}
+}
+
+func TestBeehiivDeleteSubscriber(t *testing.T) {
+	fakeProviderAPI(t, "beehiiv", recordedAPI(t, map[string]recordedRoute{
+		"DELETE " + beehiivPath("subscriptions/"+beehiivSubscriptionID): {http.StatusNoContent, ""},
+		"DELETE " + beehiivPath("subscriptions/sub_missing"):            {http.StatusNotFound, "beehiiv/subscription_not_found.json"},
+	}))
+
+	if err := (beehiivProvider{}).DeleteSubscriber(models.Subscriber{ID: beehiivSubscriptionID}); err != nil {
+		t.Errorf("DeleteSubscriber: %v", err)
+	}
+	if err := (beehiivProvider{}).DeleteSubscriber(models.Subscriber{ID: "sub_missing"}); err == nil {
+		t.Error("deleting an unknown subscription succeeded")
+	}
+}
+
+func TestBeehiivEachSubscription(t *testing.T) {
+	calls := fakeProviderAPI(t, "beehiiv", recordedAPI(t, map[string]recordedRoute{
+		"GET " + beehiivPath("subscriptions"): {http.StatusOK, "beehiiv/subscriptions_page.json"},
+	}))
+
+	var emails []string
+	err := (beehiivProvider{}).EachSubscription("active", func(subscriber models.Subscriber) error {
+		emails = append(emails, subscriber.Email)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("EachSubscription: %v", err)
+	}
+	if len(emails) != 2 || emails[0] != "ana@example.com" || emails[1] != "bob@example.com" {
+		t.Errorf("emails = %v", emails)
+	}
+	if query := calls()[0].Query; query.Get("status") != "active" || query.Get("limit") != "100" {
+		t.Errorf("query = %v", query)
+	}
+}
+
+func TestBeehiivRemoveTag(t *testing.T) {
+	calls := fakeProviderAPI(t, "beehiiv", func(w http.ResponseWriter, r *http.Request) {
+		recordedResponse(t, w, http.StatusOK, "beehiiv/subscription_tags.json")
+	})
+
+	if err := (beehiivProvider{}).RemoveTag(beehiivSubscriptionID, "paused"); err != nil {
+		t.Fatalf("RemoveTag: %v", err)
+	}
+
+	received := calls()
+	if len(received) != 1 {
+		t.Fatalf("got %d requests, want 1", len(received))
+	}
+	call := received[0]
+	if call.Method != http.MethodDelete || call.Path != "/v2/publications/pub_test/subscriptions/"+beehiivSubscriptionID+"/tags" {
+		t.Errorf("request = %s %s", call.Method, call.Path)
+	}
+	if got := call.Header.Get("Authorization"); got != "Bearer beehiiv-key" {
+		t.Errorf("Authorization = %q", got)
+	}
+	var body struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.Unmarshal([]byte(call.Body), &body); err != nil || len(body.Tags) != 1 || body.Tags[0] != "paused" {
+		t.Errorf("body = %s, want the paused tag", call.Body)
+	}
+}
+
+func TestBeehiivRemoveTagNotFound(t *testing.T) {
+	fakeProviderAPI(t, "beehiiv", func(w http.ResponseWriter, r *http.Request) {
+		recordedResponse(t, w, http.StatusNotFound, "beehiiv/subscription_not_found.json")
+	})
+
+	if err := (beehiivProvider{}).RemoveTag(beehiivSubscriptionID, "paused"); err == nil {
+		t.Fatal("RemoveTag succeeded for an unknown subscription")
+	}
+}
+
+func TestPauseIsLiftedByTheResumeJob(t *testing.T) {
+	calls := fakeProviderAPI(t, "beehiiv", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodDelete:
+			recordedResponse(t, w, http.StatusOK, "beehiiv/subscription_tags.json")
+		default:
+			recordedResponse(t, w, http.StatusOK, "beehiiv/subscription_paused.json")
+		}
+	})
+
+	email := "ana@example.com"
+	if err := PauseSubscription(models.FormActor("preferences"), email, beehiivSubscriptionID, 2); err != nil {
+		t.Fatalf("PauseSubscription: %v", err)
+	}
+
+	pending, err := ListJobs(models.JobStatusPending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Type != models.JobTypeResumeSubscription {
+		t.Fatalf("pending jobs = %+v, want a single resume job", pending)
+	}
+	if until := time.Now().UTC().AddDate(0, 0, 14); pending[0].RunAt.Sub(until).Abs() > time.Minute {
+		t.Errorf("resume job runs at %s, want about %s", pending[0].RunAt, until)
+	}
+
+	if err := runJob(pending[0]); err != nil {
+		t.Fatalf("running the resume job: %v", err)
+	}
+
+	received := calls()
+	last := received[len(received)-1]
+	if last.Method != http.MethodDelete || last.Body != `{"tags":["paused"]}` {
+		t.Errorf("last request = %s %s, want the paused tag removed", last.Method, last.Body)
+	}
+	if found, _ := pauses.Get(canonicalEmail(email), &models.SubscriptionPause{}); found {
+		t.Error("the pause record is still there")
+	}
+}
@@ -0,0 +1,343 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/internal/store"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+var (
+	// ErrInvalidSlot is returned when a start time does not match an available slot
+	ErrInvalidSlot = errors.New("requested time is not a bookable slot")
+	// ErrSlotUnavailable is returned when a slot is already booked or held by someone else
+	ErrSlotUnavailable = errors.New("requested slot is no longer available")
+	// ErrHoldExpired is returned when a booking references an unknown or expired hold
+	ErrHoldExpired = errors.New("slot hold is unknown or expired")
+)
+
+// bookings stores both slot holds and confirmed bookings, so conflict detection
+// can be done in a single atomic update
+var bookings = store.NewCollection("bookings.json")
+
+// bookingWindow is a weekly availability window in the booking timezone
+type bookingWindow struct {
+	days  map[time.Weekday]bool
+	start time.Duration
+	end   time.Duration
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseBookingWindow parses a window such as "mon-fri 09:00-14:00" or "sat 10:00-12:00"
+func parseBookingWindow(window string) (bookingWindow, error) {
+	fields := strings.Fields(strings.ToLower(window))
+	if len(fields) != 2 {
+		return bookingWindow{}, fmt.Errorf("invalid booking window %q", window)
+	}
+
+	result := bookingWindow{days: map[time.Weekday]bool{}}
+
+	dayRange := strings.SplitN(fields[0], "-", 2)
+	first, ok := weekdays[dayRange[0]]
+	if !ok {
+		return bookingWindow{}, fmt.Errorf("invalid day in booking window %q", window)
+	}
+	last := first
+	if len(dayRange) == 2 {
+		if last, ok = weekdays[dayRange[1]]; !ok {
+			return bookingWindow{}, fmt.Errorf("invalid day in booking window %q", window)
+		}
+	}
+	for day := first; ; day = (day + 1) % 7 {
+		result.days[day] = true
+		if day == last {
+			break
+		}
+	}
+
+	hours := strings.SplitN(fields[1], "-", 2)
+	if len(hours) != 2 {
+		return bookingWindow{}, fmt.Errorf("invalid hours in booking window %q", window)
+	}
+	for i, target := range []*time.Duration{&result.start, &result.end} {
+		t, err := time.Parse("15:04", hours[i])
+		if err != nil {
+			return bookingWindow{}, fmt.Errorf("invalid hours in booking window %q", window)
+		}
+		*target = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	if result.end <= result.start {
+		return bookingWindow{}, fmt.Errorf("empty booking window %q", window)
+	}
+
+	return result, nil
+}
+
+// BookingLocation returns the timezone in which availability windows are defined
+func BookingLocation() *time.Location {
+	location, err := time.LoadLocation(conf().Booking.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// candidateSlots returns every slot defined by the availability windows between from and to,
+// honouring the minimum notice and the booking horizon. Existing bookings are not considered.
+func candidateSlots(from, to time.Time) ([]models.BookingSlot, error) {
+	var windows []bookingWindow
+	for _, definition := range conf().Booking.Windows {
+		window, err := parseBookingWindow(definition)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, window)
+	}
+
+	location := BookingLocation()
+	slotLength := time.Duration(conf().Booking.SlotMinutes) * time.Minute
+	now := time.Now()
+	earliest := now.Add(time.Duration(conf().Booking.MinNoticeHours) * time.Hour)
+	latest := now.AddDate(0, 0, conf().Booking.HorizonDays)
+
+	var slots []models.BookingSlot
+	from = from.In(location)
+	for day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, location); day.Before(to); day = day.AddDate(0, 0, 1) {
+		for _, window := range windows {
+			if !window.days[day.Weekday()] {
+				continue
+			}
+			for offset := window.start; offset+slotLength <= window.end; offset += slotLength {
+				// Build the wall-clock time so slots stay aligned across DST changes
+				start := time.Date(day.Year(), day.Month(), day.Day(), 0, int(offset/time.Minute), 0, 0, location)
+				if start.Before(earliest) || start.After(latest) || start.Before(from) || !start.Before(to) {
+					continue
+				}
+				slots = append(slots, models.BookingSlot{Start: start, End: start.Add(slotLength)})
+			}
+		}
+	}
+	return slots, nil
+}
+
+// activeBookings decodes the bookings that currently block a slot: confirmed ones and unexpired holds
+func activeBookings(docs map[string]json.RawMessage, now time.Time) ([]models.Booking, error) {
+	var active []models.Booking
+	for _, raw := range docs {
+		var booking models.Booking
+		if err := json.Unmarshal(raw, &booking); err != nil {
+			return nil, err
+		}
+		if booking.Status == models.BookingStatusHeld && booking.ExpiresAt != nil && now.After(*booking.ExpiresAt) {
+			continue
+		}
+		active = append(active, booking)
+	}
+	return active, nil
+}
+
+// overlaps reports whether two time ranges intersect
+func overlaps(startA, endA, startB, endB time.Time) bool {
+	return startA.Before(endB) && startB.Before(endA)
+}
+
+// AvailableSlots lists the free slots between from and the given number of days later
+func AvailableSlots(from time.Time, days int) ([]models.BookingSlot, error) {
+	candidates, err := candidateSlots(from, from.AddDate(0, 0, days))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var taken []models.Booking
+	err = bookings.Update(func(docs map[string]json.RawMessage) error {
+		pruneExpiredHolds(docs, now)
+		var decodeErr error
+		taken, decodeErr = activeBookings(docs, now)
+		return decodeErr
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slots := []models.BookingSlot{}
+	for _, slot := range candidates {
+		free := true
+		for _, booking := range taken {
+			if overlaps(slot.Start, slot.End, booking.Start, booking.End) {
+				free = false
+				break
+			}
+		}
+		if free {
+			slots = append(slots, slot)
+		}
+	}
+	return slots, nil
+}
+
+// findSlot returns the bookable slot starting exactly at start
+func findSlot(start time.Time) (models.BookingSlot, error) {
+	candidates, err := candidateSlots(start, start.Add(time.Minute))
+	if err != nil {
+		return models.BookingSlot{}, err
+	}
+	for _, slot := range candidates {
+		if slot.Start.Equal(start) {
+			return slot, nil
+		}
+	}
+	return models.BookingSlot{}, ErrInvalidSlot
+}
+
+// pruneExpiredHolds removes holds that expired so the collection does not grow without bound
+func pruneExpiredHolds(docs map[string]json.RawMessage, now time.Time) {
+	for id, raw := range docs {
+		var booking models.Booking
+		if json.Unmarshal(raw, &booking) != nil {
+			continue
+		}
+		if booking.Status == models.BookingStatusHeld && booking.ExpiresAt != nil && now.After(*booking.ExpiresAt) {
+			delete(docs, id)
+		}
+	}
+}
+
+// HoldSlot reserves a slot for a few minutes while the visitor completes the booking form
+func HoldSlot(start time.Time) (*models.Booking, error) {
+	slot, err := findSlot(start)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(conf().Booking.HoldMinutes) * time.Minute)
+	hold := models.Booking{
+		ID:        generateUniqueID(),
+		Status:    models.BookingStatusHeld,
+		Start:     slot.Start,
+		End:       slot.End,
+		ExpiresAt: &expiresAt,
+		CreatedAt: now.UTC(),
+	}
+
+	err = bookings.Update(func(docs map[string]json.RawMessage) error {
+		pruneExpiredHolds(docs, now)
+		active, err := activeBookings(docs, now)
+		if err != nil {
+			return err
+		}
+		for _, booking := range active {
+			if overlaps(hold.Start, hold.End, booking.Start, booking.End) {
+				return ErrSlotUnavailable
+			}
+		}
+
+		raw, err := json.Marshal(hold)
+		if err != nil {
+			return err
+		}
+		docs[hold.ID] = raw
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["SlotHeld"], map[string]string{
+		"holdId": hold.ID,
+		"start":  hold.Start.Format(time.RFC3339),
+	})
+	return &hold, nil
+}
+
+// ConfirmBooking books a slot, converting the visitor's hold if one is given, and emails
+// a calendar invite to both parties. The booking is kept even if the emails fail.
+func ConfirmBooking(request models.BookingRequest, start time.Time) (*models.Booking, error) {
+	slot, err := findSlot(start)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	booking := models.Booking{
+		ID:        generateUniqueID(),
+		Status:    models.BookingStatusConfirmed,
+		Start:     slot.Start,
+		End:       slot.End,
+		Name:      request.Name,
+		Email:     request.Email,
+		Notes:     request.Notes,
+		CreatedAt: now.UTC(),
+	}
+
+	err = bookings.Update(func(docs map[string]json.RawMessage) error {
+		pruneExpiredHolds(docs, now)
+
+		// Only an unexpired hold on the same slot can be converted; the ID of a confirmed
+		// booking must not let a second visitor overwrite it
+		if request.HoldID != "" {
+			raw, ok := docs[request.HoldID]
+			if !ok {
+				return ErrHoldExpired
+			}
+			var hold models.Booking
+			if err := json.Unmarshal(raw, &hold); err != nil {
+				return err
+			}
+			if hold.Status != models.BookingStatusHeld || hold.ExpiresAt == nil || now.After(*hold.ExpiresAt) ||
+				!hold.Start.Equal(booking.Start) {
+				return ErrHoldExpired
+			}
+			booking.ID = request.HoldID
+		}
+
+		active, err := activeBookings(docs, now)
+		if err != nil {
+			return err
+		}
+		for _, existing := range active {
+			if request.HoldID != "" && existing.ID == request.HoldID {
+				continue
+			}
+			if overlaps(booking.Start, booking.End, existing.Start, existing.End) {
+				return ErrSlotUnavailable
+			}
+		}
+
+		raw, err := json.Marshal(booking)
+		if err != nil {
+			return err
+		}
+		docs[booking.ID] = raw
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["BookingConfirmed"], map[string]string{
+		"bookingId": booking.ID,
+		"email":     booking.Email,
+		"start":     booking.Start.Format(time.RFC3339),
+	})
+
+	if err := SendBookingInvites(booking); err != nil {
+		logger.LogFunction("warn", constants.Messages.Backend.Warn["EmailDeliveryIssue"], map[string]string{
+			"bookingId": booking.ID,
+			"error":     err.Error(),
+		})
+	}
+
+	return &booking, nil
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+)
+
+// useTestBookingConfig opens every day for bookings without notice and disables the invite emails
+func useTestBookingConfig(t *testing.T) {
+	t.Helper()
+	useTestConfig(t)
+	conf().Booking.Timezone = "UTC"
+	conf().Booking.Windows = []string{"sun-sat 00:00-23:15"}
+	conf().Booking.SlotMinutes = 45
+	conf().Booking.HoldMinutes = 10
+	conf().Booking.HorizonDays = 30
+	conf().Booking.MinNoticeHours = 0
+	conf().Email.Host = ""
+}
+
+func TestConfirmBookingRejectsConfirmedBookingAsHold(t *testing.T) {
+	useTestBookingConfig(t)
+
+	slots, err := AvailableSlots(time.Now().Add(24*time.Hour), 1)
+	if err != nil || len(slots) == 0 {
+		t.Fatalf("AvailableSlots() = %v, %v", slots, err)
+	}
+	start := slots[0].Start
+
+	hold, err := HoldSlot(start)
+	if err != nil {
+		t.Fatalf("HoldSlot() failed: %v", err)
+	}
+	first := models.BookingRequest{Name: "Ana", Email: "ana@example.com", HoldID: hold.ID}
+	if _, err := ConfirmBooking(first, start); err != nil {
+		t.Fatalf("ConfirmBooking() failed: %v", err)
+	}
+
+	// Resubmitting the ID of the confirmed booking must not take over the slot
+	second := models.BookingRequest{Name: "Eve", Email: "eve@example.com", HoldID: hold.ID}
+	if _, err := ConfirmBooking(second, start); !errors.Is(err, ErrHoldExpired) {
+		t.Fatalf("ConfirmBooking() with a confirmed booking ID = %v, want ErrHoldExpired", err)
+	}
+
+	var stored models.Booking
+	if _, err := bookings.Get(hold.ID, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Email != first.Email || stored.Status != models.BookingStatusConfirmed {
+		t.Errorf("stored booking = %+v, want the first confirmation", stored)
+	}
+}
+
+func TestConfirmBookingRejectsExpiredHold(t *testing.T) {
+	useTestBookingConfig(t)
+
+	slots, err := AvailableSlots(time.Now().Add(24*time.Hour), 1)
+	if err != nil || len(slots) == 0 {
+		t.Fatalf("AvailableSlots() = %v, %v", slots, err)
+	}
+	start := slots[0].Start
+
+	expired := time.Now().Add(-time.Minute)
+	hold := models.Booking{ID: "hold-1", Status: models.BookingStatusHeld, Start: start, End: slots[0].End, ExpiresAt: &expired}
+	err = bookings.Update(func(docs map[string]json.RawMessage) error {
+		raw, err := json.Marshal(hold)
+		docs[hold.ID] = raw
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := models.BookingRequest{Name: "Ana", Email: "ana@example.com", HoldID: hold.ID}
+	if _, err := ConfirmBooking(request, start); !errors.Is(err, ErrHoldExpired) {
+		t.Fatalf("ConfirmBooking() with an expired hold = %v, want ErrHoldExpired", err)
+	}
+}
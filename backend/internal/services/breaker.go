@@ -0,0 +1,173 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+// ErrCircuitOpen is returned instead of sending a request to a provider API that keeps failing
+var ErrCircuitOpen = errors.New("newsletter provider circuit is open")
+
+// circuitBreaker tracks the requests sent to one provider API host. After
+// NEWSLETTER_BREAKER_THRESHOLD consecutive failures it opens and rejects requests until the
+// cooldown is over; then a single probe request decides whether it closes or opens again.
+type circuitBreaker struct {
+	host      string
+	state     models.CircuitState
+	failures  int
+	probing   bool
+	requests  int64
+	rejected  int64
+	trips     int64
+	lastError string
+	openedAt  time.Time
+}
+
+var (
+	breakersMu sync.Mutex
+	breakers   = map[string]*circuitBreaker{}
+)
+
+// providerTransport sends provider API requests through the circuit breaker of their host
+type providerTransport struct{}
+
+// providerClient returns the HTTP client for provider APIs, which times out and fails fast
+// while the circuit of the host is open
+func providerClient() *http.Client {
+	return &http.Client{
+		Timeout:   time.Duration(conf().Newsletter.TimeoutSeconds) * time.Second,
+		Transport: providerTransport{},
+	}
+}
+
+// RoundTrip sends the request unless the circuit of its host is open. Network errors, rate
+// limits and server errors count as failures; any other answer closes the circuit.
+func (providerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	breakersMu.Lock()
+	breaker, ok := breakers[req.URL.Host]
+	if !ok {
+		breaker = &circuitBreaker{host: req.URL.Host, state: models.CircuitClosed}
+		breakers[req.URL.Host] = breaker
+	}
+	allowed := breaker.allow(time.Now())
+	breakersMu.Unlock()
+
+	if !allowed {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, ErrCircuitOpen
+	}
+
+	resp, err := http.DefaultTransport.RoundTrip(req)
+
+	failure := err
+	if err == nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError) {
+		failure = fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	breakersMu.Lock()
+	breaker.record(failure, time.Now())
+	breakersMu.Unlock()
+	return resp, err
+}
+
+// allow reports whether a request may be sent, letting a single probe through once the
+// cooldown of an open circuit is over. breakersMu must be held.
+func (b *circuitBreaker) allow(now time.Time) bool {
+	switch b.state {
+	case models.CircuitOpen:
+		if now.Before(b.retryAt()) {
+			b.rejected++
+			return false
+		}
+		b.state = models.CircuitHalfOpen
+		fallthrough
+	case models.CircuitHalfOpen:
+		if b.probing {
+			b.rejected++
+			return false
+		}
+		b.probing = true
+	}
+	b.requests++
+	return true
+}
+
+// record updates the circuit with the outcome of a request. breakersMu must be held.
+func (b *circuitBreaker) record(failure error, now time.Time) {
+	b.probing = false
+
+	if failure == nil {
+		if b.state != models.CircuitClosed {
+			logger.LogFunction("info", constants.Messages.Backend.Info["CircuitClosed"], b.host)
+		}
+		b.state = models.CircuitClosed
+		b.failures = 0
+		b.lastError = ""
+		return
+	}
+
+	b.failures++
+	b.lastError = failure.Error()
+	if b.state == models.CircuitHalfOpen || b.failures >= conf().Newsletter.BreakerThreshold {
+		if b.state != models.CircuitOpen {
+			b.trips++
+			logger.LogFunction("warn", constants.Messages.Backend.Warn["CircuitOpened"], map[string]interface{}{
+				"host":     b.host,
+				"failures": b.failures,
+				"error":    b.lastError,
+			})
+		}
+		b.state = models.CircuitOpen
+		b.openedAt = now
+	}
+}
+
+// retryAt returns when an open circuit lets the next probe through
+func (b *circuitBreaker) retryAt() time.Time {
+	return b.openedAt.Add(time.Duration(conf().Newsletter.BreakerCooldownSeconds) * time.Second)
+}
+
+// IsProviderUnavailable reports whether an error means the newsletter provider could not be
+// reached: the circuit is open, the request timed out or the connection failed. Answers of
+// the provider, errors included, are not.
+func IsProviderUnavailable(err error) bool {
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// CircuitStatuses returns the circuit of every provider API host contacted since startup
+func CircuitStatuses() []models.CircuitStatus {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+
+	statuses := make([]models.CircuitStatus, 0, len(breakers))
+	for _, b := range breakers {
+		status := models.CircuitStatus{
+			Host:      b.host,
+			State:     b.state,
+			Failures:  b.failures,
+			Requests:  b.requests,
+			Rejected:  b.rejected,
+			Trips:     b.trips,
+			LastError: b.lastError,
+		}
+		if b.state != models.CircuitClosed {
+			openedAt, retryAt := b.openedAt.UTC(), b.retryAt().UTC()
+			status.OpenedAt, status.RetryAt = &openedAt, &retryAt
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Host < statuses[j].Host })
+	return statuses
+}
@@ -0,0 +1,413 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/internal/store"
+	"github.com/mlorentedev/mlorente-backend/internal/validation"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+// exportColumns are the CSV export columns. The leading ones match the import columns,
+// so an export can be imported again.
+var exportColumns = []string{
+	"email", "tags", "utm_source", "utm_medium", "utm_campaign", "referring_site", "id", "status", "created",
+}
+
+var (
+	// ErrInvalidImport is returned when an import file cannot be read as a subscribers CSV
+	ErrInvalidImport = errors.New("invalid import file")
+	// ErrImportRunning is returned when the same import file is already being imported
+	ErrImportRunning = errors.New("import is already running")
+)
+
+// imports stores the report of every import, keyed by import ID
+var imports = store.NewCollection("imports.json")
+
+var (
+	runningImportsMu sync.Mutex
+	runningImports   = map[string]bool{}
+)
+
+// importPlan holds the rows of an import file that passed validation, along with its report
+type importPlan struct {
+	report *models.ImportReport
+	rows   []models.ImportRow
+}
+
+// importProgress returns the log of the rows already processed by an import
+func importProgress(id string) *store.Log {
+	return store.NewLog("import-" + id + ".jsonl")
+}
+
+// planImport parses a subscribers CSV and validates and dedupes its rows. The file needs a
+// header row with an "email" column; "tags" (separated by ";" or "|"), the UTM fields,
+// "referring_site" and "landing_page" are optional. The import ID is derived from the
+// content, so importing the same file again resumes it.
+func planImport(data []byte) (*importPlan, error) {
+	sum := sha256.Sum256(data)
+	plan := &importPlan{report: &models.ImportReport{
+		ID:      hex.EncodeToString(sum[:8]),
+		Invalid: []models.ImportRowError{},
+		Failed:  []models.ImportRowError{},
+	}}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: the file is empty", ErrInvalidImport)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, fmt.Errorf("%w: missing email column", ErrInvalidImport)
+	}
+
+	seen := map[string]bool{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := models.ImportRow{
+			Line:  line,
+			Email: field("email"),
+			Tags: strings.FieldsFunc(field("tags"), func(r rune) bool {
+				return r == ';' || r == '|'
+			}),
+			Attribution: models.Attribution{
+				UtmSource:     field("utm_source"),
+				UtmMedium:     field("utm_medium"),
+				UtmCampaign:   field("utm_campaign"),
+				UtmTerm:       field("utm_term"),
+				UtmContent:    field("utm_content"),
+				ReferringSite: field("referring_site"),
+				LandingPage:   field("landing_page"),
+			},
+		}
+		plan.report.Rows++
+
+		var errs []models.FieldError
+		errs = append(errs, validation.ValidateEmail("email", &row.Email)...)
+		errs = append(errs, validation.ValidateTags("tags", &row.Tags, AllowedTags())...)
+		validation.SanitizeAttribution(&row.Attribution)
+		if len(errs) > 0 {
+			plan.report.Invalid = append(plan.report.Invalid, models.ImportRowError{
+				Line:   row.Line,
+				Email:  strings.TrimSpace(row.Email),
+				Errors: errs,
+			})
+			continue
+		}
+
+		// Providers treat addresses case-insensitively
+		key := strings.ToLower(row.Email)
+		if seen[key] {
+			plan.report.Duplicates++
+			continue
+		}
+		seen[key] = true
+		plan.rows = append(plan.rows, row)
+	}
+
+	plan.report.Valid = len(plan.rows)
+	return plan, nil
+}
+
+// claimImport marks an import as running and reports whether it was not running already
+func claimImport(id string) bool {
+	runningImportsMu.Lock()
+	defer runningImportsMu.Unlock()
+
+	if runningImports[id] {
+		return false
+	}
+	runningImports[id] = true
+	return true
+}
+
+// releaseImport marks an import as no longer running
+func releaseImport(id string) {
+	runningImportsMu.Lock()
+	defer runningImportsMu.Unlock()
+
+	delete(runningImports, id)
+}
+
+// saveImport stores the current report of an import. A failed write is logged and does not stop the import.
+func saveImport(report *models.ImportReport) {
+	if err := imports.Put(report.ID, report); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["ImportError"], err.Error())
+	}
+}
+
+// ImportSubscribers validates a subscribers CSV and, unless dryRun is set, subscribes every
+// valid row with ProcessSubscription, paced by the configured import rate. Rows imported by
+// an earlier run of the same file are skipped. When ctx is cancelled the import stops and
+// can be resumed later.
+func ImportSubscribers(ctx context.Context, actor models.Actor, data []byte, dryRun bool) (*models.ImportReport, error) {
+	plan, err := planImport(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		plan.report.Status = models.ImportStatusValidated
+		plan.report.DryRun = true
+		return plan.report, nil
+	}
+
+	if !claimImport(plan.report.ID) {
+		return nil, ErrImportRunning
+	}
+	defer releaseImport(plan.report.ID)
+
+	return runImport(ctx, actor, plan)
+}
+
+// StartImport validates a subscribers CSV and imports it in the background. It returns the
+// report as the import starts; GetImport follows its progress.
+func StartImport(actor models.Actor, data []byte) (*models.ImportReport, error) {
+	plan, err := planImport(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if !claimImport(plan.report.ID) {
+		return nil, ErrImportRunning
+	}
+
+	now := time.Now().UTC()
+	plan.report.Status = models.ImportStatusRunning
+	plan.report.StartedAt = &now
+	saveImport(plan.report)
+	started := *plan.report
+
+	go func() {
+		defer releaseImport(plan.report.ID)
+		runImport(context.Background(), actor, plan)
+	}()
+	return &started, nil
+}
+
+// GetImport returns the report of an import and whether it exists
+func GetImport(id string) (*models.ImportReport, bool, error) {
+	var report models.ImportReport
+	found, err := imports.Get(id, &report)
+	if err != nil || !found {
+		return nil, found, err
+	}
+	return &report, true, nil
+}
+
+// runImport subscribes the rows of an import plan that were not imported before,
+// recording each processed row in the progress log of the import
+func runImport(ctx context.Context, actor models.Actor, plan *importPlan) (*models.ImportReport, error) {
+	report := plan.report
+
+	imported := map[string]bool{}
+	progress := importProgress(report.ID)
+	err := progress.Scan(func(raw json.RawMessage) error {
+		var entry models.ImportProgress
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return err
+		}
+		if entry.Imported {
+			imported[strings.ToLower(entry.Email)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return finishImport(report, err)
+	}
+
+	if report.StartedAt == nil {
+		now := time.Now().UTC()
+		report.StartedAt = &now
+	}
+	report.Status = models.ImportStatusRunning
+	saveImport(report)
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["ImportStarted"], map[string]interface{}{
+		"id":    report.ID,
+		"rows":  report.Valid,
+		"actor": actor,
+	})
+
+	interval := time.Minute / time.Duration(conf().Bulk.ImportRatePerMinute)
+	var last time.Time
+	for _, row := range plan.rows {
+		if imported[strings.ToLower(row.Email)] {
+			report.AlreadyImported++
+			continue
+		}
+
+		// Pace the subscriptions to stay within the provider rate limits
+		wait := time.Duration(0)
+		if !last.IsZero() {
+			wait = interval - time.Since(last)
+		}
+		select {
+		case <-ctx.Done():
+			return finishImport(report, ctx.Err())
+		case <-time.After(wait):
+		}
+		last = time.Now()
+
+		entry := models.ImportProgress{Line: row.Line, Email: row.Email}
+		result, err := ProcessSubscription(actor, row.Email, row.Attribution, row.Tags)
+		switch {
+		case err != nil:
+			entry.Error = err.Error()
+		case !result.Success:
+			entry.Error = result.Message
+		default:
+			entry.Imported = true
+		}
+		entry.Time = time.Now().UTC()
+
+		if entry.Imported {
+			report.Imported++
+		} else {
+			report.Failed = append(report.Failed, models.ImportRowError{
+				Line:  row.Line,
+				Email: row.Email,
+				Error: entry.Error,
+			})
+		}
+
+		if err := progress.Append(entry); err != nil {
+			return finishImport(report, err)
+		}
+		saveImport(report)
+	}
+
+	return finishImport(report, nil)
+}
+
+// finishImport stores the final report of an import, interrupted when err is not nil
+func finishImport(report *models.ImportReport, err error) (*models.ImportReport, error) {
+	now := time.Now().UTC()
+	report.FinishedAt = &now
+	report.Status = models.ImportStatusCompleted
+	if err != nil {
+		report.Status = models.ImportStatusInterrupted
+		report.Error = err.Error()
+		logger.LogFunction("error", constants.Messages.Backend.Error["ImportError"], map[string]string{
+			"id":    report.ID,
+			"error": err.Error(),
+		})
+	}
+	saveImport(report)
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["ImportCompleted"], map[string]interface{}{
+		"id":              report.ID,
+		"status":          report.Status,
+		"imported":        report.Imported,
+		"alreadyImported": report.AlreadyImported,
+		"failed":          len(report.Failed),
+	})
+	return report, err
+}
+
+// ExportSubscribers walks the publication subscriptions matching the filter and writes them
+// to w as CSV or JSON Lines, returning how many were written
+func ExportSubscribers(w io.Writer, format models.ExportFormat, filter models.SubscriptionFilter) (int, error) {
+	var write func(subscriber models.Subscriber) error
+	var flush func() error
+
+	switch format {
+	case models.ExportFormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(exportColumns); err != nil {
+			return 0, err
+		}
+		write = func(subscriber models.Subscriber) error {
+			created := ""
+			if subscriber.Created > 0 {
+				created = time.Unix(subscriber.Created, 0).UTC().Format(time.RFC3339)
+			}
+			return writer.Write([]string{
+				subscriber.Email,
+				strings.Join(subscriber.Tags, ";"),
+				subscriber.UtmSource,
+				subscriber.UtmMedium,
+				subscriber.UtmCampaign,
+				subscriber.ReferringSite,
+				subscriber.ID,
+				subscriber.Status,
+				created,
+			})
+		}
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	case models.ExportFormatJSONL:
+		encoder := json.NewEncoder(w)
+		write = func(subscriber models.Subscriber) error {
+			return encoder.Encode(subscriber)
+		}
+		flush = func() error { return nil }
+	default:
+		return 0, fmt.Errorf("unknown export format %q", format)
+	}
+
+	count := 0
+	err := EachSubscription(filter, func(subscriber models.Subscriber) error {
+		if err := write(subscriber); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+
+	if err := flush(); err != nil {
+		return count, err
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["SubscribersExported"], map[string]interface{}{
+		"format": format,
+		"status": filter.Status,
+		"tags":   filter.Tags,
+		"count":  count,
+	})
+	return count, nil
+}
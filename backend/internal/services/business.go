@@ -2,7 +2,8 @@ package services
 
 import (
 	"fmt"
-	"regexp"
+	"html"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,10 +13,21 @@ import (
 	"github.com/mlorentedev/mlorente-backend/pkg/logger"
 )
 
-// IsValidEmailFormat determina si un email tiene formato válido
-func IsValidEmailFormat(email string) bool {
-	re := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-	return re.MatchString(email)
+// canonicalEmail returns the form under which an email is stored and compared: trimmed and
+// lowercased, as validation.NormalizeEmail leaves it. Records written before addresses were
+// fully lowercased, or emails coming from providers, are brought to the same form.
+func canonicalEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// sameEmail reports whether two emails are the same address in canonical form
+func sameEmail(a, b string) bool {
+	return canonicalEmail(a) == canonicalEmail(b)
+}
+
+// AllowedTags returns the configured tag whitelist; an empty list accepts any well-formed tag
+func AllowedTags() []string {
+	return conf().Newsletter.AllowedTags
 }
 
 // GetTagsForNewSubscriber determina qué tags aplicar a un nuevo suscriptor
@@ -47,7 +59,7 @@ func GetEmailDelay(minutes int) int {
 
 // ValidateEmailConfiguration validates that email configuration exists
 func ValidateEmailConfiguration() bool {
-	if conf.Email.Host == "" || conf.Email.Port == "" || conf.Email.User == "" || conf.Email.Pass == "" {
+	if conf().Email.Host == "" || conf().Email.Port == "" || conf().Email.User == "" || conf().Email.Pass == "" {
 		logger.LogFunction("error", constants.Messages.Backend.Error["EmailConfigMissing"], nil)
 		return false
 	}
@@ -92,6 +104,213 @@ func generateResourceEmailHTML(options models.ResourceEmailOptions) string {
 		options.ResourceLink,
 		options.ResourceLink,
 		year,
-		conf.Site.URL,
-		conf.Site.URL)
+		conf().Site.URL,
+		conf().Site.URL)
+}
+
+// generateContactEmailHTML generates HTML for a contact message forwarded to the site mailbox
+func generateContactEmailHTML(request models.ContactRequest) string {
+	return fmt.Sprintf(`
+	<html lang="es">
+	<head>
+		<meta charset="UTF-8">
+		<title>Nuevo mensaje de contacto</title>
+	</head>
+	<body>
+		<div>
+		<p><strong>Nombre:</strong> %s</p>
+		<p><strong>Email:</strong> %s</p>
+		<p><strong>Asunto:</strong> %s</p>
+		<br>
+		<p>%s</p>
+		</div>
+	</body>
+	</html>
+	`, html.EscapeString(request.Name),
+		html.EscapeString(request.Email),
+		html.EscapeString(request.Subject),
+		formatMessageHTML(request.Message))
+}
+
+// generateContactAcknowledgementHTML generates HTML for the automatic reply to a contact message.
+// It is the same for everyone and holds nothing the sender typed, so that the form cannot be used
+// to send arbitrary text to someone else's address.
+func generateContactAcknowledgementHTML() string {
+	year := time.Now().Year()
+
+	return fmt.Sprintf(`
+	<html lang="es">
+	<head>
+		<meta charset="UTF-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1.0">
+		<title>He recibido tu mensaje</title>
+	</head>
+	<body>
+		<div>
+		<p>Hola,</p>
+		<br>
+		<p>He recibido tu mensaje y te responderé lo antes posible.</p>
+		<br>
+		<p>Uso es todo.</p>
+		<p>Manu</p>
+		<br>
+		</div>
+	</body>
+	<footer>
+		<p>© %d <a href="%s">%s</a></p>
+	</footer>
+	</html>
+	`, year,
+		conf().Site.URL,
+		conf().Site.URL)
+}
+
+// formatMessageHTML escapes a plain text message and keeps its line breaks
+func formatMessageHTML(message string) string {
+	return strings.ReplaceAll(html.EscapeString(message), "\n", "<br>")
+}
+
+// generateBookingEmailHTML generates HTML for the email that carries a booking invite
+func generateBookingEmailHTML(booking models.Booking, location *time.Location) string {
+	year := time.Now().Year()
+
+	return fmt.Sprintf(`
+	<html lang="es">
+	<head>
+		<meta charset="UTF-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1.0">
+		<title>Reserva confirmada</title>
+	</head>
+	<body>
+		<div>
+		<p>Reserva confirmada para %s.</p>
+		<p><strong>Inicio:</strong> %s (%s)</p>
+		<p><strong>Fin:</strong> %s (%s)</p>
+		<br>
+		<p>Encontrarás la invitación adjunta para añadirla a tu calendario.</p>
+		<br>
+		<p>Uso es todo.</p>
+		<p>Manu</p>
+		<br>
+		</div>
+	</body>
+	<footer>
+		<p>© %d <a href="%s">%s</a></p>
+	</footer>
+	</html>
+	`, html.EscapeString(booking.Name),
+		booking.Start.In(location).Format("02/01/2006 15:04"), location.String(),
+		booking.End.In(location).Format("02/01/2006 15:04"), location.String(),
+		year,
+		conf().Site.URL,
+		conf().Site.URL)
+}
+
+// generateTestEmailHTML generates HTML for the email used to check the SMTP configuration
+func generateTestEmailHTML() string {
+	year := time.Now().Year()
+
+	return fmt.Sprintf(`
+	<html lang="es">
+	<head>
+		<meta charset="UTF-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1.0">
+		<title>Email de prueba</title>
+	</head>
+	<body>
+		<div>
+		<p>Este es un email de prueba enviado el %s para comprobar la configuración del servidor de correo.</p>
+		<br>
+		<p>Si lo estás leyendo, el envío funciona.</p>
+		<br>
+		</div>
+	</body>
+	<footer>
+		<p>© %d <a href="%s">%s</a></p>
+	</footer>
+	</html>
+	`, time.Now().UTC().Format(time.RFC1123),
+		year,
+		conf().Site.URL,
+		conf().Site.URL)
+}
+
+// generatePreferencesLinkEmailHTML generates HTML for the email that carries a preference center link
+func generatePreferencesLinkEmailHTML(link string) string {
+	year := time.Now().Year()
+
+	return fmt.Sprintf(`
+	<html lang="es">
+	<head>
+		<meta charset="UTF-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1.0">
+		<title>Gestiona tus preferencias</title>
+	</head>
+	<body>
+		<div>
+		<p>Desde este enlace puedes elegir qué temas recibes o pausar los envíos unas semanas: <a href="%s">Gestionar preferencias</a></p>
+		<br>
+		<p>Si el enlace no funciona, copia esta URL: %s</p>
+		<br>
+		<p>Si no lo has pedido tú, puedes ignorar este mensaje.</p>
+		<br>
+		<p>Uso es todo.</p>
+		<p>Manu</p>
+		<br>
+		</div>
+	</body>
+	<footer>
+		<p>© %d <a href="%s">%s</a></p>
+	</footer>
+	</html>
+	`, html.EscapeString(link),
+		html.EscapeString(link),
+		year,
+		conf().Site.URL,
+		conf().Site.URL)
+}
+
+// generatePrivacyLinkEmailHTML generates HTML for the email that confirms a data export or erasure request
+func generatePrivacyLinkEmailHTML(title string, action models.PrivacyAction, link string) string {
+	year := time.Now().Year()
+
+	description := "Desde este enlace puedes descargar en formato JSON todos los datos que guardo sobre ti"
+	linkText := "Descargar mis datos"
+	if action == models.PrivacyActionErase {
+		description = "Desde este enlace puedes confirmar el borrado de tu suscripción y de todos los datos que guardo sobre ti. No se puede deshacer"
+		linkText = "Borrar mis datos"
+	}
+
+	return fmt.Sprintf(`
+	<html lang="es">
+	<head>
+		<meta charset="UTF-8">
+		<meta name="viewport" content="width=device-width, initial-scale=1.0">
+		<title>%s</title>
+	</head>
+	<body>
+		<div>
+		<p>%s: <a href="%s">%s</a></p>
+		<br>
+		<p>El enlace caduca en 24 horas. Si no funciona, copia esta URL: %s</p>
+		<br>
+		<p>Si no lo has pedido tú, puedes ignorar este mensaje.</p>
+		<br>
+		<p>Uso es todo.</p>
+		<p>Manu</p>
+		<br>
+		</div>
+	</body>
+	<footer>
+		<p>© %d <a href="%s">%s</a></p>
+	</footer>
+	</html>
+	`, title,
+		description,
+		html.EscapeString(link),
+		linkText,
+		html.EscapeString(link),
+		year,
+		conf().Site.URL,
+		conf().Site.URL)
 }
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+// buttondownAPI is the base URL of the Buttondown v1 API
+const buttondownAPI = "https://api.buttondown.email/v1"
+
+// buttondownProvider keeps the list in a Buttondown newsletter. Buttondown replaces the whole
+// tag list on update, so tag changes read the subscriber first.
+type buttondownProvider struct{}
+
+// buttondownSubscriber is a subscriber of a Buttondown newsletter
+type buttondownSubscriber struct {
+	ID             string            `json:"id"`
+	Email          string            `json:"email"`
+	EmailAddress   string            `json:"email_address"`
+	Tags           []string          `json:"tags"`
+	SubscriberType string            `json:"subscriber_type"`
+	CreationDate   string            `json:"creation_date"`
+	ReferrerURL    string            `json:"referrer_url"`
+	UtmSource      string            `json:"utm_source"`
+	UtmMedium      string            `json:"utm_medium"`
+	UtmCampaign    string            `json:"utm_campaign"`
+	Metadata       map[string]string `json:"metadata"`
+}
+
+// subscriber converts a Buttondown subscriber to the common subscriber model
+func (s buttondownSubscriber) subscriber() *models.Subscriber {
+	subscriber := &models.Subscriber{
+		ID:            s.ID,
+		Email:         s.EmailAddress,
+		Tags:          s.Tags,
+		Status:        "active",
+		UtmSource:     s.UtmSource,
+		UtmMedium:     s.UtmMedium,
+		UtmCampaign:   s.UtmCampaign,
+		ReferringSite: s.ReferrerURL,
+	}
+	if subscriber.Email == "" {
+		subscriber.Email = s.Email
+	}
+	if subscriber.Tags == nil {
+		subscriber.Tags = []string{}
+	}
+	switch s.SubscriberType {
+	case "unactivated":
+		subscriber.Status = "pending"
+	case "unsubscribed", "removed":
+		subscriber.Status = "inactive"
+	}
+	if created, err := time.Parse(time.RFC3339, s.CreationDate); err == nil {
+		subscriber.Created = created.Unix()
+	}
+	return subscriber
+}
+
+// Name identifies the provider
+func (buttondownProvider) Name() string {
+	return "buttondown"
+}
+
+// authorize sets the token Buttondown expects
+func (buttondownProvider) authorize(req *http.Request) {
+	req.Header.Set("Authorization", "Token "+conf().Buttondown.APIKey)
+}
+
+// get returns a subscriber by ID or email, or nil when there is none
+func (p buttondownProvider) get(idOrEmail string) (*buttondownSubscriber, error) {
+	status, body, err := providerRequest("GET", buttondownAPI+"/subscribers/"+url.PathEscape(idOrEmail), nil, p.authorize)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if !isSuccess(status) {
+		return nil, providerStatusError(p.Name(), "find subscriber", status, body)
+	}
+
+	var subscriber buttondownSubscriber
+	if err := json.Unmarshal(body, &subscriber); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["UnmarshalError"], err.Error())
+		return nil, err
+	}
+	return &subscriber, nil
+}
+
+// FindSubscriber returns the subscriber of an email. Unsubscribed subscribers are not on the list.
+func (p buttondownProvider) FindSubscriber(email string) (*models.Subscriber, error) {
+	found, err := p.get(email)
+	if err != nil || found == nil {
+		return nil, err
+	}
+	if found.SubscriberType == "unsubscribed" || found.SubscriberType == "removed" {
+		return nil, nil
+	}
+	return found.subscriber(), nil
+}
+
+// CreateSubscriber adds an email with its campaign attribution; the attributes Buttondown has
+// no field for are kept in the metadata
+func (p buttondownProvider) CreateSubscriber(email string, attribution models.Attribution) (*models.Subscriber, error) {
+	metadata := map[string]string{}
+	for name, value := range map[string]string{
+		"utm_term":     attribution.UtmTerm,
+		"utm_content":  attribution.UtmContent,
+		"landing_page": attribution.LandingPage,
+	} {
+		if value != "" {
+			metadata[name] = value
+		}
+	}
+	data := map[string]interface{}{
+		"email_address": email,
+		"referrer_url":  attribution.ReferringSite,
+		"utm_source":    attribution.UtmSource,
+		"utm_medium":    attribution.UtmMedium,
+		"utm_campaign":  attribution.UtmCampaign,
+		"metadata":      metadata,
+	}
+
+	status, body, err := providerRequest("POST", buttondownAPI+"/subscribers", data, p.authorize)
+	if err != nil {
+		return nil, err
+	}
+	if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+		return nil, providerStatusError(p.Name(), "create subscriber", status, body)
+	}
+	if !isSuccess(status) {
+		logger.LogFunction("error", constants.Messages.Backend.Error["CreateSubscriberError"], string(body))
+		return nil, nil
+	}
+
+	var created buttondownSubscriber
+	if err := json.Unmarshal(body, &created); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["UnmarshalError"], err.Error())
+		return nil, err
+	}
+	return created.subscriber(), nil
+}
+
+// setTags replaces the tags of a subscriber with the result of update on the current ones
+func (p buttondownProvider) setTags(subscriberID string, update func(tags []string) []string) error {
+	current, err := p.get(subscriberID)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return providerStatusError(p.Name(), "update tags", http.StatusNotFound, nil)
+	}
+
+	data := map[string][]string{"tags": update(current.Tags)}
+	status, body, err := providerRequest("PATCH", buttondownAPI+"/subscribers/"+url.PathEscape(subscriberID), data, p.authorize)
+	if err != nil {
+		return err
+	}
+	if !isSuccess(status) {
+		return providerStatusError(p.Name(), "update tags", status, body)
+	}
+	return nil
+}
+
+// AddTag adds a tag to a subscriber
+func (p buttondownProvider) AddTag(subscriberID, tag string) error {
+	return p.AddTags(subscriberID, []string{tag})
+}
+
+// AddTags adds several tags to a subscriber with a single update
+func (p buttondownProvider) AddTags(subscriberID string, added []string) error {
+	return p.setTags(subscriberID, func(tags []string) []string {
+		for _, tag := range added {
+			if !hasTags(tags, []string{tag}) {
+				tags = append(tags, tag)
+			}
+		}
+		return tags
+	})
+}
+
+// RemoveTag removes a tag from a subscriber
+func (p buttondownProvider) RemoveTag(subscriberID, tag string) error {
+	return p.setTags(subscriberID, func(tags []string) []string {
+		kept := []string{}
+		for _, current := range tags {
+			if !strings.EqualFold(current, tag) {
+				kept = append(kept, current)
+			}
+		}
+		return kept
+	})
+}
+
+// DeleteSubscriber deletes the subscriber, which Buttondown treats as an unsubscribe
+func (p buttondownProvider) DeleteSubscriber(subscriber models.Subscriber) error {
+	status, body, err := providerRequest("DELETE", buttondownAPI+"/subscribers/"+url.PathEscape(subscriber.ID), nil, p.authorize)
+	if err != nil {
+		return err
+	}
+	if !isSuccess(status) && status != http.StatusNotFound {
+		return providerStatusError(p.Name(), "delete subscriber", status, body)
+	}
+	return nil
+}
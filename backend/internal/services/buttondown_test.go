@@ -0,0 +1,97 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+)
+
+const buttondownSubscriberID = "7c6b0f2e-8f6e-4b2a-9d1c-3e4f5a6b7c8d"
+
+// fakeButtondown points the Buttondown API at the recorded routes
+func fakeButtondown(t *testing.T, routes map[string]recordedRoute) func() []providerCall {
+	calls := fakeProviderAPI(t, "buttondown", recordedAPI(t, routes))
+	conf().Buttondown.APIKey = "buttondown-key"
+	return calls
+}
+
+func TestButtondownFindSubscriber(t *testing.T) {
+	calls := fakeButtondown(t, map[string]recordedRoute{
+		"GET /v1/subscribers/ana@example.com": {http.StatusOK, "buttondown/subscriber.json"},
+		"GET /v1/subscribers/bob@example.com": {http.StatusOK, "buttondown/subscriber_unsubscribed.json"},
+		"GET /v1/subscribers/eva@example.com": {http.StatusNotFound, "buttondown/not_found.json"},
+	})
+
+	subscriber, err := (buttondownProvider{}).FindSubscriber("ana@example.com")
+	if err != nil {
+		t.Fatalf("FindSubscriber: %v", err)
+	}
+	if subscriber == nil || subscriber.ID != buttondownSubscriberID || subscriber.Status != "active" || len(subscriber.Tags) != 2 || subscriber.ReferringSite != "https://example.org/" {
+		t.Errorf("subscriber = %+v", subscriber)
+	}
+	if got := calls()[0].Header.Get("Authorization"); got != "Token buttondown-key" {
+		t.Errorf("Authorization = %q", got)
+	}
+
+	for _, email := range []string{"bob@example.com", "eva@example.com"} {
+		if subscriber, err := (buttondownProvider{}).FindSubscriber(email); err != nil || subscriber != nil {
+			t.Errorf("%s: subscriber = %+v, err = %v; want neither", email, subscriber, err)
+		}
+	}
+}
+
+func TestButtondownCreateSubscriber(t *testing.T) {
+	fakeButtondown(t, map[string]recordedRoute{
+		"POST /v1/subscribers": {http.StatusCreated, "buttondown/subscriber.json"},
+	})
+	subscriber, err := (buttondownProvider{}).CreateSubscriber("ana@example.com", models.Attribution{UtmSource: "blog"})
+	if err != nil || subscriber == nil || subscriber.ID != buttondownSubscriberID {
+		t.Fatalf("CreateSubscriber = %+v, %v", subscriber, err)
+	}
+}
+
+func TestButtondownCreateSubscriberRefused(t *testing.T) {
+	fakeButtondown(t, map[string]recordedRoute{
+		"POST /v1/subscribers": {http.StatusBadRequest, "buttondown/invalid_email.json"},
+	})
+	if subscriber, err := (buttondownProvider{}).CreateSubscriber("ana@example", models.Attribution{}); err != nil || subscriber != nil {
+		t.Errorf("CreateSubscriber = %+v, %v; want a refusal without an error", subscriber, err)
+	}
+}
+
+func TestButtondownTagsReplaceTheWholeList(t *testing.T) {
+	calls := fakeButtondown(t, map[string]recordedRoute{
+		"GET /v1/subscribers/" + buttondownSubscriberID:   {http.StatusOK, "buttondown/subscriber.json"},
+		"PATCH /v1/subscribers/" + buttondownSubscriberID: {http.StatusOK, "buttondown/subscriber.json"},
+	})
+
+	if err := (buttondownProvider{}).AddTags(buttondownSubscriberID, []string{"homelab", "devops"}); err != nil {
+		t.Fatalf("AddTags: %v", err)
+	}
+	if err := (buttondownProvider{}).RemoveTag(buttondownSubscriberID, "Paused"); err != nil {
+		t.Fatalf("RemoveTag: %v", err)
+	}
+
+	received := calls()
+	if got := received[1].Body; got != `{"tags":["homelab","paused","devops"]}` {
+		t.Errorf("add body = %s", got)
+	}
+	if got := received[3].Body; got != `{"tags":["homelab"]}` {
+		t.Errorf("remove body = %s", got)
+	}
+}
+
+func TestButtondownDeleteSubscriber(t *testing.T) {
+	fakeButtondown(t, map[string]recordedRoute{
+		"DELETE /v1/subscribers/" + buttondownSubscriberID: {http.StatusNoContent, ""},
+		"DELETE /v1/subscribers/missing":                   {http.StatusNotFound, "buttondown/not_found.json"},
+		"DELETE /v1/subscribers/broken":                    {http.StatusInternalServerError, ""},
+	})
+
+	for id, fails := range map[string]bool{buttondownSubscriberID: false, "missing": false, "broken": true} {
+		if err := (buttondownProvider{}).DeleteSubscriber(models.Subscriber{ID: id}); (err != nil) != fails {
+			t.Errorf("DeleteSubscriber(%s) = %v", id, err)
+		}
+	}
+}
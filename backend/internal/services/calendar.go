@@ -0,0 +1,80 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+)
+
+// icsTimeFormat is the UTC date-time format used in iCalendar files
+const icsTimeFormat = "20060102T150405Z"
+
+// icsEscaper escapes TEXT values as required by RFC 5545
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// icsParamValue quotes a parameter value as RFC 5545 requires for values that may contain
+// ":", ";" or ",". Backslash escaping is not allowed there, so double quotes and control
+// characters, which a quoted value cannot hold, are dropped.
+func icsParamValue(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if r == '"' || r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, value)
+	return `"` + value + `"`
+}
+
+// foldICSLine splits content lines longer than 75 octets as required by RFC 5545,
+// without breaking multi-byte characters
+func foldICSLine(line string) string {
+	var builder strings.Builder
+	length := 0
+	for _, r := range line {
+		size := len(string(r))
+		if length+size > 75 {
+			builder.WriteString("\r\n ")
+			length = 1
+		}
+		builder.WriteRune(r)
+		length += size
+	}
+	return builder.String()
+}
+
+// generateBookingICS builds an iCalendar invite (METHOD:REQUEST) for a confirmed booking
+func generateBookingICS(booking models.Booking) string {
+	description := fmt.Sprintf("Reserva con %s a través de %s", conf().Site.Author, conf().Site.URL)
+	if booking.Notes != "" {
+		description += "\n\n" + booking.Notes
+	}
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		fmt.Sprintf("PRODID:-//%s//Booking//ES", conf().Site.Domain),
+		"CALSCALE:GREGORIAN",
+		"METHOD:REQUEST",
+		"BEGIN:VEVENT",
+		fmt.Sprintf("UID:%s@%s", booking.ID, conf().Site.Domain),
+		"DTSTAMP:" + time.Now().UTC().Format(icsTimeFormat),
+		"DTSTART:" + booking.Start.UTC().Format(icsTimeFormat),
+		"DTEND:" + booking.End.UTC().Format(icsTimeFormat),
+		"SUMMARY:" + icsEscaper.Replace(fmt.Sprintf("%s <> %s", conf().Site.Author, booking.Name)),
+		"DESCRIPTION:" + icsEscaper.Replace(description),
+		fmt.Sprintf("ORGANIZER;CN=%s:mailto:%s", icsParamValue(conf().Site.Author), conf().Site.Mail),
+		fmt.Sprintf("ATTENDEE;CN=%s;ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:%s",
+			icsParamValue(booking.Name), booking.Email),
+		"STATUS:CONFIRMED",
+		"SEQUENCE:0",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}
+
+	for i, line := range lines {
+		lines[i] = foldICSLine(line)
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
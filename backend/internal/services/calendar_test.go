@@ -0,0 +1,40 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+)
+
+func TestICSParamValue(t *testing.T) {
+	cases := map[string]string{
+		"Ana":                  `"Ana"`,
+		`Pérez, Ana; "CTO": X`: `"Pérez, Ana; CTO: X"`,
+		"Ana\r\nX-INJECTED:1":  `"AnaX-INJECTED:1"`,
+	}
+	for input, want := range cases {
+		if got := icsParamValue(input); got != want {
+			t.Errorf("icsParamValue(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestBookingICSQuotesAttendeeName(t *testing.T) {
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	ics := generateBookingICS(models.Booking{
+		ID:    "b1",
+		Name:  `Pérez, Ana; "CTO"`,
+		Email: "ana@example.com",
+		Start: start,
+		End:   start.Add(45 * time.Minute),
+	})
+
+	// Undo line folding before looking for the property
+	unfolded := strings.ReplaceAll(ics, "\r\n ", "")
+	want := `ATTENDEE;CN="Pérez, Ana; CTO";ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:ana@example.com`
+	if !strings.Contains(unfolded, want+"\r\n") {
+		t.Errorf("invite does not contain %q:\n%s", want, ics)
+	}
+}
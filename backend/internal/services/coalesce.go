@@ -0,0 +1,166 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+)
+
+// lookupCacheTTL is how long the provider's answer about an email is reused. It covers the
+// lookups a single form post makes, in the handler and again in the service it calls.
+const lookupCacheTTL = 30 * time.Second
+
+// cachedLookup is a provider answer about an email; subscriber is nil when it is not subscribed
+type cachedLookup struct {
+	subscriber *models.Subscriber
+	expiresAt  time.Time
+}
+
+// lookupCall is a provider lookup in flight, shared by every caller asking about the same email.
+// stale is set when the subscription changes meanwhile, so that its answer is not cached.
+type lookupCall struct {
+	done       chan struct{}
+	subscriber *models.Subscriber
+	err        error
+	stale      bool
+}
+
+// emailLock serializes the changes to one email; holders counts who holds or waits for it
+type emailLock struct {
+	mu      sync.Mutex
+	holders int
+}
+
+var (
+	coalesceMu  sync.Mutex
+	lookupCache = map[string]cachedLookup{}
+	lookupCalls = map[string]*lookupCall{}
+	emailLocks  = map[string]*emailLock{}
+)
+
+// lockEmail waits until no other change to the subscription of the email is running and
+// returns the function that lets the next one in. It is not reentrant: only the exported
+// entry points take it.
+func lockEmail(email string) func() {
+	key := mirrorKey(email)
+
+	coalesceMu.Lock()
+	lock, ok := emailLocks[key]
+	if !ok {
+		lock = &emailLock{}
+		emailLocks[key] = lock
+	}
+	lock.holders++
+	coalesceMu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+
+		coalesceMu.Lock()
+		lock.holders--
+		if lock.holders == 0 {
+			delete(emailLocks, key)
+		}
+		coalesceMu.Unlock()
+	}
+}
+
+// lookupSubscriber asks the provider for the subscriber of an email, returning nil when it is
+// not subscribed. Recent answers are served from the cache, and concurrent lookups of the same
+// email share a single provider request.
+func lookupSubscriber(email string) (*models.Subscriber, error) {
+	key := mirrorKey(email)
+
+	coalesceMu.Lock()
+	if cached, ok := lookupCache[key]; ok && time.Now().Before(cached.expiresAt) {
+		coalesceMu.Unlock()
+		return cloneSubscriber(cached.subscriber), nil
+	}
+	call, inFlight := lookupCalls[key]
+	if !inFlight {
+		call = &lookupCall{done: make(chan struct{})}
+		lookupCalls[key] = call
+	}
+	coalesceMu.Unlock()
+
+	if inFlight {
+		<-call.done
+		return cloneSubscriber(call.subscriber), call.err
+	}
+
+	// Deferred so that the callers waiting on this lookup are released even after a panic
+	defer func() {
+		coalesceMu.Lock()
+		delete(lookupCalls, key)
+		if call.err == nil && !call.stale {
+			rememberLookup(key, call.subscriber)
+		}
+		coalesceMu.Unlock()
+		close(call.done)
+	}()
+
+	call.subscriber, call.err = newsletter().FindSubscriber(email)
+	return cloneSubscriber(call.subscriber), call.err
+}
+
+// rememberLookup caches an answer and drops the expired ones. coalesceMu must be held.
+func rememberLookup(key string, subscriber *models.Subscriber) {
+	now := time.Now()
+	for cachedKey, cached := range lookupCache {
+		if now.After(cached.expiresAt) {
+			delete(lookupCache, cachedKey)
+		}
+	}
+	lookupCache[key] = cachedLookup{subscriber: cloneSubscriber(subscriber), expiresAt: now.Add(lookupCacheTTL)}
+}
+
+// primeLookup caches a subscriber the provider has just returned from a change
+func primeLookup(subscriber models.Subscriber) {
+	key := mirrorKey(subscriber.Email)
+
+	coalesceMu.Lock()
+	defer coalesceMu.Unlock()
+	if call, ok := lookupCalls[key]; ok {
+		call.stale = true
+	}
+	rememberLookup(key, &subscriber)
+}
+
+// forgetLookup drops the cached answer about an email after its subscription changed
+func forgetLookup(email string) {
+	key := mirrorKey(email)
+
+	coalesceMu.Lock()
+	defer coalesceMu.Unlock()
+	delete(lookupCache, key)
+	if call, ok := lookupCalls[key]; ok {
+		call.stale = true
+	}
+}
+
+// forgetLookupByID drops the cached answer about the subscriber with the given ID
+func forgetLookupByID(subscriptionID string) {
+	coalesceMu.Lock()
+	defer coalesceMu.Unlock()
+	for key, cached := range lookupCache {
+		if cached.subscriber != nil && cached.subscriber.ID == subscriptionID {
+			delete(lookupCache, key)
+		}
+	}
+	// Lookups in flight cannot be matched by ID yet: none of them is cached
+	for _, call := range lookupCalls {
+		call.stale = true
+	}
+}
+
+// cloneSubscriber copies a subscriber, so that callers sharing an answer cannot change it
+func cloneSubscriber(subscriber *models.Subscriber) *models.Subscriber {
+	if subscriber == nil {
+		return nil
+	}
+	clone := *subscriber
+	clone.Tags = append([]string(nil), subscriber.Tags...)
+	return &clone
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/internal/store"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+// maxUserAgentLength bounds the user agent kept with each consent
+const maxUserAgentLength = 512
+
+// consentLog is the append-only ledger of subscription consents
+var consentLog = store.NewLog("consents.jsonl")
+
+// RecordConsent appends to the consent ledger the opt-in given through a subscription form,
+// with the policy version and consent text in force
+func RecordConsent(email string, source models.SubscriptionSource, ip, userAgent string) (*models.ConsentRecord, error) {
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = strings.ToValidUTF8(userAgent[:maxUserAgentLength], "")
+	}
+
+	record := models.ConsentRecord{
+		ID:            generateUniqueID(),
+		EmailHash:     HashEmail(email),
+		Source:        string(source),
+		IP:            ip,
+		UserAgent:     userAgent,
+		PolicyVersion: conf().Privacy.PolicyVersion,
+		ConsentText:   constants.ConsentTexts[string(source)],
+		CreatedAt:     time.Now().UTC(),
+	}
+
+	if err := consentLog.Append(record); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["ConsentError"], err.Error())
+		return nil, err
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["ConsentRecorded"], map[string]string{
+		"id":            record.ID,
+		"emailHash":     record.EmailHash,
+		"source":        record.Source,
+		"policyVersion": record.PolicyVersion,
+	})
+	return &record, nil
+}
+
+// FindConsents returns the consent records of an email, oldest first
+func FindConsents(email string) ([]models.ConsentRecord, error) {
+	hash := HashEmail(email)
+	records := []models.ConsentRecord{}
+
+	err := consentLog.Scan(func(raw json.RawMessage) error {
+		var record models.ConsentRecord
+		if err := json.Unmarshal(raw, &record); err != nil {
+			return err
+		}
+		if record.EmailHash == hash {
+			records = append(records, record)
+		}
+		return nil
+	})
+	return records, err
+}
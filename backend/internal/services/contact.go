@@ -0,0 +1,50 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+// maxContactLinks is the number of links above which a contact message is treated as spam
+const maxContactLinks = 3
+
+// IsLikelySpam applies cheap heuristics to a contact message: a filled honeypot
+// field or a message stuffed with links
+func IsLikelySpam(request models.ContactRequest) bool {
+	if strings.TrimSpace(request.Website) != "" {
+		return true
+	}
+
+	message := strings.ToLower(request.Message)
+	links := strings.Count(message, "http://") + strings.Count(message, "https://")
+	return links > maxContactLinks
+}
+
+// ProcessContact forwards a contact message to the site mailbox and acknowledges it to the
+// sender. Only the delivery to the site mailbox is required for the request to succeed.
+func ProcessContact(request models.ContactRequest) error {
+	logger.LogFunction("info", constants.Messages.Backend.Info["ContactReceived"], map[string]string{
+		"email":   request.Email,
+		"subject": request.Subject,
+	})
+
+	if err := SendContactEmail(request); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["ContactError"], err.Error())
+		return err
+	}
+
+	if err := SendContactAcknowledgement(request); err != nil {
+		logger.LogFunction("warn", constants.Messages.Backend.Warn["AcknowledgementError"], map[string]string{
+			"email": request.Email,
+			"error": err.Error(),
+		})
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["ContactSent"], map[string]string{
+		"email": request.Email,
+	})
+	return nil
+}
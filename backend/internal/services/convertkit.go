@@ -0,0 +1,300 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+// convertKitAPI is the base URL of the ConvertKit v3 API
+const convertKitAPI = "https://api.convertkit.com/v3"
+
+// convertKitProvider keeps the list in a ConvertKit account. New subscribers join through the
+// configured form, and tags are referenced by ID, so their names are resolved on every change.
+type convertKitProvider struct{}
+
+// convertKitSubscriber is a subscriber of a ConvertKit account
+type convertKitSubscriber struct {
+	ID           int64             `json:"id"`
+	EmailAddress string            `json:"email_address"`
+	State        string            `json:"state"`
+	CreatedAt    string            `json:"created_at"`
+	Fields       map[string]string `json:"fields"`
+}
+
+// convertKitTag is a tag of a ConvertKit account
+type convertKitTag struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// subscriber converts a ConvertKit subscriber and its tags to the common subscriber model
+func (s convertKitSubscriber) subscriber(tags []convertKitTag) *models.Subscriber {
+	subscriber := &models.Subscriber{
+		ID:          strconv.FormatInt(s.ID, 10),
+		Email:       s.EmailAddress,
+		Tags:        []string{},
+		Status:      s.State,
+		UtmSource:   s.Fields["utm_source"],
+		UtmMedium:   s.Fields["utm_medium"],
+		UtmCampaign: s.Fields["utm_campaign"],
+	}
+	if s.State == "cancelled" {
+		subscriber.Status = "inactive"
+	}
+	for _, tag := range tags {
+		subscriber.Tags = append(subscriber.Tags, tag.Name)
+	}
+	if created, err := time.Parse(time.RFC3339, s.CreatedAt); err == nil {
+		subscriber.Created = created.Unix()
+	}
+	return subscriber
+}
+
+// Name identifies the provider
+func (convertKitProvider) Name() string {
+	return "convertkit"
+}
+
+// authorize leaves the request as is: ConvertKit takes its keys in the query or the body
+func (convertKitProvider) authorize(*http.Request) {}
+
+// secretURL returns the URL of an API path authenticated with the API secret
+func (convertKitProvider) secretURL(path string, query url.Values) string {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("api_secret", conf().ConvertKit.APISecret)
+	return fmt.Sprintf("%s/%s?%s", convertKitAPI, path, query.Encode())
+}
+
+// get sends an authenticated GET request and decodes the answer into out
+func (p convertKitProvider) get(operation, path string, query url.Values, out interface{}) (int, error) {
+	status, body, err := providerRequest("GET", p.secretURL(path, query), nil, p.authorize)
+	if err != nil {
+		return status, err
+	}
+	if !isSuccess(status) {
+		if status == http.StatusNotFound {
+			return status, nil
+		}
+		return status, providerStatusError(p.Name(), operation, status, body)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["UnmarshalError"], err.Error())
+		return status, err
+	}
+	return status, nil
+}
+
+// subscriberTags returns the tags of a subscriber
+func (p convertKitProvider) subscriberTags(subscriberID string) ([]convertKitTag, error) {
+	var result struct {
+		Tags []convertKitTag `json:"tags"`
+	}
+	_, err := p.get("list subscriber tags", "subscribers/"+subscriberID+"/tags", nil, &result)
+	return result.Tags, err
+}
+
+// tagID returns the ID of a tag by name, ignoring case, creating the tag when create is set.
+// It returns 0 when the tag does not exist and is not created.
+func (p convertKitProvider) tagID(name string, create bool) (int64, error) {
+	var result struct {
+		Tags []convertKitTag `json:"tags"`
+	}
+	if _, err := p.get("list tags", "tags", nil, &result); err != nil {
+		return 0, err
+	}
+	for _, tag := range result.Tags {
+		if strings.EqualFold(tag.Name, name) {
+			return tag.ID, nil
+		}
+	}
+	if !create {
+		return 0, nil
+	}
+
+	data := map[string]interface{}{
+		"api_secret": conf().ConvertKit.APISecret,
+		"tag":        map[string]string{"name": name},
+	}
+	status, body, err := providerRequest("POST", convertKitAPI+"/tags", data, p.authorize)
+	if err != nil {
+		return 0, err
+	}
+	if !isSuccess(status) {
+		return 0, providerStatusError(p.Name(), "create tag", status, body)
+	}
+
+	var tag convertKitTag
+	if err := json.Unmarshal(body, &tag); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["UnmarshalError"], err.Error())
+		return 0, err
+	}
+	return tag.ID, nil
+}
+
+// FindSubscriber returns the subscriber of an email with its tags. Cancelled subscribers stay
+// in the account but are not on the list.
+func (p convertKitProvider) FindSubscriber(email string) (*models.Subscriber, error) {
+	var result struct {
+		Subscribers []convertKitSubscriber `json:"subscribers"`
+	}
+	query := url.Values{}
+	query.Set("email_address", email)
+	if _, err := p.get("find subscriber", "subscribers", query, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Subscribers) == 0 || result.Subscribers[0].State == "cancelled" {
+		return nil, nil
+	}
+
+	found := result.Subscribers[0]
+	tags, err := p.subscriberTags(strconv.FormatInt(found.ID, 10))
+	if err != nil {
+		return nil, err
+	}
+	return found.subscriber(tags), nil
+}
+
+// CreateSubscriber subscribes an email through the configured form, which also brings back
+// cancelled subscribers. The campaign attribution is stored in custom fields.
+func (p convertKitProvider) CreateSubscriber(email string, attribution models.Attribution) (*models.Subscriber, error) {
+	fields := map[string]string{}
+	for name, value := range map[string]string{
+		"utm_source":     attribution.UtmSource,
+		"utm_medium":     attribution.UtmMedium,
+		"utm_campaign":   attribution.UtmCampaign,
+		"utm_term":       attribution.UtmTerm,
+		"utm_content":    attribution.UtmContent,
+		"referring_site": attribution.ReferringSite,
+		"landing_page":   attribution.LandingPage,
+	} {
+		if value != "" {
+			fields[name] = value
+		}
+	}
+	data := map[string]interface{}{
+		"api_key": conf().ConvertKit.APIKey,
+		"email":   email,
+		"fields":  fields,
+	}
+
+	status, body, err := providerRequest("POST",
+		fmt.Sprintf("%s/forms/%s/subscribe", convertKitAPI, conf().ConvertKit.FormID), data, p.authorize)
+	if err != nil {
+		return nil, err
+	}
+	if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+		return nil, providerStatusError(p.Name(), "create subscriber", status, body)
+	}
+	if !isSuccess(status) {
+		logger.LogFunction("error", constants.Messages.Backend.Error["CreateSubscriberError"], string(body))
+		return nil, nil
+	}
+
+	var result struct {
+		Subscription struct {
+			State      string               `json:"state"`
+			Subscriber convertKitSubscriber `json:"subscriber"`
+		} `json:"subscription"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["UnmarshalError"], err.Error())
+		return nil, err
+	}
+
+	created := result.Subscription.Subscriber
+	if created.ID == 0 {
+		return nil, nil
+	}
+	if created.EmailAddress == "" {
+		created.EmailAddress = email
+	}
+	if created.State == "" {
+		created.State = result.Subscription.State
+	}
+	return created.subscriber(nil), nil
+}
+
+// AddTag tags a subscriber, creating the tag the first time it is used. ConvertKit tags by
+// email, so the subscriber is looked up first.
+func (p convertKitProvider) AddTag(subscriberID, tag string) error {
+	var result struct {
+		Subscriber convertKitSubscriber `json:"subscriber"`
+	}
+	status, err := p.get("find subscriber", "subscribers/"+subscriberID, nil, &result)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusNotFound || result.Subscriber.EmailAddress == "" {
+		return fmt.Errorf("convertkit subscriber %s not found", subscriberID)
+	}
+
+	id, err := p.tagID(tag, true)
+	if err != nil {
+		return err
+	}
+
+	data := map[string]string{
+		"api_secret": conf().ConvertKit.APISecret,
+		"email":      result.Subscriber.EmailAddress,
+	}
+	status, body, err := providerRequest("POST", fmt.Sprintf("%s/tags/%d/subscribe", convertKitAPI, id), data, p.authorize)
+	if err != nil {
+		return err
+	}
+	if !isSuccess(status) {
+		return providerStatusError(p.Name(), "add tag", status, body)
+	}
+	return nil
+}
+
+// RemoveTag removes a tag from a subscriber. Tags that do not exist are already removed.
+func (p convertKitProvider) RemoveTag(subscriberID, tag string) error {
+	id, err := p.tagID(tag, false)
+	if err != nil || id == 0 {
+		return err
+	}
+
+	status, body, err := providerRequest("DELETE",
+		p.secretURL(fmt.Sprintf("subscribers/%s/tags/%d", subscriberID, id), nil), nil, p.authorize)
+	if err != nil {
+		return err
+	}
+	if !isSuccess(status) && status != http.StatusNotFound {
+		return providerStatusError(p.Name(), "remove tag", status, body)
+	}
+	return nil
+}
+
+// EraseSubscriber reports that the ConvertKit API cannot delete subscribers: erasing them
+// has to be requested from the ConvertKit account
+func (convertKitProvider) EraseSubscriber(models.Subscriber) error {
+	return ErrErasureUnsupported
+}
+
+// DeleteSubscriber unsubscribes the email. ConvertKit keeps the subscriber as cancelled.
+func (p convertKitProvider) DeleteSubscriber(subscriber models.Subscriber) error {
+	data := map[string]string{
+		"api_secret": conf().ConvertKit.APISecret,
+		"email":      subscriber.Email,
+	}
+
+	status, body, err := providerRequest("PUT", convertKitAPI+"/unsubscribe", data, p.authorize)
+	if err != nil {
+		return err
+	}
+	if !isSuccess(status) {
+		return providerStatusError(p.Name(), "delete subscriber", status, body)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+)
+
+// fakeConvertKit points the ConvertKit API at the recorded routes
+func fakeConvertKit(t *testing.T, routes map[string]recordedRoute) func() []providerCall {
+	calls := fakeProviderAPI(t, "convertkit", recordedAPI(t, routes))
+	conf().ConvertKit.APIKey = "convertkit-key"
+	conf().ConvertKit.APISecret = "convertkit-secret"
+	conf().ConvertKit.FormID = "123"
+	return calls
+}
+
+func TestConvertKitFindSubscriber(t *testing.T) {
+	calls := fakeConvertKit(t, map[string]recordedRoute{
+		"GET /v3/subscribers":              {http.StatusOK, "convertkit/subscribers.json"},
+		"GET /v3/subscribers/1690918/tags": {http.StatusOK, "convertkit/subscriber_tags.json"},
+	})
+
+	subscriber, err := (convertKitProvider{}).FindSubscriber("ana@example.com")
+	if err != nil {
+		t.Fatalf("FindSubscriber: %v", err)
+	}
+	if subscriber == nil || subscriber.ID != "1690918" || subscriber.Status != "active" || len(subscriber.Tags) != 1 || subscriber.UtmSource != "blog" {
+		t.Errorf("subscriber = %+v", subscriber)
+	}
+
+	query := calls()[0].Query
+	if query.Get("email_address") != "ana@example.com" || query.Get("api_secret") != "convertkit-secret" {
+		t.Errorf("query = %v", query)
+	}
+}
+
+func TestConvertKitFindSubscriberUnknown(t *testing.T) {
+	fakeConvertKit(t, map[string]recordedRoute{
+		"GET /v3/subscribers": {http.StatusOK, "convertkit/subscribers_empty.json"},
+	})
+
+	if subscriber, err := (convertKitProvider{}).FindSubscriber("bob@example.com"); err != nil || subscriber != nil {
+		t.Errorf("subscriber = %+v, err = %v; want neither", subscriber, err)
+	}
+}
+
+func TestConvertKitCreateSubscriber(t *testing.T) {
+	calls := fakeConvertKit(t, map[string]recordedRoute{
+		"POST /v3/forms/123/subscribe": {http.StatusOK, "convertkit/form_subscribe.json"},
+	})
+
+	subscriber, err := (convertKitProvider{}).CreateSubscriber("ana@example.com", models.Attribution{UtmSource: "blog"})
+	if err != nil || subscriber == nil {
+		t.Fatalf("CreateSubscriber = %+v, %v", subscriber, err)
+	}
+	if subscriber.ID != "1690918" || subscriber.Email != "ana@example.com" || subscriber.Status != "active" {
+		t.Errorf("subscriber = %+v", subscriber)
+	}
+
+	var body struct {
+		APIKey string            `json:"api_key"`
+		Fields map[string]string `json:"fields"`
+	}
+	if err := json.Unmarshal([]byte(calls()[0].Body), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.APIKey != "convertkit-key" || body.Fields["utm_source"] != "blog" {
+		t.Errorf("body = %+v", body)
+	}
+}
+
+func TestConvertKitAddTag(t *testing.T) {
+	calls := fakeConvertKit(t, map[string]recordedRoute{
+		"GET /v3/subscribers/1690918": {http.StatusOK, "convertkit/subscriber.json"},
+		"GET /v3/tags":                {http.StatusOK, "convertkit/tags.json"},
+		"POST /v3/tags/89/subscribe":  {http.StatusOK, "convertkit/tag_subscribe.json"},
+	})
+
+	if err := (convertKitProvider{}).AddTag("1690918", "Paused"); err != nil {
+		t.Fatalf("AddTag: %v", err)
+	}
+	received := calls()
+	if got := received[len(received)-1].Body; got != `{"api_secret":"convertkit-secret","email":"ana@example.com"}` {
+		t.Errorf("body = %s", got)
+	}
+}
+
+func TestConvertKitRemoveTag(t *testing.T) {
+	calls := fakeConvertKit(t, map[string]recordedRoute{
+		"GET /v3/tags":                           {http.StatusOK, "convertkit/tags.json"},
+		"DELETE /v3/subscribers/1690918/tags/89": {http.StatusOK, "convertkit/tag_removed.json"},
+	})
+
+	if err := (convertKitProvider{}).RemoveTag("1690918", "paused"); err != nil {
+		t.Fatalf("RemoveTag: %v", err)
+	}
+	// Tags the account does not have are already removed
+	if err := (convertKitProvider{}).RemoveTag("1690918", "unknown"); err != nil {
+		t.Fatalf("RemoveTag of an unknown tag: %v", err)
+	}
+	if got := len(calls()); got != 3 {
+		t.Errorf("got %d requests, want 3", got)
+	}
+}
+
+func TestConvertKitDeleteSubscriber(t *testing.T) {
+	calls := fakeConvertKit(t, map[string]recordedRoute{
+		"PUT /v3/unsubscribe": {http.StatusOK, "convertkit/unsubscribe.json"},
+	})
+
+	subscriber := models.Subscriber{ID: "1690918", Email: "ana@example.com"}
+	if err := (convertKitProvider{}).DeleteSubscriber(subscriber); err != nil {
+		t.Fatalf("DeleteSubscriber: %v", err)
+	}
+	if got := calls()[0].Body; got != `{"api_secret":"convertkit-secret","email":"ana@example.com"}` {
+		t.Errorf("body = %s", got)
+	}
+	if err := (convertKitProvider{}).EraseSubscriber(subscriber); !errors.Is(err, ErrErasureUnsupported) {
+		t.Errorf("EraseSubscriber = %v, want ErrErasureUnsupported", err)
+	}
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"sort"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/pkg/config"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+// dripEmailData is what the template of a drip step can use
+type dripEmailData struct {
+	Email          string
+	ResourceID     string
+	ResourceTitle  string
+	ResourceLink   string
+	PreferencesURL string
+	SiteTitle      string
+	SiteURL        string
+	Step           int
+	Day            int
+}
+
+// StartDrip schedules in the job queue the follow-up sequence configured for a resource, one job
+// per step, counting days from now. A pending run of the same sequence for the email is cancelled
+// first, so requesting the resource again restarts it. It returns the ID of the new run, or an
+// empty string when the resource has no sequence.
+func StartDrip(email string, resource models.ResourceEmailJobPayload) (string, error) {
+	steps := conf().Drip.Sequences[resource.ResourceID]
+	if len(steps) == 0 {
+		return "", nil
+	}
+
+	if _, err := StopDrips(email, resource.ResourceID); err != nil {
+		return "", err
+	}
+
+	enrollment := generateUniqueID()
+	start := time.Now().UTC()
+	for i, step := range steps {
+		_, err := EnqueueJob(models.JobTypeDripEmail, email, models.DripJobPayload{
+			Enrollment: enrollment,
+			ResourceID: resource.ResourceID,
+			FileID:     resource.FileID,
+			Step:       i + 1,
+			Day:        step.Day,
+		}, start.AddDate(0, 0, step.Day))
+		if err != nil {
+			// Do not leave half a sequence behind
+			StopDrips(email, resource.ResourceID)
+			return "", err
+		}
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["DripStarted"], map[string]interface{}{
+		"email":      email,
+		"resourceId": resource.ResourceID,
+		"enrollment": enrollment,
+		"steps":      len(steps),
+	})
+	return enrollment, nil
+}
+
+// StopDrips cancels the pending follow-up emails of an email, only those of one resource when
+// resourceID is not empty. Cancelled steps stay in the queue, so their status can be followed.
+func StopDrips(email, resourceID string) (int, error) {
+	stopped := 0
+	err := jobs.Update(func(docs map[string]json.RawMessage) error {
+		now := time.Now().UTC()
+		for id, raw := range docs {
+			var job models.Job
+			if err := json.Unmarshal(raw, &job); err != nil {
+				return err
+			}
+			if job.Type != models.JobTypeDripEmail || !sameEmail(job.Email, email) || job.Status != models.JobStatusPending {
+				continue
+			}
+			if resourceID != "" {
+				var payload models.DripJobPayload
+				if err := json.Unmarshal(job.Payload, &payload); err != nil {
+					return err
+				}
+				if payload.ResourceID != resourceID {
+					continue
+				}
+			}
+
+			job.Status = models.JobStatusCancelled
+			job.UpdatedAt = now
+			updated, err := json.Marshal(job)
+			if err != nil {
+				return err
+			}
+			docs[id] = updated
+			stopped++
+		}
+		return nil
+	})
+	if err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["JobError"], err.Error())
+		return stopped, err
+	}
+
+	if stopped > 0 {
+		logger.LogFunction("info", constants.Messages.Backend.Info["DripStopped"], map[string]interface{}{
+			"email":      email,
+			"resourceId": resourceID,
+			"steps":      stopped,
+		})
+	}
+	return stopped, nil
+}
+
+// ListDrips returns the runs of follow-up sequences with the status of each step, oldest first,
+// only those of one email when email is not empty
+func ListDrips(email string) ([]models.DripEnrollment, error) {
+	all, err := ListJobs("")
+	if err != nil {
+		return nil, err
+	}
+
+	enrollments := map[string]*models.DripEnrollment{}
+	for _, job := range all {
+		if job.Type != models.JobTypeDripEmail || (email != "" && !sameEmail(job.Email, email)) {
+			continue
+		}
+		var payload models.DripJobPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return nil, err
+		}
+
+		enrollment, ok := enrollments[payload.Enrollment]
+		if !ok {
+			enrollment = &models.DripEnrollment{
+				ID:         payload.Enrollment,
+				Email:      job.Email,
+				ResourceID: payload.ResourceID,
+				StartedAt:  job.CreatedAt,
+			}
+			enrollments[payload.Enrollment] = enrollment
+		}
+		if job.CreatedAt.Before(enrollment.StartedAt) {
+			enrollment.StartedAt = job.CreatedAt
+		}
+		enrollment.Steps = append(enrollment.Steps, models.DripStepStatus{
+			Step:      payload.Step,
+			Day:       payload.Day,
+			JobID:     job.ID,
+			Status:    job.Status,
+			RunAt:     job.RunAt,
+			Attempts:  job.Attempts,
+			LastError: job.LastError,
+		})
+	}
+
+	result := make([]models.DripEnrollment, 0, len(enrollments))
+	for _, enrollment := range enrollments {
+		sort.Slice(enrollment.Steps, func(i, j int) bool { return enrollment.Steps[i].Step < enrollment.Steps[j].Step })
+		result = append(result, *enrollment)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].StartedAt.Before(result[j].StartedAt) })
+	return result, nil
+}
+
+// runDripJob sends one step of a follow-up sequence and records it in the audit log. The step is
+// cancelled instead of retried when it is no longer configured or the email left the newsletter,
+// in which case the rest of its sequences are cancelled too.
+func runDripJob(job models.Job) error {
+	var payload models.DripJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return err
+	}
+
+	steps := conf().Drip.Sequences[payload.ResourceID]
+	if payload.Step < 1 || payload.Step > len(steps) {
+		return fmt.Errorf("%w: step %d of the %s sequence is no longer configured", errJobCancelled, payload.Step, payload.ResourceID)
+	}
+
+	// Unsubscribes made from the provider may not have reached us yet: check before every email
+	subscriber, err := findSubscriber(job.Email)
+	if err != nil && !errors.Is(err, ErrNotSubscribed) {
+		return err
+	}
+	if subscriber == nil || subscriber.Status == "inactive" {
+		StopDrips(job.Email, "")
+		return fmt.Errorf("%w: %s is no longer subscribed", errJobCancelled, job.Email)
+	}
+
+	err = sendDripEmail(job.Email, payload, steps[payload.Step-1])
+	RecordAudit(models.JobActor(job.ID), models.AuditActionSendDrip, job.Email, nil, map[string]interface{}{
+		"resourceId": payload.ResourceID,
+		"enrollment": payload.Enrollment,
+		"step":       payload.Step,
+	}, err == nil, err)
+	return err
+}
+
+// sendDripEmail renders the template of a drip step for an email and sends it
+func sendDripEmail(email string, payload models.DripJobPayload, step config.DripStep) error {
+	if !ValidateEmailConfiguration() {
+		return fmt.Errorf(constants.Messages.Service.Email["InvalidConfig"])
+	}
+
+	tmpl, err := template.ParseFiles(step.Template)
+	if err != nil {
+		return err
+	}
+
+	data := dripEmailData{
+		Email:          email,
+		ResourceID:     payload.ResourceID,
+		ResourceTitle:  GenerateResourceTitle(payload.ResourceID, ""),
+		PreferencesURL: PreferencesURL(email),
+		SiteTitle:      conf().Site.Title,
+		SiteURL:        conf().Site.URL,
+		Step:           payload.Step,
+		Day:            payload.Day,
+	}
+	if payload.FileID != "" {
+		data.ResourceLink = GenerateResourceURL(payload.FileID)
+	}
+
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, data); err != nil {
+		return err
+	}
+
+	headers := baseEmailHeaders(email, step.Subject)
+	headers["Precedence"] = "bulk"
+	headers["X-Auto-Response-Suppress"] = "All"
+	setListUnsubscribeHeaders(headers, email)
+
+	if err := sendEmail(email, headers, body.String()); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["SendEmailError"], err.Error())
+		return err
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["EmailSent"], map[string]interface{}{
+		"email":      email,
+		"resourceId": payload.ResourceID,
+		"step":       payload.Step,
+	})
+	return nil
+}
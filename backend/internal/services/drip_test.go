@@ -0,0 +1,52 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/pkg/config"
+)
+
+func TestUnsubscribeCancelsPendingDrips(t *testing.T) {
+	fakeProviderAPI(t, "beehiiv", recordedAPI(t, map[string]recordedRoute{
+		"GET " + beehiivPath("subscriptions/by_email/ana@example.com"):  {http.StatusOK, "beehiiv/subscription_tags.json"},
+		"DELETE " + beehiivPath("subscriptions/"+beehiivSubscriptionID): {http.StatusNoContent, ""},
+	}))
+	conf().Drip.Sequences = map[string][]config.DripStep{
+		"checklist": {
+			{Day: 2, Subject: "¿Qué tal la checklist?", Template: "checklist-1.html"},
+			{Day: 7, Subject: "Automatiza la checklist", Template: "checklist-2.html"},
+		},
+	}
+
+	resource := models.ResourceEmailJobPayload{ResourceID: "checklist", FileID: "file"}
+	for _, email := range []string{"Ana@Example.com", "bob@example.com"} {
+		if _, err := StartDrip(email, resource); err != nil {
+			t.Fatalf("StartDrip(%s): %v", email, err)
+		}
+	}
+
+	result, err := UnsubscribeUser(models.FormActor("test"), "ana@example.com")
+	if err != nil || !result.Success {
+		t.Fatalf("UnsubscribeUser = %+v, %v", result, err)
+	}
+
+	for email, want := range map[string]models.JobStatus{
+		"ana@example.com": models.JobStatusCancelled,
+		"bob@example.com": models.JobStatusPending,
+	} {
+		enrollments, err := ListDrips(email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(enrollments) != 1 || len(enrollments[0].Steps) != 2 {
+			t.Fatalf("%s: enrollments = %+v, want one with two steps", email, enrollments)
+		}
+		for _, step := range enrollments[0].Steps {
+			if step.Status != want {
+				t.Errorf("%s: step %d is %s, want %s", email, step.Step, step.Status, want)
+			}
+		}
+	}
+}
@@ -1,8 +1,16 @@
 package services
 
 import (
+	"bytes"
+	"encoding/base64"
 	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/mail"
 	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/mlorentedev/mlorente-backend/internal/constants"
@@ -10,8 +18,24 @@ import (
 	"github.com/mlorentedev/mlorente-backend/pkg/logger"
 )
 
-// SendResourceEmail sends an email with a resource
-func SendResourceEmail(options models.ResourceEmailOptions) (bool, error) {
+// SendResourceEmail sends an email with a resource and records it in the audit log
+func SendResourceEmail(actor models.Actor, options models.ResourceEmailOptions) (bool, error) {
+	sent, err := sendResourceEmail(options)
+	RecordAudit(actor, models.AuditActionSendResource, options.Email, nil, map[string]string{
+		"resourceId":   options.ResourceID,
+		"resourceLink": options.ResourceLink,
+	}, sent, err)
+	if sent {
+		Notify(models.NotificationResourceDelivered, options.Email, map[string]string{
+			"resourceId":   options.ResourceID,
+			"resourceLink": options.ResourceLink,
+		})
+	}
+	return sent, err
+}
+
+// sendResourceEmail sends an email with a resource
+func sendResourceEmail(options models.ResourceEmailOptions) (bool, error) {
 	if !ValidateEmailConfiguration() {
 		logger.LogFunction("error", constants.Messages.Backend.Error["EmailConfigMissing"], nil)
 		return false, fmt.Errorf(constants.Messages.Service.Email["InvalidConfig"])
@@ -26,49 +50,332 @@ func SendResourceEmail(options models.ResourceEmailOptions) (bool, error) {
 	htmlBody := generateResourceEmailHTML(options)
 
 	// Configure email headers
-	headers := make(map[string]string)
-	headers["From"] = conf.Email.From
-	headers["Reply-To"] = conf.Site.Mail
-	headers["To"] = options.Email
-	headers["Subject"] = fmt.Sprintf("Tu %s", options.ResourceTitle)
-	headers["MIME-Version"] = "1.0"
-	headers["Content-Type"] = "text/html; charset=UTF-8"
+	headers := baseEmailHeaders(options.Email, fmt.Sprintf("Tu %s", options.ResourceTitle))
 	headers["Precedence"] = "bulk"
 	headers["X-Auto-Response-Suppress"] = "All"
-	headers["X-Site-Origin"] = conf.Site.Title
-	headers["Message-ID"] = fmt.Sprintf("<%s@%s>", generateUniqueID(), conf.Site.Domain)
-	headers["Return-Path"] = conf.Email.User
+	setListUnsubscribeHeaders(headers, options.Email)
+
+	// Send email
+	if err := sendEmail(options.Email, headers, htmlBody); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["SendEmailError"], err.Error())
+		return false, err
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["EmailSent"], map[string]string{
+		"email":      options.Email,
+		"resourceId": options.ResourceID,
+	})
+
+	return true, nil
+}
+
+// SendContactEmail forwards a contact form message to the site mailbox.
+// Replies go straight to the sender.
+func SendContactEmail(request models.ContactRequest) error {
+	if !ValidateEmailConfiguration() {
+		return fmt.Errorf(constants.Messages.Service.Email["InvalidConfig"])
+	}
+
+	subject := "Nuevo mensaje de contacto"
+	if request.Subject != "" {
+		subject += ": " + request.Subject
+	}
+
+	headers := baseEmailHeaders(conf().Site.Mail, subject)
+	headers["Reply-To"] = (&mail.Address{Name: request.Name, Address: request.Email}).String()
+
+	if err := sendEmail(conf().Site.Mail, headers, generateContactEmailHTML(request)); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["SendEmailError"], err.Error())
+		return err
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["EmailSent"], map[string]string{
+		"to":   conf().Site.Mail,
+		"from": request.Email,
+	})
+	return nil
+}
+
+// SendContactAcknowledgement confirms to the sender that their message was received
+func SendContactAcknowledgement(request models.ContactRequest) error {
+	if !ValidateEmailConfiguration() {
+		return fmt.Errorf(constants.Messages.Service.Email["InvalidConfig"])
+	}
+
+	headers := baseEmailHeaders(request.Email, "He recibido tu mensaje")
+	headers["X-Auto-Response-Suppress"] = "All"
+	headers["Auto-Submitted"] = "auto-replied"
+
+	if err := sendEmail(request.Email, headers, generateContactAcknowledgementHTML()); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["SendEmailError"], err.Error())
+		return err
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["EmailSent"], map[string]string{
+		"email": request.Email,
+		"type":  "contact_acknowledgement",
+	})
+	return nil
+}
+
+// SendTestEmail sends a short message to check the SMTP configuration end to end
+func SendTestEmail(email string) error {
+	if !ValidateEmailConfiguration() {
+		return fmt.Errorf(constants.Messages.Service.Email["InvalidConfig"])
+	}
+
+	headers := baseEmailHeaders(email, "Email de prueba")
+	headers["X-Auto-Response-Suppress"] = "All"
+	headers["Auto-Submitted"] = "auto-generated"
+
+	if err := sendEmail(email, headers, generateTestEmailHTML()); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["SendEmailError"], err.Error())
+		return err
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["EmailSent"], map[string]string{
+		"email": email,
+		"type":  "test",
+	})
+	return nil
+}
+
+// SendPreferencesLinkEmail emails a subscriber the signed link to their preference center
+func SendPreferencesLinkEmail(email, link string) error {
+	if !ValidateEmailConfiguration() {
+		return fmt.Errorf(constants.Messages.Service.Email["InvalidConfig"])
+	}
+
+	headers := baseEmailHeaders(email, "Gestiona tus preferencias")
+	headers["X-Auto-Response-Suppress"] = "All"
+	headers["Auto-Submitted"] = "auto-generated"
+
+	if err := sendEmail(email, headers, generatePreferencesLinkEmailHTML(link)); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["SendEmailError"], err.Error())
+		return err
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["EmailSent"], map[string]string{
+		"email": email,
+		"type":  "preferences_link",
+	})
+	return nil
+}
+
+// SendPrivacyLinkEmail emails the signed link that confirms a data export or erasure request
+func SendPrivacyLinkEmail(email string, action models.PrivacyAction, link string) error {
+	if !ValidateEmailConfiguration() {
+		return fmt.Errorf(constants.Messages.Service.Email["InvalidConfig"])
+	}
+
+	subject := "Descarga tus datos"
+	if action == models.PrivacyActionErase {
+		subject = "Confirma el borrado de tus datos"
+	}
+
+	headers := baseEmailHeaders(email, subject)
+	headers["X-Auto-Response-Suppress"] = "All"
+	headers["Auto-Submitted"] = "auto-generated"
+
+	if err := sendEmail(email, headers, generatePrivacyLinkEmailHTML(subject, action, link)); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["SendEmailError"], err.Error())
+		return err
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["EmailSent"], map[string]string{
+		"email": email,
+		"type":  "privacy_" + string(action),
+	})
+	return nil
+}
+
+// SendBookingInvites emails the calendar invite of a confirmed booking to the visitor and to the site mailbox
+func SendBookingInvites(booking models.Booking) error {
+	if !ValidateEmailConfiguration() {
+		return fmt.Errorf(constants.Messages.Service.Email["InvalidConfig"])
+	}
+
+	invite := emailAttachment{
+		Filename:    "invite.ics",
+		ContentType: "text/calendar; charset=UTF-8; method=REQUEST",
+		Content:     []byte(generateBookingICS(booking)),
+	}
+
+	recipients := []struct {
+		to      string
+		subject string
+		replyTo string
+	}{
+		{booking.Email, "Reserva confirmada", conf().Site.Mail},
+		{conf().Site.Mail, fmt.Sprintf("Nueva reserva: %s", booking.Name), (&mail.Address{Name: booking.Name, Address: booking.Email}).String()},
+	}
+
+	htmlBody := generateBookingEmailHTML(booking, BookingLocation())
+	for _, recipient := range recipients {
+		headers := baseEmailHeaders(recipient.to, recipient.subject)
+		headers["Reply-To"] = recipient.replyTo
+
+		if err := sendEmail(recipient.to, headers, htmlBody, invite); err != nil {
+			logger.LogFunction("error", constants.Messages.Backend.Error["SendEmailError"], err.Error())
+			return err
+		}
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["EmailSent"], map[string]string{
+		"email":     booking.Email,
+		"bookingId": booking.ID,
+	})
+	return nil
+}
+
+// setListUnsubscribeHeaders adds the one-click unsubscribe headers (RFC 8058) of a bulk email,
+// pointing at the signed unsubscribe link of the recipient. They are left out when signed links
+// are disabled, as a link that does not identify the recipient cannot unsubscribe them.
+func setListUnsubscribeHeaders(headers map[string]string, email string) {
+	link := OneClickUnsubscribeURL(email)
+	if link == "" {
+		return
+	}
+	headers["List-Unsubscribe"] = "<" + link + ">"
 	headers["List-Unsubscribe-Post"] = "List-Unsubscribe=One-Click"
-	headers["List-Unsubscribe"] = fmt.Sprintf("<%s/unsubscribe>", conf.Site.URL)
+}
+
+// emailAttachment is a file attached to an outgoing email
+type emailAttachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+}
+
+// baseEmailHeaders returns the headers shared by every email sent by the site
+func baseEmailHeaders(to, subject string) map[string]string {
+	headers := make(map[string]string)
+	headers["From"] = conf().Email.From
+	headers["Reply-To"] = conf().Site.Mail
+	headers["To"] = to
+	headers["Subject"] = mime.QEncoding.Encode("UTF-8", subject)
+	headers["MIME-Version"] = "1.0"
+	headers["Content-Type"] = "text/html; charset=UTF-8"
+	headers["X-Site-Origin"] = conf().Site.Title
+	headers["Message-ID"] = fmt.Sprintf("<%s@%s>", generateUniqueID(), conf().Site.Domain)
+	headers["Return-Path"] = conf().Email.User
+	return headers
+}
+
+// sendEmail builds the message from its headers, HTML body and optional attachments and
+// delivers it through SMTP. Line breaks are stripped from header values to prevent header injection.
+func sendEmail(to string, headers map[string]string, htmlBody string, attachments ...emailAttachment) error {
+	sanitize := strings.NewReplacer("\r", "", "\n", " ")
+
+	body := htmlBody
+	if len(attachments) > 0 {
+		multipartBody, contentType, err := buildMultipartBody(htmlBody, attachments)
+		if err != nil {
+			return err
+		}
+		body = multipartBody
+		headers["Content-Type"] = contentType
+	}
 
-	// Build complete message
 	message := ""
 	for k, v := range headers {
-		message += fmt.Sprintf("%s: %s\r\n", k, v)
+		message += fmt.Sprintf("%s: %s\r\n", k, sanitize.Replace(v))
 	}
-	message += "\r\n" + htmlBody
+	message += "\r\n" + body
 
-	// Send email
-	auth := smtp.PlainAuth("", conf.Email.User, conf.Email.Pass, conf.Email.Host)
-	err := smtp.SendMail(
-		fmt.Sprintf("%s:%s", conf.Email.Host, conf.Email.Port),
+	auth := smtp.PlainAuth("", conf().Email.User, conf().Email.Pass, conf().Email.Host)
+	return smtp.SendMail(
+		fmt.Sprintf("%s:%s", conf().Email.Host, conf().Email.Port),
 		auth,
-		conf.Email.User,
-		[]string{options.Email},
+		conf().Email.User,
+		[]string{to},
 		[]byte(message),
 	)
+}
 
+// buildMultipartBody encodes an HTML body and its attachments as a multipart/mixed body,
+// returning the body and the Content-Type header that describes it
+func buildMultipartBody(htmlBody string, attachments []emailAttachment) (string, string, error) {
+	var buffer bytes.Buffer
+	writer := multipart.NewWriter(&buffer)
+
+	htmlPart, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"text/html; charset=UTF-8"},
+	})
 	if err != nil {
-		logger.LogFunction("error", constants.Messages.Backend.Error["SendEmailError"], err.Error())
-		return false, err
+		return "", "", err
+	}
+	if _, err := htmlPart.Write([]byte(htmlBody)); err != nil {
+		return "", "", err
 	}
 
-	logger.LogFunction("info", constants.Messages.Backend.Info["EmailSent"], map[string]string{
-		"email":      options.Email,
-		"resourceId": options.ResourceID,
-	})
+	for _, attachment := range attachments {
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.ContentType},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", attachment.Filename)},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return "", "", err
+		}
 
-	return true, nil
+		encoded := base64.StdEncoding.EncodeToString(attachment.Content)
+		for len(encoded) > 76 {
+			if _, err := part.Write([]byte(encoded[:76] + "\r\n")); err != nil {
+				return "", "", err
+			}
+			encoded = encoded[76:]
+		}
+		if _, err := part.Write([]byte(encoded + "\r\n")); err != nil {
+			return "", "", err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return "", "", err
+	}
+	return buffer.String(), "multipart/mixed; boundary=" + writer.Boundary(), nil
+}
+
+// resourceDedupeWindow is how long repeated requests for the same resource and email are absorbed
+const resourceDedupeWindow = 10 * time.Minute
+
+var (
+	resourceRequestsMu sync.Mutex
+	// resourceRequests holds when each email last requested each resource, keyed by both
+	resourceRequests = map[string]time.Time{}
+)
+
+// ClaimResourceRequest reports whether a resource request should be processed. It returns false
+// when the same email requested the same resource within the dedupe window, which catches double
+// clicks and retries from clients that send no idempotency key.
+func ClaimResourceRequest(email, resourceID string) bool {
+	now := time.Now()
+	key := canonicalEmail(email) + "|" + resourceID
+
+	resourceRequestsMu.Lock()
+	defer resourceRequestsMu.Unlock()
+
+	// Drop expired claims so the map does not grow without bound
+	for k, claimedAt := range resourceRequests {
+		if now.Sub(claimedAt) > resourceDedupeWindow {
+			delete(resourceRequests, k)
+		}
+	}
+
+	if _, ok := resourceRequests[key]; ok {
+		return false
+	}
+	resourceRequests[key] = now
+	return true
+}
+
+// ReleaseResourceRequest forgets a claimed resource request, so that a request that failed
+// can be retried right away
+func ReleaseResourceRequest(email, resourceID string) {
+	resourceRequestsMu.Lock()
+	defer resourceRequestsMu.Unlock()
+	delete(resourceRequests, canonicalEmail(email)+"|"+resourceID)
 }
 
 // ScheduleResourceEmail schedules sending a resource email (with delay)
@@ -89,31 +396,10 @@ func ScheduleResourceEmail(options models.ResourceEmailScheduleOptions) error {
 		"delayMinutes": fmt.Sprintf("%d", options.DelayMinutes),
 	})
 
-	// Use goroutine to simulate delay
-	go func() {
-		time.Sleep(time.Duration(options.DelayMinutes) * time.Minute)
-
-		emailSent, err := SendResourceEmail(models.ResourceEmailOptions{
-			Email:         options.Email,
-			ResourceID:    options.ResourceID,
-			ResourceTitle: GenerateResourceTitle(options.ResourceID, ""),
-			ResourceLink:  GenerateResourceURL(options.FileID),
-		})
-
-		if err != nil || !emailSent {
-			logger.LogFunction("warn", constants.Messages.Backend.Warn["EmailDeliveryIssue"], map[string]string{
-				"email":      options.Email,
-				"resourceId": options.ResourceID,
-				"fileId":     options.FileID,
-				"error":      fmt.Sprintf("%v", err),
-			})
-		} else {
-			logger.LogFunction("info", constants.Messages.Backend.Info["DelayedEmailSent"], map[string]string{
-				"email":      options.Email,
-				"resourceId": options.ResourceID,
-			})
-		}
-	}()
-
-	return nil
+	// Persist the delivery in the job queue so it survives restarts
+	_, err := EnqueueJob(models.JobTypeResourceEmail, options.Email, models.ResourceEmailJobPayload{
+		ResourceID: options.ResourceID,
+		FileID:     options.FileID,
+	}, time.Now().Add(time.Duration(options.DelayMinutes)*time.Minute))
+	return err
 }
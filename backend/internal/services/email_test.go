@@ -0,0 +1,40 @@
+package services
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestListUnsubscribeHeadersUseSignedOneClickLink(t *testing.T) {
+	useTestConfig(t)
+	conf().Site.URL = "https://example.org"
+
+	conf().Security.LinkSecret = ""
+	headers := map[string]string{}
+	setListUnsubscribeHeaders(headers, "ana@example.com")
+	if len(headers) != 0 {
+		t.Errorf("headers = %v, want none without signed links", headers)
+	}
+
+	conf().Security.LinkSecret = "0123456789abcdef0123456789abcdef"
+	setListUnsubscribeHeaders(headers, "ana@example.com")
+	if headers["List-Unsubscribe-Post"] != "List-Unsubscribe=One-Click" {
+		t.Errorf("List-Unsubscribe-Post = %q", headers["List-Unsubscribe-Post"])
+	}
+
+	value := headers["List-Unsubscribe"]
+	if !strings.HasPrefix(value, "<") || !strings.HasSuffix(value, ">") {
+		t.Fatalf("List-Unsubscribe = %q, want a single bracketed URL", value)
+	}
+	link, err := url.Parse(strings.Trim(value, "<>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Host != "example.org" || link.Path != "/api/v1/unsubscribe/one-click" {
+		t.Errorf("link = %s, want the one-click endpoint", link)
+	}
+	if email, err := VerifyEmailToken(link.Query().Get("token"), LinkPurposeUnsubscribe); err != nil || email != "ana@example.com" {
+		t.Errorf("token is for %q (%v), want ana@example.com", email, err)
+	}
+}
@@ -0,0 +1,410 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/internal/store"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+// secondaryRetryDelay is the wait before the first background retry of a secondary provider
+const secondaryRetryDelay = time.Minute
+
+// errUnknownSubscriber is returned when a tag change cannot be copied to the secondary
+// providers because the subscription ID is not in the mirror, so the email is unknown
+var errUnknownSubscriber = errors.New("subscription ID not found in the local mirror")
+
+// divergences keeps the operations that secondary providers missed, keyed by provider,
+// operation, email hash and tag, so that repeated misses add up in a single entry
+var divergences = store.NewCollection("divergences.json")
+
+// fanoutProvider writes every subscribe, tag and unsubscribe to the primary provider and then
+// copies it to the secondary ones, to keep the old and the new list in step while migrating.
+// Reads only use the primary, and a failed secondary never undoes a primary write: it is
+// reported as a divergence and handled as NEWSLETTER_SECONDARY_POLICY says.
+type fanoutProvider struct {
+	primary     Provider
+	secondaries []Provider
+}
+
+// batchingFanoutProvider is the fan-out of a primary provider able to add tags in batches
+type batchingFanoutProvider struct {
+	fanoutProvider
+}
+
+// AddTags tags the subscriber in the primary provider with a single request and then copies
+// each tag to the secondaries
+func (p batchingFanoutProvider) AddTags(subscriberID string, tags []string) error {
+	if err := p.primary.(TagBatcher).AddTags(subscriberID, tags); err != nil {
+		return err
+	}
+
+	var failed error
+	for _, tag := range tags {
+		payload := models.SecondaryJobPayload{Operation: models.SecondaryAddTag, Tag: tag}
+		if err := p.replicateByID(subscriberID, payload); err != nil && failed == nil {
+			failed = err
+		}
+	}
+	return failed
+}
+
+// Name identifies the primary provider, which the fan-out stands for
+func (p fanoutProvider) Name() string {
+	return p.primary.Name()
+}
+
+// FindSubscriber asks the primary provider
+func (p fanoutProvider) FindSubscriber(email string) (*models.Subscriber, error) {
+	return p.primary.FindSubscriber(email)
+}
+
+// CreateSubscriber subscribes the email in the primary provider and then in the secondaries
+func (p fanoutProvider) CreateSubscriber(email string, attribution models.Attribution) (*models.Subscriber, error) {
+	subscriber, err := p.primary.CreateSubscriber(email, attribution)
+	if err != nil || subscriber == nil {
+		return subscriber, err
+	}
+
+	payload := models.SecondaryJobPayload{Operation: models.SecondarySubscribe, Attribution: attribution}
+	if err := p.replicate(email, payload); err != nil {
+		return nil, err
+	}
+	return subscriber, nil
+}
+
+// AddTag tags the subscriber in the primary provider and then in the secondaries
+func (p fanoutProvider) AddTag(subscriberID, tag string) error {
+	if err := p.primary.AddTag(subscriberID, tag); err != nil {
+		return err
+	}
+	return p.replicateByID(subscriberID, models.SecondaryJobPayload{Operation: models.SecondaryAddTag, Tag: tag})
+}
+
+// RemoveTag removes the tag in the primary provider and then in the secondaries
+func (p fanoutProvider) RemoveTag(subscriberID, tag string) error {
+	if err := p.primary.RemoveTag(subscriberID, tag); err != nil {
+		return err
+	}
+	return p.replicateByID(subscriberID, models.SecondaryJobPayload{Operation: models.SecondaryRemoveTag, Tag: tag})
+}
+
+// DeleteSubscriber unsubscribes the subscriber in the primary provider and then in the secondaries
+func (p fanoutProvider) DeleteSubscriber(subscriber models.Subscriber) error {
+	if err := p.primary.DeleteSubscriber(subscriber); err != nil {
+		return err
+	}
+	return p.replicate(subscriber.Email, models.SecondaryJobPayload{Operation: models.SecondaryUnsubscribe})
+}
+
+// EraseSubscriber erases the subscriber from every provider able to do it. Secondaries that
+// cannot are logged; ErrErasureUnsupported is only returned for the primary.
+func (p fanoutProvider) EraseSubscriber(subscriber models.Subscriber) error {
+	for _, secondary := range p.secondaries {
+		eraser, ok := secondary.(SubscriberEraser)
+		if !ok {
+			continue
+		}
+		target := models.Subscriber{Email: subscriber.Email}
+		if found, err := secondary.FindSubscriber(subscriber.Email); err == nil && found != nil {
+			target = *found
+		}
+		err := eraser.EraseSubscriber(target)
+		switch {
+		case errors.Is(err, ErrErasureUnsupported):
+			logger.LogFunction("warn", constants.Messages.Backend.Warn["ProviderErasure"], map[string]string{
+				"provider": secondary.Name(),
+				"email":    HashEmail(subscriber.Email),
+			})
+		case err != nil:
+			return err
+		}
+	}
+
+	eraser, ok := p.primary.(SubscriberEraser)
+	if !ok {
+		return nil
+	}
+	return eraser.EraseSubscriber(subscriber)
+}
+
+// replicateByID copies a tag change to the secondaries, finding the email of the primary
+// subscription ID in the mirror
+func (p fanoutProvider) replicateByID(subscriberID string, payload models.SecondaryJobPayload) error {
+	if email, ok := mirroredEmail(subscriberID); ok {
+		return p.replicate(email, payload)
+	}
+
+	var failed error
+	for _, secondary := range p.secondaries {
+		payload.Provider = secondary.Name()
+		recordDivergence(subscriberID, payload, errUnknownSubscriber, false)
+		if conf().Newsletter.SecondaryPolicy == "fail" && failed == nil {
+			failed = fmt.Errorf("secondary provider %s: %w", secondary.Name(), errUnknownSubscriber)
+		}
+	}
+	return failed
+}
+
+// replicate applies an operation to every secondary provider. Failures are recorded as
+// divergences and, depending on the policy, retried in the background or returned.
+func (p fanoutProvider) replicate(email string, payload models.SecondaryJobPayload) error {
+	policy := conf().Newsletter.SecondaryPolicy
+
+	var failed error
+	for _, secondary := range p.secondaries {
+		payload.Provider = secondary.Name()
+		err := applySecondary(secondary, email, payload)
+		if err == nil {
+			resolveDivergences(email, payload)
+			continue
+		}
+
+		retrying := false
+		if policy == "retry" {
+			if _, jobErr := EnqueueJob(models.JobTypeSecondarySync, email, payload, time.Now().Add(secondaryRetryDelay)); jobErr == nil {
+				retrying = true
+			}
+		}
+		recordDivergence(email, payload, err, retrying)
+		if policy == "fail" && failed == nil {
+			failed = fmt.Errorf("secondary provider %s: %w", secondary.Name(), err)
+		}
+	}
+	return failed
+}
+
+// applySecondary applies an operation to a secondary provider. Secondaries have their own
+// subscriber IDs, so the subscriber is looked up by email every time. Operations are
+// idempotent, which lets retries run them again safely.
+func applySecondary(provider Provider, email string, payload models.SecondaryJobPayload) error {
+	subscriber, err := provider.FindSubscriber(email)
+	if err != nil {
+		return err
+	}
+
+	switch payload.Operation {
+	case models.SecondarySubscribe:
+		if subscriber != nil {
+			return nil
+		}
+		created, err := provider.CreateSubscriber(email, payload.Attribution)
+		if err == nil && created == nil {
+			err = fmt.Errorf("%s refused the email", provider.Name())
+		}
+		return err
+
+	case models.SecondaryAddTag:
+		// A subscriber missing here means the subscribe was missed too: tagging catches up on both
+		if subscriber == nil {
+			if subscriber, err = provider.CreateSubscriber(email, models.Attribution{}); err != nil {
+				return err
+			}
+			if subscriber == nil {
+				return fmt.Errorf("%s refused the email", provider.Name())
+			}
+		}
+		for _, current := range subscriber.Tags {
+			if strings.EqualFold(current, payload.Tag) {
+				return nil
+			}
+		}
+		return provider.AddTag(subscriber.ID, payload.Tag)
+
+	case models.SecondaryRemoveTag:
+		if subscriber == nil {
+			return nil
+		}
+		return provider.RemoveTag(subscriber.ID, payload.Tag)
+
+	case models.SecondaryUnsubscribe:
+		if subscriber == nil {
+			return nil
+		}
+		return provider.DeleteSubscriber(*subscriber)
+
+	default:
+		return fmt.Errorf("unknown secondary operation %q", payload.Operation)
+	}
+}
+
+// syncSecondary retries an operation a secondary provider missed. Divergences resolved or
+// superseded in the meantime are not applied again.
+func syncSecondary(job models.Job) error {
+	var payload models.SecondaryJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return err
+	}
+	provider, ok := providers[payload.Provider]
+	if !ok {
+		return fmt.Errorf("unknown newsletter provider %q", payload.Provider)
+	}
+
+	found, err := divergences.Get(divergenceKey(job.Email, payload), &models.ProviderDivergence{})
+	if err != nil || !found {
+		return err
+	}
+
+	if err := applySecondary(provider, job.Email, payload); err != nil {
+		recordDivergence(job.Email, payload, err, job.Attempts < job.MaxAttempts)
+		return err
+	}
+	resolveDivergences(job.Email, payload)
+	return nil
+}
+
+// divergenceKey returns the key of the divergence of an operation
+func divergenceKey(email string, payload models.SecondaryJobPayload) string {
+	return strings.Join([]string{
+		payload.Provider,
+		string(payload.Operation),
+		HashEmail(email),
+		strings.ToLower(payload.Tag),
+	}, "|")
+}
+
+// recordDivergence adds a missed operation to the divergence report. The subscriber is
+// identified by email or, when it is unknown, by the primary subscription ID.
+// Failures are logged and never fail the operation that triggered them.
+func recordDivergence(subscriber string, payload models.SecondaryJobPayload, cause error, retrying bool) {
+	now := time.Now().UTC()
+	key := divergenceKey(subscriber, payload)
+
+	err := divergences.Update(func(docs map[string]json.RawMessage) error {
+		divergence := models.ProviderDivergence{
+			ID:        generateUniqueID(),
+			Provider:  payload.Provider,
+			Operation: payload.Operation,
+			Email:     subscriber,
+			Tag:       payload.Tag,
+			FirstSeen: now,
+		}
+		if raw, ok := docs[key]; ok {
+			if err := json.Unmarshal(raw, &divergence); err != nil {
+				return err
+			}
+		}
+		divergence.LastError = cause.Error()
+		divergence.Occurrences++
+		divergence.Retrying = retrying
+		divergence.LastSeen = now
+
+		updated, err := json.Marshal(divergence)
+		if err != nil {
+			return err
+		}
+		docs[key] = updated
+		return nil
+	})
+	if err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["DivergenceError"], err.Error())
+	}
+
+	logger.LogFunction("warn", constants.Messages.Backend.Warn["ProviderDivergence"], map[string]interface{}{
+		"provider":  payload.Provider,
+		"operation": payload.Operation,
+		"email":     HashEmail(subscriber),
+		"tag":       payload.Tag,
+		"retrying":  retrying,
+		"error":     cause.Error(),
+	})
+}
+
+// supersedes reports whether an operation that reached a secondary makes a divergence moot:
+// an unsubscribe settles everything, a subscribe settles subscribes and unsubscribes, and
+// a tag change settles earlier changes of the same tag
+func supersedes(done models.SecondaryJobPayload, divergence models.ProviderDivergence) bool {
+	switch done.Operation {
+	case models.SecondaryUnsubscribe:
+		return true
+	case models.SecondarySubscribe:
+		return divergence.Operation == models.SecondarySubscribe || divergence.Operation == models.SecondaryUnsubscribe
+	default:
+		return (divergence.Operation == models.SecondaryAddTag || divergence.Operation == models.SecondaryRemoveTag) &&
+			strings.EqualFold(divergence.Tag, done.Tag)
+	}
+}
+
+// resolveDivergences removes the divergences of a secondary provider that an operation applied
+// to it settles. The store is only rewritten when there is something to remove.
+func resolveDivergences(email string, done models.SecondaryJobPayload) {
+	settled := func(raw json.RawMessage) bool {
+		var divergence models.ProviderDivergence
+		return json.Unmarshal(raw, &divergence) == nil &&
+			divergence.Provider == done.Provider &&
+			sameEmail(divergence.Email, email) &&
+			supersedes(done, divergence)
+	}
+
+	pending := false
+	err := divergences.ForEach(func(_ string, raw json.RawMessage) error {
+		pending = pending || settled(raw)
+		return nil
+	})
+	if err == nil && pending {
+		err = divergences.Update(func(docs map[string]json.RawMessage) error {
+			for key, raw := range docs {
+				if settled(raw) {
+					delete(docs, key)
+				}
+			}
+			return nil
+		})
+		if err == nil {
+			logger.LogFunction("info", constants.Messages.Backend.Info["DivergenceResolved"], map[string]string{
+				"provider": done.Provider,
+				"email":    HashEmail(email),
+			})
+		}
+	}
+	if err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["DivergenceError"], err.Error())
+	}
+}
+
+// ListDivergences returns the operations secondary providers are missing, the most recent first
+func ListDivergences() ([]models.ProviderDivergence, error) {
+	report := []models.ProviderDivergence{}
+	err := divergences.ForEach(func(_ string, raw json.RawMessage) error {
+		var divergence models.ProviderDivergence
+		if err := json.Unmarshal(raw, &divergence); err != nil {
+			return err
+		}
+		report = append(report, divergence)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].LastSeen.After(report[j].LastSeen)
+	})
+	return report, nil
+}
+
+// purgeDivergences deletes the divergences of an email and returns how many there were
+func purgeDivergences(email string) (int, error) {
+	purged := 0
+	err := divergences.Update(func(docs map[string]json.RawMessage) error {
+		for key, raw := range docs {
+			var divergence models.ProviderDivergence
+			if err := json.Unmarshal(raw, &divergence); err != nil {
+				return err
+			}
+			if sameEmail(divergence.Email, email) {
+				delete(docs, key)
+				purged++
+			}
+		}
+		return nil
+	})
+	return purged, err
+}
@@ -0,0 +1,372 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/internal/store"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+const (
+	// defaultJobAttempts is how many times a job is tried before it is marked as failed
+	defaultJobAttempts = 5
+	// jobRetentionPeriod is how long finished jobs are kept for inspection
+	jobRetentionPeriod = 7 * 24 * time.Hour
+)
+
+var (
+	// ErrJobNotFound is returned when a job ID does not exist in the queue
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobRunning is returned when trying to retry a job that is currently running
+	ErrJobRunning = errors.New("job is running")
+
+	// errJobCancelled marks a job that must not run any more: it is cancelled instead of retried
+	errJobCancelled = errors.New("job cancelled")
+)
+
+// jobs is the persistent queue of scheduled jobs
+var jobs = store.NewCollection("jobs.json")
+
+// EnqueueJob schedules a job of the given type to run at runAt
+func EnqueueJob(jobType models.JobType, email string, payload interface{}, runAt time.Time) (*models.Job, error) {
+	var raw json.RawMessage
+	if payload != nil {
+		var err error
+		if raw, err = json.Marshal(payload); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now().UTC()
+	job := models.Job{
+		ID:          generateUniqueID(),
+		Type:        jobType,
+		Email:       email,
+		Payload:     raw,
+		Status:      models.JobStatusPending,
+		RunAt:       runAt.UTC(),
+		MaxAttempts: defaultJobAttempts,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if err := jobs.Put(job.ID, job); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["JobError"], err.Error())
+		return nil, err
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["JobScheduled"], map[string]string{
+		"id":    job.ID,
+		"type":  string(job.Type),
+		"email": job.Email,
+		"runAt": job.RunAt.Format(time.RFC3339),
+	})
+	return &job, nil
+}
+
+// ListJobs returns the jobs matching the given status, or every job when status is empty
+func ListJobs(status models.JobStatus) ([]models.Job, error) {
+	var result []models.Job
+	err := jobs.ForEach(func(_ string, raw json.RawMessage) error {
+		var job models.Job
+		if err := json.Unmarshal(raw, &job); err != nil {
+			return err
+		}
+		if status == "" || job.Status == status {
+			result = append(result, job)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// CancelJobs removes the pending jobs of an email, optionally restricted to one job type
+func CancelJobs(email string, jobType models.JobType) (int, error) {
+	cancelled := 0
+	err := jobs.Update(func(docs map[string]json.RawMessage) error {
+		for id, raw := range docs {
+			var job models.Job
+			if err := json.Unmarshal(raw, &job); err != nil {
+				return err
+			}
+			if !sameEmail(job.Email, email) || job.Status != models.JobStatusPending {
+				continue
+			}
+			if jobType != "" && job.Type != jobType {
+				continue
+			}
+			delete(docs, id)
+			cancelled++
+		}
+		return nil
+	})
+	return cancelled, err
+}
+
+// RetryJob schedules a pending or failed job to run again right away with a fresh set of attempts
+func RetryJob(id string) (*models.Job, error) {
+	var job models.Job
+	err := jobs.Update(func(docs map[string]json.RawMessage) error {
+		raw, ok := docs[id]
+		if !ok {
+			return ErrJobNotFound
+		}
+		if err := json.Unmarshal(raw, &job); err != nil {
+			return err
+		}
+		if job.Status == models.JobStatusRunning {
+			return ErrJobRunning
+		}
+
+		now := time.Now().UTC()
+		job.Status = models.JobStatusPending
+		job.Attempts = 0
+		job.RunAt = now
+		job.UpdatedAt = now
+		updated, err := json.Marshal(job)
+		if err != nil {
+			return err
+		}
+		docs[id] = updated
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["JobScheduled"], map[string]string{
+		"id":    job.ID,
+		"type":  string(job.Type),
+		"runAt": job.RunAt.Format(time.RFC3339),
+	})
+	return &job, nil
+}
+
+// PurgeJobs removes every job of an email, whatever its status, and reports how many were removed
+func PurgeJobs(email string) (int, error) {
+	removed := 0
+	err := jobs.Update(func(docs map[string]json.RawMessage) error {
+		for id, raw := range docs {
+			var job models.Job
+			if err := json.Unmarshal(raw, &job); err != nil {
+				return err
+			}
+			if sameEmail(job.Email, email) {
+				delete(docs, id)
+				removed++
+			}
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// StartJobWorker runs due jobs every interval until the context is cancelled
+func StartJobWorker(ctx context.Context, interval time.Duration) {
+	go func() {
+		// Jobs left running by a previous process never finished: run them again
+		requeueInterruptedJobs()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			RunDueJobs()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// requeueInterruptedJobs moves jobs stuck in the running state back to pending
+func requeueInterruptedJobs() {
+	err := jobs.Update(func(docs map[string]json.RawMessage) error {
+		for id, raw := range docs {
+			var job models.Job
+			if err := json.Unmarshal(raw, &job); err != nil {
+				return err
+			}
+			if job.Status != models.JobStatusRunning {
+				continue
+			}
+			job.Status = models.JobStatusPending
+			updated, err := json.Marshal(job)
+			if err != nil {
+				return err
+			}
+			docs[id] = updated
+		}
+		return nil
+	})
+	if err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["JobError"], err.Error())
+	}
+}
+
+// RunDueJobs claims every pending job whose time has come, runs it and records the outcome.
+// Failed jobs are retried with exponential backoff until they run out of attempts.
+func RunDueJobs() {
+	now := time.Now().UTC()
+	var due []models.Job
+
+	err := jobs.Update(func(docs map[string]json.RawMessage) error {
+		for id, raw := range docs {
+			var job models.Job
+			if err := json.Unmarshal(raw, &job); err != nil {
+				return err
+			}
+
+			// Forget finished jobs once the retention period is over
+			if (job.Status == models.JobStatusDone || job.Status == models.JobStatusFailed || job.Status == models.JobStatusCancelled) &&
+				now.Sub(job.UpdatedAt) > jobRetentionPeriod {
+				delete(docs, id)
+				continue
+			}
+
+			if job.Status != models.JobStatusPending || job.RunAt.After(now) {
+				continue
+			}
+
+			job.Status = models.JobStatusRunning
+			job.Attempts++
+			job.UpdatedAt = now
+			updated, err := json.Marshal(job)
+			if err != nil {
+				return err
+			}
+			docs[id] = updated
+			due = append(due, job)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["JobError"], err.Error())
+		return
+	}
+
+	for _, job := range due {
+		finishJob(job, runJob(job))
+	}
+}
+
+// finishJob stores the outcome of a job run
+func finishJob(job models.Job, runErr error) {
+	job.UpdatedAt = time.Now().UTC()
+
+	switch {
+	case runErr == nil:
+		job.Status = models.JobStatusDone
+		job.LastError = ""
+		logger.LogFunction("info", constants.Messages.Backend.Info["JobCompleted"], map[string]string{
+			"id":   job.ID,
+			"type": string(job.Type),
+		})
+	case errors.Is(runErr, errJobCancelled):
+		job.Status = models.JobStatusCancelled
+		job.LastError = runErr.Error()
+		logger.LogFunction("info", constants.Messages.Backend.Info["JobCancelled"], map[string]string{
+			"id":     job.ID,
+			"type":   string(job.Type),
+			"reason": runErr.Error(),
+		})
+	case job.Attempts < job.MaxAttempts:
+		job.Status = models.JobStatusPending
+		job.LastError = runErr.Error()
+		job.RunAt = job.UpdatedAt.Add(time.Duration(1<<job.Attempts) * time.Minute)
+		logger.LogFunction("warn", constants.Messages.Backend.Warn["JobRetry"], map[string]string{
+			"id":    job.ID,
+			"type":  string(job.Type),
+			"error": runErr.Error(),
+		})
+	default:
+		job.Status = models.JobStatusFailed
+		job.LastError = runErr.Error()
+		logger.LogFunction("error", constants.Messages.Backend.Error["JobFailed"], map[string]string{
+			"id":    job.ID,
+			"type":  string(job.Type),
+			"error": runErr.Error(),
+		})
+		if job.Type == models.JobTypeNotification {
+			deadLetterNotification(job)
+		}
+	}
+
+	// Jobs cancelled while running are not brought back
+	err := jobs.Update(func(docs map[string]json.RawMessage) error {
+		if _, ok := docs[job.ID]; !ok {
+			return nil
+		}
+		updated, err := json.Marshal(job)
+		if err != nil {
+			return err
+		}
+		docs[job.ID] = updated
+		return nil
+	})
+	if err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["JobError"], err.Error())
+	}
+}
+
+// runJob dispatches a job to the function that implements its type
+func runJob(job models.Job) error {
+	switch job.Type {
+	case models.JobTypeResourceEmail:
+		var payload models.ResourceEmailJobPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return err
+		}
+		sent, err := SendResourceEmail(models.JobActor(job.ID), models.ResourceEmailOptions{
+			Email:         job.Email,
+			ResourceID:    payload.ResourceID,
+			ResourceTitle: GenerateResourceTitle(payload.ResourceID, ""),
+			ResourceLink:  GenerateResourceURL(payload.FileID),
+		})
+		if err == nil && !sent {
+			err = fmt.Errorf(constants.Messages.Service.Email["Failed"])
+		}
+		return err
+
+	case models.JobTypeResumeSubscription:
+		unlock := lockEmail(job.Email)
+		defer unlock()
+		return ResumeSubscription(models.JobActor(job.ID), job.Email)
+
+	case models.JobTypeNotification:
+		var payload models.NotificationJobPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return err
+		}
+		return deliverNotification(payload)
+
+	case models.JobTypeSecondarySync:
+		return syncSecondary(job)
+
+	case models.JobTypeAddTags:
+		var payload models.TagsJobPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return err
+		}
+		if failed, err := AddTagsToSubscriber(models.JobActor(job.ID), payload.SubscriberID, payload.Tags); len(failed) > 0 {
+			return fmt.Errorf("adding tags %s failed: %w", strings.Join(failed, ", "), err)
+		}
+		return nil
+
+	case models.JobTypeDripEmail:
+		return runDripJob(job)
+
+	default:
+		return fmt.Errorf("unknown job type %q", job.Type)
+	}
+}
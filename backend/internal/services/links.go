@@ -0,0 +1,140 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// LinkPurposePreferences identifies tokens that open the preference center
+	LinkPurposePreferences = "preferences"
+	// LinkPurposeDataExport identifies tokens that allow downloading a subscriber's data
+	LinkPurposeDataExport = "data_export"
+	// LinkPurposeDataErasure identifies tokens that allow erasing a subscriber's data
+	LinkPurposeDataErasure = "data_erasure"
+	// LinkPurposeUnsubscribe identifies tokens that unsubscribe a subscriber in one click
+	LinkPurposeUnsubscribe = "unsubscribe"
+
+	// preferencesLinkTTL is how long a preference center link stays valid
+	preferencesLinkTTL = 30 * 24 * time.Hour
+	// privacyLinkTTL is how long a data export or erasure link stays valid
+	privacyLinkTTL = 24 * time.Hour
+	// unsubscribeLinkTTL is how long the unsubscribe link of an email stays valid, as it is kept in inboxes
+	unsubscribeLinkTTL = 365 * 24 * time.Hour
+)
+
+var (
+	// ErrInvalidToken is returned when a signed link is malformed, tampered with or expired
+	ErrInvalidToken = errors.New("invalid or expired signed link")
+	// ErrSignedLinksDisabled is returned when no link signing secret is configured
+	ErrSignedLinksDisabled = errors.New("signed links are disabled: LINK_SIGNING_SECRET is not set")
+)
+
+// linkClaims is the payload of a signed link token
+type linkClaims struct {
+	Email   string `json:"e"`
+	Purpose string `json:"p"`
+	Expires int64  `json:"x"`
+}
+
+// signLinkPayload returns the HMAC-SHA256 of a payload with the configured secret
+func signLinkPayload(payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(conf().Security.LinkSecret))
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// SignEmailToken creates a token proving control of an email address for a given purpose
+func SignEmailToken(email, purpose string, ttl time.Duration) (string, error) {
+	if conf().Security.LinkSecret == "" {
+		return "", ErrSignedLinksDisabled
+	}
+
+	claims, err := json.Marshal(linkClaims{
+		Email:   email,
+		Purpose: purpose,
+		Expires: time.Now().Add(ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+	signature := base64.RawURLEncoding.EncodeToString(signLinkPayload(payload))
+	return payload + "." + signature, nil
+}
+
+// VerifyEmailToken checks a token's signature, purpose and expiry and returns its email
+func VerifyEmailToken(token, purpose string) (string, error) {
+	if conf().Security.LinkSecret == "" {
+		return "", ErrSignedLinksDisabled
+	}
+
+	payload, signature, found := strings.Cut(token, ".")
+	if !found {
+		return "", ErrInvalidToken
+	}
+
+	expected, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, signLinkPayload(payload)) {
+		return "", ErrInvalidToken
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+
+	var claims linkClaims
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return "", ErrInvalidToken
+	}
+	if claims.Purpose != purpose || time.Now().Unix() > claims.Expires || claims.Email == "" {
+		return "", ErrInvalidToken
+	}
+
+	return claims.Email, nil
+}
+
+// signedPageURL returns a site page URL carrying a signed token for the email,
+// or an empty string when signed links are disabled
+func signedPageURL(page, email, purpose string, ttl time.Duration) string {
+	token, err := SignEmailToken(email, purpose, ttl)
+	if err != nil {
+		return ""
+	}
+
+	separator := "?"
+	if strings.Contains(page, "?") {
+		separator = "&"
+	}
+	return conf().Site.URL + page + separator + "token=" + url.QueryEscape(token)
+}
+
+// PreferencesURL returns the signed preference center link of an email,
+// or an empty string when signed links are disabled
+func PreferencesURL(email string) string {
+	return signedPageURL("/preferences", email, LinkPurposePreferences, preferencesLinkTTL)
+}
+
+// DataExportURL returns the signed link from which a subscriber downloads their data
+func DataExportURL(email string) string {
+	return signedPageURL("/my-data?action=export", email, LinkPurposeDataExport, privacyLinkTTL)
+}
+
+// DataErasureURL returns the signed link from which a subscriber erases their data
+func DataErasureURL(email string) string {
+	return signedPageURL("/my-data?action=erase", email, LinkPurposeDataErasure, privacyLinkTTL)
+}
+
+// OneClickUnsubscribeURL returns the signed API endpoint that unsubscribes an email when mail
+// clients POST to it, or an empty string when signed links are disabled
+func OneClickUnsubscribeURL(email string) string {
+	return signedPageURL("/api/v1/unsubscribe/one-click", email, LinkPurposeUnsubscribe, unsubscribeLinkTTL)
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/internal/store"
+)
+
+// errLocalSubscriberNotFound is returned when a subscriber ID is not on the local list
+var errLocalSubscriberNotFound = errors.New("subscriber not found on the local list")
+
+// localList is the self-hosted subscriber list, keyed by lowercased email
+var localList = store.NewCollection("list.json")
+
+// localProvider keeps the list in DATA_DIR, without any third-party service. Sending the
+// newsletter itself is left to whatever tool reads the list or its exports.
+type localProvider struct{}
+
+// Name identifies the provider
+func (localProvider) Name() string {
+	return "local"
+}
+
+// FindSubscriber returns the subscriber of an email
+func (localProvider) FindSubscriber(email string) (*models.Subscriber, error) {
+	var subscriber models.Subscriber
+	found, err := localList.Get(mirrorKey(email), &subscriber)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &subscriber, nil
+}
+
+// CreateSubscriber adds an email with its campaign attribution, or returns the existing subscriber
+func (localProvider) CreateSubscriber(email string, attribution models.Attribution) (*models.Subscriber, error) {
+	var subscriber models.Subscriber
+	err := localList.Update(func(docs map[string]json.RawMessage) error {
+		if raw, ok := docs[mirrorKey(email)]; ok {
+			return json.Unmarshal(raw, &subscriber)
+		}
+
+		subscriber = models.Subscriber{
+			ID:            generateUniqueID(),
+			Email:         email,
+			Tags:          []string{},
+			Status:        "active",
+			Created:       time.Now().Unix(),
+			UtmSource:     attribution.UtmSource,
+			UtmMedium:     attribution.UtmMedium,
+			UtmCampaign:   attribution.UtmCampaign,
+			ReferringSite: attribution.ReferringSite,
+		}
+		created, err := json.Marshal(subscriber)
+		if err != nil {
+			return err
+		}
+		docs[mirrorKey(email)] = created
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &subscriber, nil
+}
+
+// updateLocalSubscriber applies update to the subscriber with the given ID
+func updateLocalSubscriber(subscriberID string, update func(subscriber *models.Subscriber)) error {
+	return localList.Update(func(docs map[string]json.RawMessage) error {
+		for key, raw := range docs {
+			var subscriber models.Subscriber
+			if err := json.Unmarshal(raw, &subscriber); err != nil {
+				return err
+			}
+			if subscriber.ID != subscriberID {
+				continue
+			}
+
+			update(&subscriber)
+			updated, err := json.Marshal(subscriber)
+			if err != nil {
+				return err
+			}
+			docs[key] = updated
+			return nil
+		}
+		return errLocalSubscriberNotFound
+	})
+}
+
+// AddTag adds a tag to a subscriber
+func (p localProvider) AddTag(subscriberID, tag string) error {
+	return p.AddTags(subscriberID, []string{tag})
+}
+
+// AddTags adds several tags to a subscriber with a single update
+func (localProvider) AddTags(subscriberID string, tags []string) error {
+	return updateLocalSubscriber(subscriberID, func(subscriber *models.Subscriber) {
+		for _, tag := range tags {
+			if !hasTags(subscriber.Tags, []string{tag}) {
+				subscriber.Tags = append(subscriber.Tags, tag)
+			}
+		}
+	})
+}
+
+// RemoveTag removes a tag from a subscriber
+func (localProvider) RemoveTag(subscriberID, tag string) error {
+	return updateLocalSubscriber(subscriberID, func(subscriber *models.Subscriber) {
+		tags := []string{}
+		for _, current := range subscriber.Tags {
+			if !strings.EqualFold(current, tag) {
+				tags = append(tags, current)
+			}
+		}
+		subscriber.Tags = tags
+	})
+}
+
+// DeleteSubscriber removes the subscriber from the list
+func (localProvider) DeleteSubscriber(subscriber models.Subscriber) error {
+	return localList.Delete(mirrorKey(subscriber.Email))
+}
+
+// EachSubscription calls fn with every subscriber on the list with the given status
+func (localProvider) EachSubscription(status string, fn func(subscriber models.Subscriber) error) error {
+	return localList.ForEach(func(_ string, raw json.RawMessage) error {
+		var subscriber models.Subscriber
+		if err := json.Unmarshal(raw, &subscriber); err != nil {
+			return err
+		}
+		if status != "" && subscriber.Status != status {
+			return nil
+		}
+		return fn(subscriber)
+	})
+}
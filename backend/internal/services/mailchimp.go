@@ -0,0 +1,197 @@
+package services
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+// mailchimpProvider keeps the list in a Mailchimp audience. Members are identified by the MD5
+// hash of their lowercased email, which is used as the subscriber ID.
+type mailchimpProvider struct{}
+
+// mailchimpMember is a member of a Mailchimp audience
+type mailchimpMember struct {
+	ID              string `json:"id"`
+	EmailAddress    string `json:"email_address"`
+	Status          string `json:"status"`
+	TimestampSignup string `json:"timestamp_signup"`
+	Tags            []struct {
+		Name string `json:"name"`
+	} `json:"tags"`
+}
+
+// subscriber converts a Mailchimp member to the common subscriber model
+func (member mailchimpMember) subscriber() *models.Subscriber {
+	subscriber := &models.Subscriber{
+		ID:     member.ID,
+		Email:  member.EmailAddress,
+		Tags:   []string{},
+		Status: "inactive",
+	}
+	switch member.Status {
+	case "subscribed":
+		subscriber.Status = "active"
+	case "pending":
+		subscriber.Status = "pending"
+	}
+	for _, tag := range member.Tags {
+		subscriber.Tags = append(subscriber.Tags, tag.Name)
+	}
+	if signup, err := time.Parse(time.RFC3339, member.TimestampSignup); err == nil {
+		subscriber.Created = signup.Unix()
+	}
+	return subscriber
+}
+
+// Name identifies the provider
+func (mailchimpProvider) Name() string {
+	return "mailchimp"
+}
+
+// memberURL returns the API URL of an audience member, optionally followed by a sub-resource
+func (mailchimpProvider) memberURL(subscriberID, resource string) string {
+	dataCenter := conf().Mailchimp.APIKey[strings.LastIndex(conf().Mailchimp.APIKey, "-")+1:]
+	url := fmt.Sprintf("https://%s.api.mailchimp.com/3.0/lists/%s/members/%s",
+		dataCenter, conf().Mailchimp.ListID, subscriberID)
+	if resource != "" {
+		url += "/" + resource
+	}
+	return url
+}
+
+// authorize sets the basic credentials Mailchimp expects, any user name with the API key
+func (mailchimpProvider) authorize(req *http.Request) {
+	req.SetBasicAuth("apikey", conf().Mailchimp.APIKey)
+}
+
+// mailchimpSubscriberID returns the member ID of an email in any Mailchimp audience
+func mailchimpSubscriberID(email string) string {
+	sum := md5.Sum([]byte(canonicalEmail(email)))
+	return hex.EncodeToString(sum[:])
+}
+
+// FindSubscriber returns the audience member of an email. Members who unsubscribed, were
+// cleaned or archived stay in the audience but are not on the list.
+func (p mailchimpProvider) FindSubscriber(email string) (*models.Subscriber, error) {
+	status, body, err := providerRequest("GET", p.memberURL(mailchimpSubscriberID(email), ""), nil, p.authorize)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if !isSuccess(status) {
+		return nil, providerStatusError(p.Name(), "find subscriber", status, body)
+	}
+
+	var member mailchimpMember
+	if err := json.Unmarshal(body, &member); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["UnmarshalError"], err.Error())
+		return nil, err
+	}
+	if member.Status != "subscribed" && member.Status != "pending" {
+		return nil, nil
+	}
+	return member.subscriber(), nil
+}
+
+// CreateSubscriber adds or resubscribes an audience member. Mailchimp has no native campaign
+// attributes and merge fields depend on each audience, so attribution is only kept locally.
+func (p mailchimpProvider) CreateSubscriber(email string, attribution models.Attribution) (*models.Subscriber, error) {
+	data := map[string]interface{}{
+		"email_address": email,
+		"status":        "subscribed",
+		"status_if_new": "subscribed",
+	}
+
+	status, body, err := providerRequest("PUT", p.memberURL(mailchimpSubscriberID(email), ""), data, p.authorize)
+	if err != nil {
+		return nil, err
+	}
+	if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+		return nil, providerStatusError(p.Name(), "create subscriber", status, body)
+	}
+	if !isSuccess(status) {
+		// Mailchimp refuses fake, compliance-blocked and permanently deleted emails
+		logger.LogFunction("error", constants.Messages.Backend.Error["CreateSubscriberError"], string(body))
+		return nil, nil
+	}
+
+	var member mailchimpMember
+	if err := json.Unmarshal(body, &member); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["UnmarshalError"], err.Error())
+		return nil, err
+	}
+	return member.subscriber(), nil
+}
+
+// updateTags activates or deactivates tags of an audience member, creating them if needed
+func (p mailchimpProvider) updateTags(subscriberID string, tags []string, tagStatus string) error {
+	updates := make([]map[string]string, 0, len(tags))
+	for _, tag := range tags {
+		updates = append(updates, map[string]string{"name": tag, "status": tagStatus})
+	}
+	data := map[string]interface{}{"tags": updates}
+
+	status, body, err := providerRequest("POST", p.memberURL(subscriberID, "tags"), data, p.authorize)
+	if err != nil {
+		return err
+	}
+	if !isSuccess(status) {
+		return providerStatusError(p.Name(), "update tags", status, body)
+	}
+	return nil
+}
+
+// AddTag adds a tag to an audience member
+func (p mailchimpProvider) AddTag(subscriberID, tag string) error {
+	return p.updateTags(subscriberID, []string{tag}, "active")
+}
+
+// AddTags adds several tags to an audience member in a single request
+func (p mailchimpProvider) AddTags(subscriberID string, tags []string) error {
+	return p.updateTags(subscriberID, tags, "active")
+}
+
+// RemoveTag removes a tag from an audience member
+func (p mailchimpProvider) RemoveTag(subscriberID, tag string) error {
+	return p.updateTags(subscriberID, []string{tag}, "inactive")
+}
+
+// EraseSubscriber permanently deletes the audience member, who can then only subscribe again
+// through a Mailchimp hosted form. The member ID is derived from the email, which is enough
+// once the member is unsubscribed and no longer found.
+func (p mailchimpProvider) EraseSubscriber(subscriber models.Subscriber) error {
+	status, body, err := providerRequest("POST", p.memberURL(mailchimpSubscriberID(subscriber.Email), "actions/delete-permanent"), nil, p.authorize)
+	if err != nil {
+		return err
+	}
+	if !isSuccess(status) && status != http.StatusNotFound {
+		return providerStatusError(p.Name(), "erase subscriber", status, body)
+	}
+	return nil
+}
+
+// DeleteSubscriber unsubscribes the audience member. The member is kept, as Mailchimp requires
+// to honor the unsubscribe, and can subscribe again later.
+func (p mailchimpProvider) DeleteSubscriber(subscriber models.Subscriber) error {
+	data := map[string]string{"status": "unsubscribed"}
+
+	status, body, err := providerRequest("PATCH", p.memberURL(subscriber.ID, ""), data, p.authorize)
+	if err != nil {
+		return err
+	}
+	if !isSuccess(status) {
+		return providerStatusError(p.Name(), "delete subscriber", status, body)
+	}
+	return nil
+}
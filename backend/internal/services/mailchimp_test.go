@@ -0,0 +1,124 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+)
+
+// mailchimpMemberPath is the path of the test audience member as the fake API receives it
+const mailchimpMemberPath = "/3.0/lists/list_test/members/cdb9d6a1dddc375a09cc83e3001598dc"
+
+// fakeMailchimp points the Mailchimp API at the recorded routes
+func fakeMailchimp(t *testing.T, routes map[string]recordedRoute) func() []providerCall {
+	calls := fakeProviderAPI(t, "mailchimp", recordedAPI(t, routes))
+	conf().Mailchimp.APIKey = "0123456789abcdef-us21"
+	conf().Mailchimp.ListID = "list_test"
+	return calls
+}
+
+func TestMailchimpFindSubscriber(t *testing.T) {
+	calls := fakeMailchimp(t, map[string]recordedRoute{
+		"GET " + mailchimpMemberPath: {http.StatusOK, "mailchimp/member_subscribed.json"},
+	})
+
+	subscriber, err := (mailchimpProvider{}).FindSubscriber("Ana@Example.com")
+	if err != nil {
+		t.Fatalf("FindSubscriber: %v", err)
+	}
+	if subscriber == nil || subscriber.Status != "active" || len(subscriber.Tags) != 1 || subscriber.Tags[0] != "homelab" || subscriber.Created == 0 {
+		t.Errorf("subscriber = %+v", subscriber)
+	}
+	if user, key, ok := (&http.Request{Header: calls()[0].Header}).BasicAuth(); !ok || user != "apikey" || key != conf().Mailchimp.APIKey {
+		t.Errorf("credentials = %q %q", user, key)
+	}
+}
+
+func TestMailchimpFindSubscriberNotOnTheList(t *testing.T) {
+	for fixture, status := range map[string]int{
+		"mailchimp/member_unsubscribed.json": http.StatusOK,
+		"mailchimp/resource_not_found.json":  http.StatusNotFound,
+	} {
+		t.Run(fixture, func(t *testing.T) {
+			fakeMailchimp(t, map[string]recordedRoute{
+				"GET " + mailchimpMemberPath: {status, fixture},
+			})
+			if subscriber, err := (mailchimpProvider{}).FindSubscriber("ana@example.com"); err != nil || subscriber != nil {
+				t.Errorf("subscriber = %+v, err = %v; want neither", subscriber, err)
+			}
+		})
+	}
+}
+
+func TestMailchimpCreateSubscriber(t *testing.T) {
+	calls := fakeMailchimp(t, map[string]recordedRoute{
+		"PUT " + mailchimpMemberPath: {http.StatusOK, "mailchimp/member_subscribed.json"},
+	})
+
+	subscriber, err := (mailchimpProvider{}).CreateSubscriber("ana@example.com", models.Attribution{})
+	if err != nil || subscriber == nil || subscriber.ID != "cdb9d6a1dddc375a09cc83e3001598dc" {
+		t.Fatalf("CreateSubscriber = %+v, %v", subscriber, err)
+	}
+	if got := calls()[0].Body; got != `{"email_address":"ana@example.com","status":"subscribed","status_if_new":"subscribed"}` {
+		t.Errorf("body = %s", got)
+	}
+}
+
+func TestMailchimpCreateSubscriberRefused(t *testing.T) {
+	fakeMailchimp(t, map[string]recordedRoute{
+		"PUT " + mailchimpMemberPath: {http.StatusBadRequest, "mailchimp/forgotten_email.json"},
+	})
+	if subscriber, err := (mailchimpProvider{}).CreateSubscriber("ana@example.com", models.Attribution{}); err != nil || subscriber != nil {
+		t.Errorf("CreateSubscriber = %+v, %v; want a refusal without an error", subscriber, err)
+	}
+}
+
+func TestMailchimpCreateSubscriberServerError(t *testing.T) {
+	fakeMailchimp(t, map[string]recordedRoute{
+		"PUT " + mailchimpMemberPath: {http.StatusInternalServerError, "mailchimp/internal_error.json"},
+	})
+	if _, err := (mailchimpProvider{}).CreateSubscriber("ana@example.com", models.Attribution{}); err == nil {
+		t.Error("a server error was taken for a refusal")
+	}
+}
+
+func TestMailchimpTags(t *testing.T) {
+	calls := fakeMailchimp(t, map[string]recordedRoute{
+		"POST " + mailchimpMemberPath + "/tags": {http.StatusNoContent, ""},
+	})
+
+	id := mailchimpSubscriberID("ana@example.com")
+	if err := (mailchimpProvider{}).AddTags(id, []string{"homelab", "devops"}); err != nil {
+		t.Fatalf("AddTags: %v", err)
+	}
+	if err := (mailchimpProvider{}).RemoveTag(id, "paused"); err != nil {
+		t.Fatalf("RemoveTag: %v", err)
+	}
+
+	received := calls()
+	if got := received[0].Body; got != `{"tags":[{"name":"homelab","status":"active"},{"name":"devops","status":"active"}]}` {
+		t.Errorf("add body = %s", got)
+	}
+	if got := received[1].Body; got != `{"tags":[{"name":"paused","status":"inactive"}]}` {
+		t.Errorf("remove body = %s", got)
+	}
+}
+
+func TestMailchimpDeleteAndEraseSubscriber(t *testing.T) {
+	calls := fakeMailchimp(t, map[string]recordedRoute{
+		"PATCH " + mailchimpMemberPath:                              {http.StatusOK, "mailchimp/member_unsubscribed.json"},
+		"POST " + mailchimpMemberPath + "/actions/delete-permanent": {http.StatusNoContent, ""},
+	})
+
+	subscriber := models.Subscriber{ID: mailchimpSubscriberID("ana@example.com"), Email: "ana@example.com"}
+	if err := (mailchimpProvider{}).DeleteSubscriber(subscriber); err != nil {
+		t.Fatalf("DeleteSubscriber: %v", err)
+	}
+	if got := calls()[0].Body; got != `{"status":"unsubscribed"}` {
+		t.Errorf("body = %s", got)
+	}
+	if err := (mailchimpProvider{}).EraseSubscriber(subscriber); err != nil {
+		t.Errorf("EraseSubscriber: %v", err)
+	}
+}
@@ -0,0 +1,523 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/internal/store"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// lastReconciliationKey is the mirror state entry holding the last drift report
+	lastReconciliationKey = "lastReconciliation"
+	// maxDriftEntries caps the drift entries kept in a report; the counts are always complete
+	maxDriftEntries = 500
+)
+
+// ErrReconcileRunning is returned when a reconciliation is requested while another one runs
+var ErrReconcileRunning = errors.New("reconciliation is already running")
+
+var (
+	// mirror is the local copy of the audience, with the subscribers keyed by canonical email
+	// and an index from their subscription IDs to those keys
+	mirror = store.NewDB("mirror.db")
+	// mirrorState keeps the last reconciliation report, drifted emails included
+	mirrorState = store.NewCollection("mirror.json")
+	// driftLog keeps the history of reconciliations, without the drifted emails
+	driftLog = store.NewLog("drift.jsonl")
+
+	reconcileMu sync.Mutex
+
+	mirrorSubscribersBucket = []byte("subscribers")
+	mirrorIDsBucket         = []byte("subscriptionIds")
+)
+
+// mirrorKey returns the mirror key of an email
+func mirrorKey(email string) string {
+	return canonicalEmail(email)
+}
+
+// mirrorBuckets returns the subscribers bucket and the subscription ID index, creating them in
+// writable transactions. In read-only ones they are nil until a subscriber has been mirrored.
+func mirrorBuckets(tx *bolt.Tx) (*bolt.Bucket, *bolt.Bucket, error) {
+	if !tx.Writable() {
+		return tx.Bucket(mirrorSubscribersBucket), tx.Bucket(mirrorIDsBucket), nil
+	}
+	subscribers, err := tx.CreateBucketIfNotExists(mirrorSubscribersBucket)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids, err := tx.CreateBucketIfNotExists(mirrorIDsBucket)
+	return subscribers, ids, err
+}
+
+// getMirrored decodes the mirror record stored under an email key, or returns nil
+func getMirrored(subscribers *bolt.Bucket, key string) (*models.MirroredSubscriber, error) {
+	if subscribers == nil {
+		return nil, nil
+	}
+	raw := subscribers.Get([]byte(key))
+	if raw == nil {
+		return nil, nil
+	}
+	var record models.MirroredSubscriber
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// mirroredKeyByID returns the email key of the mirror record with a subscription ID, or ""
+func mirroredKeyByID(ids *bolt.Bucket, subscriptionID string) string {
+	if ids == nil || subscriptionID == "" {
+		return ""
+	}
+	return string(ids.Get([]byte(subscriptionID)))
+}
+
+// putMirrored stores a mirror record under its email and indexes its subscription ID,
+// dropping the index entry of the ID it replaces
+func putMirrored(subscribers, ids *bolt.Bucket, record models.MirroredSubscriber) error {
+	key := mirrorKey(record.Email)
+	previous, err := getMirrored(subscribers, key)
+	if err != nil {
+		return err
+	}
+	if previous != nil && previous.ID != "" && previous.ID != record.ID {
+		if err := ids.Delete([]byte(previous.ID)); err != nil {
+			return err
+		}
+	}
+
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := subscribers.Put([]byte(key), raw); err != nil {
+		return err
+	}
+	if record.ID == "" {
+		return nil
+	}
+	return ids.Put([]byte(record.ID), []byte(key))
+}
+
+// normalizedTags returns the tags lowercased and sorted, to compare tag sets
+func normalizedTags(tags []string) []string {
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		result = append(result, strings.ToLower(tag))
+	}
+	sort.Strings(result)
+	return result
+}
+
+// mirroredSubscriber returns the mirrored subscriber of an email, unless it is unknown or deleted
+func mirroredSubscriber(email string) (*models.Subscriber, bool) {
+	record, _, err := MirrorRecord(email)
+	if err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["MirrorError"], err.Error())
+		return nil, false
+	}
+	if record == nil || record.Status == models.MirrorStatusDeleted {
+		return nil, false
+	}
+	return &record.Subscriber, true
+}
+
+// mirrorSubscriber stores the current state of a subscriber in the mirror. Mirror
+// failures are logged and never fail the operation that triggered them.
+func mirrorSubscriber(subscriber models.Subscriber) {
+	if subscriber.Email == "" {
+		return
+	}
+	if subscriber.Status == "" {
+		subscriber.Status = "active"
+	}
+
+	err := mirror.Update(func(tx *bolt.Tx) error {
+		subscribers, ids, err := mirrorBuckets(tx)
+		if err != nil {
+			return err
+		}
+		return putMirrored(subscribers, ids, models.MirroredSubscriber{
+			Subscriber: subscriber,
+			UpdatedAt:  time.Now().UTC(),
+		})
+	})
+	if err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["MirrorError"], err.Error())
+	}
+}
+
+// mirroredByID returns the mirror record with the given subscription ID, deleted ones included
+func mirroredByID(subscriptionID string) (*models.MirroredSubscriber, bool) {
+	var found *models.MirroredSubscriber
+	err := mirror.View(func(tx *bolt.Tx) error {
+		subscribers, ids, _ := mirrorBuckets(tx)
+		key := mirroredKeyByID(ids, subscriptionID)
+		if key == "" {
+			return nil
+		}
+		var err error
+		found, err = getMirrored(subscribers, key)
+		return err
+	})
+	if err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["MirrorError"], err.Error())
+		return nil, false
+	}
+	return found, found != nil
+}
+
+// mirroredEmail returns the email of the mirrored subscriber with the given subscription ID
+func mirroredEmail(subscriptionID string) (string, bool) {
+	record, ok := mirroredByID(subscriptionID)
+	if !ok {
+		return "", false
+	}
+	return record.Email, true
+}
+
+// mirrorTag adds or removes a tag of the mirrored subscriber with the given subscription ID
+func mirrorTag(subscriptionID, tag string, add bool) {
+	err := mirror.Update(func(tx *bolt.Tx) error {
+		subscribers, ids, err := mirrorBuckets(tx)
+		if err != nil {
+			return err
+		}
+		record, err := getMirrored(subscribers, mirroredKeyByID(ids, subscriptionID))
+		if err != nil || record == nil {
+			return err
+		}
+
+		tags := []string{}
+		for _, current := range record.Tags {
+			if !strings.EqualFold(current, tag) {
+				tags = append(tags, current)
+			}
+		}
+		if add {
+			tags = append(tags, tag)
+		}
+		record.Tags = tags
+		record.UpdatedAt = time.Now().UTC()
+		return putMirrored(subscribers, ids, *record)
+	})
+	if err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["MirrorError"], err.Error())
+	}
+}
+
+// forgetSubscriber marks the mirrored subscriber of an email as deleted
+func forgetSubscriber(email string) {
+	// Most lookups of unknown emails have nothing to forget: skip rewriting the mirror
+	if _, ok := mirroredSubscriber(email); !ok {
+		return
+	}
+
+	err := mirror.Update(func(tx *bolt.Tx) error {
+		subscribers, ids, err := mirrorBuckets(tx)
+		if err != nil {
+			return err
+		}
+		record, err := getMirrored(subscribers, mirrorKey(email))
+		if err != nil || record == nil || record.Status == models.MirrorStatusDeleted {
+			return err
+		}
+		record.Status = models.MirrorStatusDeleted
+		record.Tags = nil
+		record.UpdatedAt = time.Now().UTC()
+		return putMirrored(subscribers, ids, *record)
+	})
+	if err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["MirrorError"], err.Error())
+	}
+}
+
+// eraseMirror removes an email from the mirror and from the last drift report, returning
+// how many records were removed
+func eraseMirror(email string) (int, error) {
+	removed := 0
+	err := mirror.Update(func(tx *bolt.Tx) error {
+		subscribers, ids, err := mirrorBuckets(tx)
+		if err != nil {
+			return err
+		}
+		record, err := getMirrored(subscribers, mirrorKey(email))
+		if err != nil || record == nil {
+			return err
+		}
+		if record.ID != "" && mirroredKeyByID(ids, record.ID) == mirrorKey(email) {
+			if err := ids.Delete([]byte(record.ID)); err != nil {
+				return err
+			}
+		}
+		removed++
+		return subscribers.Delete([]byte(mirrorKey(email)))
+	})
+	if err != nil {
+		return removed, err
+	}
+
+	err = mirrorState.Update(func(docs map[string]json.RawMessage) error {
+		raw, ok := docs[lastReconciliationKey]
+		if !ok {
+			return nil
+		}
+
+		var report models.DriftReport
+		if err := json.Unmarshal(raw, &report); err != nil {
+			return err
+		}
+		entries := report.Entries[:0]
+		for _, entry := range report.Entries {
+			if sameEmail(entry.Email, email) {
+				removed++
+				continue
+			}
+			entries = append(entries, entry)
+		}
+		report.Entries = entries
+
+		updated, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+		docs[lastReconciliationKey] = updated
+		return nil
+	})
+	return removed, err
+}
+
+// MirrorRecord returns the mirror record of an email, deleted ones included, and whether it exists
+func MirrorRecord(email string) (*models.MirroredSubscriber, bool, error) {
+	var record *models.MirroredSubscriber
+	err := mirror.View(func(tx *bolt.Tx) error {
+		subscribers, _, _ := mirrorBuckets(tx)
+		var err error
+		record, err = getMirrored(subscribers, mirrorKey(email))
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return record, record != nil, nil
+}
+
+// GetMirrorStatus counts the mirrored subscribers by status and returns the last drift report
+func GetMirrorStatus() (*models.MirrorStatus, error) {
+	status := &models.MirrorStatus{ByStatus: map[string]int{}}
+	err := mirror.View(func(tx *bolt.Tx) error {
+		subscribers, _, _ := mirrorBuckets(tx)
+		if subscribers == nil {
+			return nil
+		}
+		return subscribers.ForEach(func(_, raw []byte) error {
+			var record models.MirroredSubscriber
+			if err := json.Unmarshal(raw, &record); err != nil {
+				return err
+			}
+			status.ByStatus[record.Status]++
+			if record.Status != models.MirrorStatusDeleted {
+				status.Subscribers++
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var report models.DriftReport
+	found, err := mirrorState.Get(lastReconciliationKey, &report)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		status.LastReconciliation = &report
+	}
+	return status, nil
+}
+
+// ReconcileMirror walks the whole list of the newsletter provider and brings the mirror in
+// line with it, the provider being the source of truth. The returned report counts every
+// difference found and lists up to maxDriftEntries of them; it is also kept as the last
+// reconciliation and summarized in the drift log.
+func ReconcileMirror() (*models.DriftReport, error) {
+	if !reconcileMu.TryLock() {
+		return nil, ErrReconcileRunning
+	}
+	defer reconcileMu.Unlock()
+
+	report := &models.DriftReport{
+		StartedAt: time.Now().UTC(),
+		Counts:    map[models.DriftKind]int{},
+	}
+	drift := func(kind models.DriftKind, email string, local, remote interface{}) {
+		report.Counts[kind]++
+		if len(report.Entries) < maxDriftEntries {
+			report.Entries = append(report.Entries, models.DriftEntry{
+				Kind:   kind,
+				Email:  email,
+				Local:  local,
+				Remote: remote,
+			})
+		}
+	}
+
+	remote := map[string]models.Subscriber{}
+	err := EachSubscription(models.SubscriptionFilter{}, func(subscriber models.Subscriber) error {
+		if subscriber.Status == "" {
+			subscriber.Status = "active"
+		}
+		remote[mirrorKey(subscriber.Email)] = subscriber
+		return nil
+	})
+	if err != nil {
+		return finishReconciliation(report, err)
+	}
+	report.Remote = len(remote)
+
+	now := time.Now().UTC()
+	err = mirror.Update(func(tx *bolt.Tx) error {
+		subscribers, ids, err := mirrorBuckets(tx)
+		if err != nil {
+			return err
+		}
+
+		// Records are collected first: bbolt buckets must not be changed while iterating them
+		records := map[string]models.MirroredSubscriber{}
+		err = subscribers.ForEach(func(key, raw []byte) error {
+			var record models.MirroredSubscriber
+			if err := json.Unmarshal(raw, &record); err != nil {
+				return err
+			}
+			records[string(key)] = record
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for key, record := range records {
+			if record.Status != models.MirrorStatusDeleted {
+				report.Local++
+			}
+
+			subscriber, ok := remote[key]
+			switch {
+			case !ok && record.Status == models.MirrorStatusDeleted:
+				continue
+			case !ok:
+				drift(models.DriftMissingRemotely, record.Email, record.Status, nil)
+				record.Status = models.MirrorStatusDeleted
+				record.Tags = nil
+				record.UpdatedAt = now
+			default:
+				if record.Status != subscriber.Status {
+					drift(models.DriftStatus, record.Email, record.Status, subscriber.Status)
+					record.UpdatedAt = now
+				}
+				local, current := normalizedTags(record.Tags), normalizedTags(subscriber.Tags)
+				if strings.Join(local, ",") != strings.Join(current, ",") {
+					drift(models.DriftTags, record.Email, local, current)
+					record.UpdatedAt = now
+				}
+				record.Subscriber = subscriber
+				record.SyncedAt = &now
+			}
+
+			if err := putMirrored(subscribers, ids, record); err != nil {
+				return err
+			}
+		}
+
+		for key, subscriber := range remote {
+			if _, ok := records[key]; ok {
+				continue
+			}
+			drift(models.DriftMissingLocally, subscriber.Email, nil, subscriber.Status)
+			err := putMirrored(subscribers, ids, models.MirroredSubscriber{
+				Subscriber: subscriber,
+				UpdatedAt:  now,
+				SyncedAt:   &now,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return finishReconciliation(report, err)
+}
+
+// finishReconciliation stores a drift report as the last reconciliation and appends its
+// summary to the drift log
+func finishReconciliation(report *models.DriftReport, err error) (*models.DriftReport, error) {
+	report.FinishedAt = time.Now().UTC()
+	if err != nil {
+		report.Error = err.Error()
+		logger.LogFunction("error", constants.Messages.Backend.Error["ReconcileError"], err.Error())
+	} else {
+		logger.LogFunction("info", constants.Messages.Backend.Info["MirrorReconciled"], map[string]interface{}{
+			"remote": report.Remote,
+			"local":  report.Local,
+			"drift":  report.Counts,
+		})
+	}
+
+	if storeErr := mirrorState.Put(lastReconciliationKey, report); storeErr != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["MirrorError"], storeErr.Error())
+	}
+	summary := *report
+	summary.Entries = nil
+	if storeErr := driftLog.Append(summary); storeErr != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["MirrorError"], storeErr.Error())
+	}
+	return report, err
+}
+
+// StartMirrorReconciler reconciles the mirror every interval until the context is cancelled.
+// The first run happens right away when the last reconciliation is older than the interval.
+func StartMirrorReconciler(ctx context.Context, interval time.Duration) {
+	go func() {
+		var last models.DriftReport
+		found, err := mirrorState.Get(lastReconciliationKey, &last)
+		if err != nil {
+			logger.LogFunction("error", constants.Messages.Backend.Error["MirrorError"], err.Error())
+		}
+
+		wait := time.Duration(0)
+		if found {
+			if elapsed := time.Since(last.FinishedAt); elapsed < interval {
+				wait = interval - elapsed
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+
+			if _, err := ReconcileMirror(); errors.Is(err, ErrReconcileRunning) {
+				logger.LogFunction("warn", constants.Messages.Backend.Warn["ReconcileSkipped"], err.Error())
+			}
+			timer.Reset(interval)
+		}
+	}()
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+)
+
+func TestMirrorIndexesSubscriptionIDs(t *testing.T) {
+	useTestConfig(t)
+
+	mirrorSubscriber(models.Subscriber{ID: "sub_1", Email: "Ana@Example.com", Tags: []string{"homelab"}})
+	if email, ok := mirroredEmail("sub_1"); !ok || email != "Ana@Example.com" {
+		t.Fatalf("mirroredEmail(sub_1) = %q, %v", email, ok)
+	}
+
+	mirrorTag("sub_1", "devops", true)
+	if subscriber, ok := mirroredSubscriber("ana@example.com"); !ok || len(subscriber.Tags) != 2 {
+		t.Errorf("mirroredSubscriber = %+v, %v; want both tags", subscriber, ok)
+	}
+
+	// A new subscription for the same email replaces the index entry of the old one
+	mirrorSubscriber(models.Subscriber{ID: "sub_2", Email: "ana@example.com"})
+	if _, ok := mirroredByID("sub_1"); ok {
+		t.Error("the replaced subscription ID is still indexed")
+	}
+	if record, ok := mirroredByID("sub_2"); !ok || record.Email != "ana@example.com" {
+		t.Errorf("mirroredByID(sub_2) = %+v, %v", record, ok)
+	}
+
+	if removed, err := eraseMirror("ana@example.com"); err != nil || removed != 1 {
+		t.Fatalf("eraseMirror = %d, %v", removed, err)
+	}
+	if _, ok := mirroredByID("sub_2"); ok {
+		t.Error("the erased subscriber is still indexed")
+	}
+	if status, err := GetMirrorStatus(); err != nil || status.Subscribers != 0 {
+		t.Errorf("GetMirrorStatus = %+v, %v; want an empty mirror", status, err)
+	}
+}
@@ -0,0 +1,556 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/pkg/config"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+// tagConcurrency bounds the tag requests sent at once to providers that cannot batch them
+const tagConcurrency = 4
+
+var (
+	loadedConf   *config.Config
+	loadConfErr  error
+	loadConfOnce sync.Once
+	// emptyConf stands in for an invalid configuration: providers, emails and signed links stay disabled
+	emptyConf config.Config
+)
+
+// LoadConfig loads the configuration used by the services the first time it is called and
+// returns it, or the error that makes it invalid. Loading is deferred so that importing the
+// services, as the CLI does, never fails.
+func LoadConfig() (*config.Config, error) {
+	loadConfOnce.Do(func() {
+		loadedConf, loadConfErr = config.GetConfig()
+		if loadConfErr != nil {
+			logger.LogFunction("error", constants.Messages.Backend.Error["ConfigError"], loadConfErr.Error())
+		}
+	})
+	return loadedConf, loadConfErr
+}
+
+// conf returns the configuration used by the services. The server and the CLI check
+// LoadConfig before calling them; with an invalid configuration an empty one is used.
+func conf() *config.Config {
+	loaded, err := LoadConfig()
+	if err != nil {
+		return &emptyConf
+	}
+	return loaded
+}
+
+var (
+	// ErrListingUnsupported is returned when the configured provider cannot walk its whole list
+	ErrListingUnsupported = errors.New("the newsletter provider does not support listing subscribers")
+	// ErrErasureUnsupported is returned when the provider offers no way to erase a subscriber
+	ErrErasureUnsupported = errors.New("the newsletter provider does not support erasing subscribers")
+)
+
+// Provider is a newsletter backend holding the subscriber list
+type Provider interface {
+	// Name identifies the provider, as set in NEWSLETTER_PROVIDER
+	Name() string
+	// FindSubscriber returns the subscriber with the given email, or nil when the email is not
+	// on the list. Errors are reserved for failures that leave the answer unknown.
+	FindSubscriber(email string) (*models.Subscriber, error)
+	// CreateSubscriber adds an email to the list with its campaign attribution. It returns nil
+	// without an error when the provider refuses the email.
+	CreateSubscriber(email string, attribution models.Attribution) (*models.Subscriber, error)
+	// AddTag adds a tag to a subscriber
+	AddTag(subscriberID, tag string) error
+	// RemoveTag removes a tag from a subscriber
+	RemoveTag(subscriberID, tag string) error
+	// DeleteSubscriber takes a subscriber off the list, following the provider's unsubscribe semantics
+	DeleteSubscriber(subscriber models.Subscriber) error
+}
+
+// SubscriptionLister is implemented by the providers able to walk their whole list
+type SubscriptionLister interface {
+	// EachSubscription calls fn with every subscriber with the given status, or every
+	// subscriber when status is empty, stopping at the first error
+	EachSubscription(status string, fn func(subscriber models.Subscriber) error) error
+}
+
+// TagBatcher is implemented by the providers able to add several tags in a single request
+type TagBatcher interface {
+	// AddTags adds every tag to a subscriber. The request succeeds or fails as a whole.
+	AddTags(subscriberID string, tags []string) error
+}
+
+// SubscriberEraser is implemented by the providers that keep the subscribers who leave, so
+// that data erasure requests can remove them for good
+type SubscriberEraser interface {
+	// EraseSubscriber permanently removes an unsubscribed subscriber from the provider
+	EraseSubscriber(subscriber models.Subscriber) error
+}
+
+// providers holds the available newsletter providers by name
+var providers = map[string]Provider{
+	"beehiiv":    beehiivProvider{},
+	"mailchimp":  mailchimpProvider{},
+	"convertkit": convertKitProvider{},
+	"buttondown": buttondownProvider{},
+	"local":      localProvider{},
+}
+
+// primaryProvider returns the provider selected by NEWSLETTER_PROVIDER
+func primaryProvider() Provider {
+	if provider, ok := providers[conf().Newsletter.Provider]; ok {
+		return provider
+	}
+	return providers["beehiiv"]
+}
+
+// newsletter returns the provider every change goes through: the primary one, wrapped to
+// fan out to NEWSLETTER_SECONDARY_PROVIDERS when there are any
+func newsletter() Provider {
+	primary := primaryProvider()
+	if len(conf().Newsletter.Secondaries) == 0 {
+		return primary
+	}
+
+	fanout := fanoutProvider{primary: primary}
+	for _, name := range conf().Newsletter.Secondaries {
+		if secondary, ok := providers[name]; ok && name != primary.Name() {
+			fanout.secondaries = append(fanout.secondaries, secondary)
+		}
+	}
+	if _, ok := primary.(TagBatcher); ok {
+		return batchingFanoutProvider{fanout}
+	}
+	return fanout
+}
+
+// ProviderName returns the name of the newsletter provider in use
+func ProviderName() string {
+	return newsletter().Name()
+}
+
+// ProviderSupportsListing reports whether the primary provider can walk its whole list, which
+// mirror reconciliation, exports and tag counts rely on
+func ProviderSupportsListing() bool {
+	_, ok := primaryProvider().(SubscriptionLister)
+	return ok
+}
+
+// providerRequest sends a request with an optional JSON body to a provider API and returns the
+// status code and the body of the answer. Only failures to reach the provider are errors.
+func providerRequest(method, url string, payload interface{}, authorize func(req *http.Request)) (int, []byte, error) {
+	var reader io.Reader
+	if payload != nil {
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			logger.LogFunction("error", constants.Messages.Backend.Error["MarshalError"], err.Error())
+			return 0, nil, err
+		}
+		reader = bytes.NewReader(jsonData)
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["RequestCreationError"], err.Error())
+		return 0, nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	authorize(req)
+
+	client := providerClient()
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["RequestExecutionError"], err.Error())
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["ResponseReadError"], err.Error())
+		return 0, nil, err
+	}
+	return resp.StatusCode, body, nil
+}
+
+// providerStatusError logs an unexpected answer of a provider API and returns it as an error
+func providerStatusError(provider, operation string, status int, body []byte) error {
+	logger.LogFunction("error", constants.Messages.Backend.Error["ProviderError"], map[string]interface{}{
+		"provider":  provider,
+		"operation": operation,
+		"status":    status,
+		"body":      string(body),
+	})
+	return fmt.Errorf("%s %s failed with status %d", provider, operation, status)
+}
+
+// isSuccess reports whether a status code is 2xx
+func isSuccess(status int) bool {
+	return status >= 200 && status < 300
+}
+
+// CheckSubscriber verifies if a subscriber exists by email. With mirror lookups enabled, known
+// subscribers are served from the local mirror; otherwise the provider is asked and the mirror
+// is refreshed with the answer. The mirror also answers when the provider cannot be reached.
+func CheckSubscriber(email string) (*struct {
+	Success    bool
+	Subscriber *models.Subscriber
+}, error) {
+	if conf().Mirror.Lookups {
+		if subscriber, ok := mirroredSubscriber(email); ok {
+			return &struct {
+				Success    bool
+				Subscriber *models.Subscriber
+			}{
+				Success:    true,
+				Subscriber: subscriber,
+			}, nil
+		}
+	}
+
+	result, err := checkSubscriber(email)
+	if err != nil {
+		subscriber, ok := mirroredSubscriber(email)
+		if !ok {
+			return nil, err
+		}
+		logger.LogFunction("warn", constants.Messages.Backend.Warn["MirrorFallback"], map[string]string{
+			"email": email,
+			"error": err.Error(),
+		})
+		return &struct {
+			Success    bool
+			Subscriber *models.Subscriber
+		}{
+			Success:    true,
+			Subscriber: subscriber,
+		}, nil
+	}
+
+	if result.Success && result.Subscriber != nil {
+		mirrorSubscriber(*result.Subscriber)
+	} else {
+		forgetSubscriber(email)
+	}
+	return result, nil
+}
+
+// checkSubscriber asks the provider whether a subscriber exists by email, through the
+// short-lived lookup cache
+func checkSubscriber(email string) (*struct {
+	Success    bool
+	Subscriber *models.Subscriber
+}, error) {
+	subscriber, err := lookupSubscriber(email)
+	if err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["CheckSubscriberError"], err.Error())
+		return nil, err
+	}
+
+	if subscriber == nil {
+		logger.LogFunction("info", constants.Messages.Backend.Info["SubscriberNotFound"], email)
+		return &struct {
+			Success    bool
+			Subscriber *models.Subscriber
+		}{
+			Success: false,
+		}, nil
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["SubscriberExists"], email)
+	return &struct {
+		Success    bool
+		Subscriber *models.Subscriber
+	}{
+		Success:    true,
+		Subscriber: subscriber,
+	}, nil
+}
+
+// SubscribeUser creates a new subscriber with its campaign attribution
+func SubscribeUser(email string, attribution models.Attribution) (*struct {
+	Success    bool
+	Subscriber *models.Subscriber
+}, error) {
+	logger.LogFunction("info", constants.Messages.Backend.Info["SubscriptionProcessing"], map[string]interface{}{
+		"email":       email,
+		"attribution": attribution,
+		"provider":    newsletter().Name(),
+	})
+
+	subscriber, err := newsletter().CreateSubscriber(email, attribution)
+	if err != nil {
+		return nil, err
+	}
+
+	if subscriber == nil || subscriber.ID == "" {
+		logger.LogFunction("error", constants.Messages.Backend.Error["CreateSubscriberError"], email)
+		return &struct {
+			Success    bool
+			Subscriber *models.Subscriber
+		}{
+			Success: false,
+		}, nil
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["NewSubscriber"], email)
+	mirrorSubscriber(*subscriber)
+	primeLookup(*subscriber)
+	return &struct {
+		Success    bool
+		Subscriber *models.Subscriber
+	}{
+		Success:    true,
+		Subscriber: subscriber,
+	}, nil
+}
+
+// AddTagToSubscriber adds a tag to an existing subscriber and records it in the audit log
+func AddTagToSubscriber(actor models.Actor, subscriptionID, tag string) bool {
+	before := tagAuditBefore(subscriptionID, tag)
+	err := addTagToSubscriber(subscriptionID, tag)
+	if err == nil {
+		mirrorTag(subscriptionID, tag, true)
+	}
+	forgetLookupByID(subscriptionID)
+	RecordAudit(actor, models.AuditActionAddTag, subscriptionID, before, map[string]string{"tag": tag}, err == nil, err)
+	return err == nil
+}
+
+// tagAuditBefore describes whether the mirror knew the subscriber to have a tag before
+// adding it, or returns nil when the subscriber is not mirrored
+func tagAuditBefore(subscriptionID, tag string) interface{} {
+	record, ok := mirroredByID(subscriptionID)
+	if !ok || record.Status == models.MirrorStatusDeleted {
+		return nil
+	}
+	return map[string]bool{"tagged": hasTags(normalizedTags(record.Tags), []string{strings.ToLower(tag)})}
+}
+
+// addTagToSubscriber adds a tag to an existing subscriber, returning the provider error
+func addTagToSubscriber(subscriptionID, tag string) error {
+	if tag == "" {
+		logger.LogFunction("warn", constants.Messages.Backend.Warn["EmptyTag"], subscriptionID)
+		return errors.New("empty tag")
+	}
+
+	if err := newsletter().AddTag(subscriptionID, tag); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["AddTagError"], map[string]string{
+			"subscriptionId": subscriptionID,
+			"tag":            tag,
+			"error":          err.Error(),
+		})
+		return err
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["TagAdded"], map[string]string{
+		"subscriptionId": subscriptionID,
+		"tag":            tag,
+	})
+	return nil
+}
+
+// AddTagsToSubscriber adds several tags to an existing subscriber, in a single request when the
+// provider supports it and with bounded concurrency otherwise, and records each tag in the
+// audit log. Empty and repeated tags are skipped. It returns the tags that were not added and
+// the provider errors that stopped them, so callers can tell an unreachable provider apart.
+func AddTagsToSubscriber(actor models.Actor, subscriptionID string, tags []string) ([]string, error) {
+	unique := []string{}
+	for _, tag := range tags {
+		if tag != "" && !hasTags(unique, []string{tag}) {
+			unique = append(unique, tag)
+		}
+	}
+
+	befores := make([]interface{}, len(unique))
+	for i, tag := range unique {
+		befores[i] = tagAuditBefore(subscriptionID, tag)
+	}
+
+	errs := addTagsToSubscriber(subscriptionID, unique)
+	forgetLookupByID(subscriptionID)
+	failed := []string{}
+	for i, tag := range unique {
+		if errs[i] == nil {
+			mirrorTag(subscriptionID, tag, true)
+		} else {
+			failed = append(failed, tag)
+		}
+		RecordAudit(actor, models.AuditActionAddTag, subscriptionID, befores[i], map[string]string{"tag": tag}, errs[i] == nil, errs[i])
+	}
+	return failed, errors.Join(errs...)
+}
+
+// addTagsToSubscriber adds several tags to an existing subscriber and returns the error of
+// each tag, nil for those that were added
+func addTagsToSubscriber(subscriptionID string, tags []string) []error {
+	errs := make([]error, len(tags))
+	if len(tags) == 0 {
+		return errs
+	}
+
+	if batcher, ok := newsletter().(TagBatcher); ok && len(tags) > 1 {
+		if err := batcher.AddTags(subscriptionID, tags); err != nil {
+			logger.LogFunction("error", constants.Messages.Backend.Error["AddTagError"], map[string]string{
+				"subscriptionId": subscriptionID,
+				"tags":           strings.Join(tags, ","),
+				"error":          err.Error(),
+			})
+			for i := range errs {
+				errs[i] = err
+			}
+			return errs
+		}
+		logger.LogFunction("info", constants.Messages.Backend.Info["TagAdded"], map[string]string{
+			"subscriptionId": subscriptionID,
+			"tags":           strings.Join(tags, ","),
+		})
+		return errs
+	}
+
+	slots := make(chan struct{}, tagConcurrency)
+	var wg sync.WaitGroup
+	for i, tag := range tags {
+		wg.Add(1)
+		go func(i int, tag string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			errs[i] = addTagToSubscriber(subscriptionID, tag)
+		}(i, tag)
+	}
+	wg.Wait()
+	return errs
+}
+
+// RemoveTagFromSubscriber removes a tag from an existing subscriber and records it in the audit log
+func RemoveTagFromSubscriber(actor models.Actor, subscriptionID, tag string) bool {
+	err := removeTagFromSubscriber(subscriptionID, tag)
+	if err == nil {
+		mirrorTag(subscriptionID, tag, false)
+	}
+	forgetLookupByID(subscriptionID)
+	RecordAudit(actor, models.AuditActionRemoveTag, subscriptionID, map[string]string{"tag": tag}, nil, err == nil, err)
+	return err == nil
+}
+
+// removeTagFromSubscriber removes a tag from an existing subscriber, returning the provider error
+func removeTagFromSubscriber(subscriptionID, tag string) error {
+	if tag == "" {
+		logger.LogFunction("warn", constants.Messages.Backend.Warn["EmptyTag"], subscriptionID)
+		return errors.New("empty tag")
+	}
+
+	if err := newsletter().RemoveTag(subscriptionID, tag); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["RemoveTagError"], map[string]string{
+			"subscriptionId": subscriptionID,
+			"tag":            tag,
+			"error":          err.Error(),
+		})
+		return err
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["TagRemoved"], map[string]string{
+		"subscriptionId": subscriptionID,
+		"tag":            tag,
+	})
+	return nil
+}
+
+// UnsubscribeUser unsubscribes a user from the newsletter and records it in the audit log.
+// Changes to the same email run one at a time.
+func UnsubscribeUser(actor models.Actor, email string) (*models.SubscriptionResult, error) {
+	return unsubscribe(actor, email, true)
+}
+
+// unsubscribeForErasure unsubscribes an email whose data is being erased. The team is not
+// notified: the notification job would carry the address the erasure is removing.
+func unsubscribeForErasure(actor models.Actor, email string) (*models.SubscriptionResult, error) {
+	return unsubscribe(actor, email, false)
+}
+
+// unsubscribe takes the lock of the email, unsubscribes it and cancels its queued subscriptions
+func unsubscribe(actor models.Actor, email string, notify bool) (*models.SubscriptionResult, error) {
+	unlock := lockEmail(email)
+	defer unlock()
+
+	result, err := recordedUnsubscribe(actor, email, notify)
+	if _, cancelErr := cancelQueuedSubscriptions(email); cancelErr != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["OutboxError"], cancelErr.Error())
+	}
+	return result, err
+}
+
+// recordedUnsubscribe unsubscribes a user, cancels their pending follow-up emails, records it in
+// the audit log and, when notify is set, notifies it. The caller holds the lock of the email.
+func recordedUnsubscribe(actor models.Actor, email string, notify bool) (*models.SubscriptionResult, error) {
+	result, err := unsubscribeUser(email)
+	forgetLookup(email)
+
+	var before interface{}
+	success := false
+	if result != nil {
+		success = result.Success
+		if result.SubscriberID != "" {
+			before = map[string]string{"subscriberId": result.SubscriberID}
+		}
+	}
+	if success {
+		forgetSubscriber(email)
+		StopDrips(email, "")
+		if notify {
+			Notify(models.NotificationSubscriberUnsubscribed, email, before)
+		}
+	}
+	RecordAudit(actor, models.AuditActionUnsubscribe, email, before, nil, success, err)
+	return result, err
+}
+
+// unsubscribeUser unsubscribes a user from the newsletter
+func unsubscribeUser(email string) (*models.SubscriptionResult, error) {
+	subscriberCheck, err := CheckSubscriber(email)
+	if err != nil {
+		return nil, err
+	}
+
+	if !subscriberCheck.Success || subscriberCheck.Subscriber == nil {
+		logger.LogFunction("warn", constants.Messages.Backend.Info["SubscriberNotFound"], map[string]string{
+			"action": "unsubscribe",
+			"email":  email,
+		})
+		return &models.SubscriptionResult{
+			Success: false,
+			Message: constants.Messages.Frontend.Errors["EmailNotSubscribed"],
+		}, nil
+	}
+
+	subscriptionID := subscriberCheck.Subscriber.ID
+	if err := newsletter().DeleteSubscriber(*subscriberCheck.Subscriber); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["UnsubscribeError"], err.Error())
+		return &models.SubscriptionResult{
+			Success:      false,
+			Message:      constants.Messages.Frontend.Errors["ServerError"],
+			SubscriberID: subscriptionID,
+		}, errors.New("error unsubscribing user")
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["UserUnsubscribed"], map[string]string{
+		"email": email,
+		"id":    subscriptionID,
+	})
+	return &models.SubscriptionResult{
+		Success:      true,
+		Message:      constants.Messages.Frontend.Success["Unsubscription"],
+		SubscriberID: subscriptionID,
+	}, nil
+}
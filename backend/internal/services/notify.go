@@ -0,0 +1,219 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/internal/store"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+const (
+	// NotificationSignatureHeader carries the hex HMAC-SHA256 of "<timestamp>.<body>"
+	NotificationSignatureHeader = "X-Notification-Signature"
+	// NotificationTimestampHeader carries the Unix time at which the notification was signed
+	NotificationTimestampHeader = "X-Notification-Timestamp"
+	// NotificationEventHeader carries the event type, to route notifications without parsing them
+	NotificationEventHeader = "X-Notification-Event"
+
+	// notificationTimeout bounds each delivery attempt
+	notificationTimeout = 10 * time.Second
+)
+
+// ErrDeadLetterNotFound is returned when a dead letter ID does not exist
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// deadLetters keeps the notifications that ran out of attempts, keyed by the ID of their job
+var deadLetters = store.NewCollection("dead-letters.json")
+
+// notificationClient delivers the outbound notifications
+var notificationClient = &http.Client{Timeout: notificationTimeout}
+
+// notifies reports whether an event is sent to the configured URLs
+func notifies(event models.NotificationEvent) bool {
+	if len(conf().Notify.URLs) == 0 {
+		return false
+	}
+	if len(conf().Notify.Events) == 0 {
+		return true
+	}
+	for _, enabled := range conf().Notify.Events {
+		if strings.EqualFold(enabled, string(event)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Notify schedules the delivery of an event to every configured URL. Each delivery is a job,
+// so it is retried with backoff and survives restarts. Scheduling failures are logged and
+// never fail the operation that triggered the event.
+func Notify(event models.NotificationEvent, email string, data interface{}) {
+	if !notifies(event) {
+		return
+	}
+
+	notification := models.Notification{
+		ID:    generateUniqueID(),
+		Event: event,
+		Time:  time.Now().UTC(),
+		Email: email,
+		Data:  data,
+	}
+	for _, url := range conf().Notify.URLs {
+		payload := models.NotificationJobPayload{URL: url, Notification: notification}
+		if _, err := EnqueueJob(models.JobTypeNotification, email, payload, notification.Time); err != nil {
+			logger.LogFunction("error", constants.Messages.Backend.Error["NotifyError"], map[string]string{
+				"event": string(event),
+				"url":   url,
+				"error": err.Error(),
+			})
+		}
+	}
+}
+
+// signNotification returns the signature of a notification body sent at timestamp
+func signNotification(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(conf().Notify.Secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliverNotification POSTs a signed notification to its URL. Any status other than 2xx is an error.
+func deliverNotification(payload models.NotificationJobPayload) error {
+	body, err := json.Marshal(payload.Notification)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", payload.URL, bytes.NewReader(body))
+	if err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["RequestCreationError"], err.Error())
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(NotificationEventHeader, string(payload.Notification.Event))
+	req.Header.Set(NotificationTimestampHeader, timestamp)
+	req.Header.Set(NotificationSignatureHeader, "sha256="+signNotification(timestamp, body))
+
+	resp, err := notificationClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("notification endpoint answered with status %d", resp.StatusCode)
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["NotificationSent"], map[string]string{
+		"id":    payload.Notification.ID,
+		"event": string(payload.Notification.Event),
+		"url":   payload.URL,
+	})
+	return nil
+}
+
+// deadLetterNotification moves a notification job that ran out of attempts to the dead letters
+func deadLetterNotification(job models.Job) {
+	var payload models.NotificationJobPayload
+	err := json.Unmarshal(job.Payload, &payload)
+	if err == nil {
+		err = deadLetters.Put(job.ID, models.DeadLetter{
+			ID:           job.ID,
+			URL:          payload.URL,
+			Notification: payload.Notification,
+			Attempts:     job.Attempts,
+			LastError:    job.LastError,
+			FailedAt:     job.UpdatedAt,
+		})
+	}
+	if err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["NotifyError"], err.Error())
+		return
+	}
+
+	logger.LogFunction("error", constants.Messages.Backend.Error["DeadLetter"], map[string]string{
+		"id":    job.ID,
+		"event": string(payload.Notification.Event),
+		"url":   payload.URL,
+		"error": job.LastError,
+	})
+}
+
+// ListDeadLetters returns the notifications that could not be delivered, the most recent first
+func ListDeadLetters() ([]models.DeadLetter, error) {
+	letters := []models.DeadLetter{}
+	err := deadLetters.ForEach(func(_ string, raw json.RawMessage) error {
+		var letter models.DeadLetter
+		if err := json.Unmarshal(raw, &letter); err != nil {
+			return err
+		}
+		letters = append(letters, letter)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].FailedAt.After(letters[j].FailedAt)
+	})
+	return letters, nil
+}
+
+// RedeliverDeadLetter schedules a dead letter for delivery again, with a fresh set of
+// attempts, and removes it from the dead letters
+func RedeliverDeadLetter(id string) (*models.Job, error) {
+	var letter models.DeadLetter
+	found, err := deadLetters.Get(id, &letter)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrDeadLetterNotFound
+	}
+
+	payload := models.NotificationJobPayload{URL: letter.URL, Notification: letter.Notification}
+	job, err := EnqueueJob(models.JobTypeNotification, letter.Notification.Email, payload, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return job, deadLetters.Delete(id)
+}
+
+// purgeDeadLetters removes the dead letters about an email and reports how many were removed
+func purgeDeadLetters(email string) (int, error) {
+	removed := 0
+	err := deadLetters.Update(func(docs map[string]json.RawMessage) error {
+		for id, raw := range docs {
+			var letter models.DeadLetter
+			if err := json.Unmarshal(raw, &letter); err != nil {
+				return err
+			}
+			if sameEmail(letter.Notification.Email, email) {
+				delete(docs, id)
+				removed++
+			}
+		}
+		return nil
+	})
+	return removed, err
+}
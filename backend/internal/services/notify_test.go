@@ -0,0 +1,125 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+)
+
+const testNotifySecret = "0123456789abcdef0123456789abcdef"
+
+// notificationEndpoint starts a receiver that checks the signature of every notification and
+// answers with the status returned by status for the nth request, counting from 1
+func notificationEndpoint(t *testing.T, status func(n int32) int) *int32 {
+	t.Helper()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		body, _ := io.ReadAll(r.Body)
+
+		mac := hmac.New(sha256.New, []byte(testNotifySecret))
+		mac.Write([]byte(r.Header.Get(NotificationTimestampHeader) + "."))
+		mac.Write(body)
+		want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		if got := r.Header.Get(NotificationSignatureHeader); !hmac.Equal([]byte(got), []byte(want)) {
+			t.Errorf("request %d: signature %q, want %q", n, got, want)
+		}
+		if got := r.Header.Get(NotificationEventHeader); got != string(models.NotificationSubscriberCreated) {
+			t.Errorf("request %d: event header %q", n, got)
+		}
+		w.WriteHeader(status(n))
+	}))
+	t.Cleanup(server.Close)
+
+	useTestConfig(t)
+	conf().Notify.URLs = []string{server.URL}
+	conf().Notify.Secret = testNotifySecret
+	conf().Notify.Events = nil
+	return &requests
+}
+
+// notificationJob returns the only notification job in the queue
+func notificationJob(t *testing.T) models.Job {
+	t.Helper()
+	all, err := ListJobs("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].Type != models.JobTypeNotification {
+		t.Fatalf("jobs = %+v, want a single notification", all)
+	}
+	return all[0]
+}
+
+// runNotificationNow brings the retry of the notification job forward and runs the due jobs
+func runNotificationNow(t *testing.T) {
+	t.Helper()
+	job := notificationJob(t)
+	job.RunAt = time.Now().UTC().Add(-time.Second)
+	if err := jobs.Put(job.ID, job); err != nil {
+		t.Fatal(err)
+	}
+	RunDueJobs()
+}
+
+func TestNotificationIsRetriedAfterServerError(t *testing.T) {
+	requests := notificationEndpoint(t, func(n int32) int {
+		if n == 1 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusNoContent
+	})
+
+	Notify(models.NotificationSubscriberCreated, "ana@example.com", map[string]string{"subscriberId": "sub_ana"})
+	RunDueJobs()
+
+	job := notificationJob(t)
+	if job.Status != models.JobStatusPending || job.Attempts != 1 || !job.RunAt.After(time.Now()) {
+		t.Fatalf("after a 503 the job is %s with %d attempts, due %s; want a later retry", job.Status, job.Attempts, job.RunAt)
+	}
+
+	runNotificationNow(t)
+	if job := notificationJob(t); job.Status != models.JobStatusDone {
+		t.Errorf("after the retry the job is %s (%s)", job.Status, job.LastError)
+	}
+	if got := atomic.LoadInt32(requests); got != 2 {
+		t.Errorf("endpoint received %d requests, want 2", got)
+	}
+	if letters, _ := ListDeadLetters(); len(letters) != 0 {
+		t.Errorf("dead letters = %+v, want none", letters)
+	}
+}
+
+func TestNotificationIsDeadLetteredAfterLastAttempt(t *testing.T) {
+	requests := notificationEndpoint(t, func(int32) int { return http.StatusInternalServerError })
+
+	Notify(models.NotificationSubscriberCreated, "ana@example.com", nil)
+	RunDueJobs()
+	for i := 1; i < defaultJobAttempts; i++ {
+		runNotificationNow(t)
+	}
+
+	job := notificationJob(t)
+	if job.Status != models.JobStatusFailed || job.Attempts != defaultJobAttempts {
+		t.Fatalf("job is %s after %d attempts, want failed after %d", job.Status, job.Attempts, defaultJobAttempts)
+	}
+	if got := atomic.LoadInt32(requests); got != int32(defaultJobAttempts) {
+		t.Errorf("endpoint received %d requests, want %d", got, defaultJobAttempts)
+	}
+
+	letters, err := ListDeadLetters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 || letters[0].ID != job.ID || letters[0].Attempts != defaultJobAttempts || letters[0].URL != conf().Notify.URLs[0] {
+		t.Fatalf("dead letters = %+v, want the failed notification", letters)
+	}
+}
@@ -0,0 +1,503 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/internal/store"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+var (
+	// ErrOutboxEntryNotFound is returned when an outbox entry ID does not exist
+	ErrOutboxEntryNotFound = errors.New("outbox entry not found")
+
+	// errSubscriptionRefused marks a subscribe step that retrying cannot fix
+	errSubscriptionRefused = errors.New("the newsletter provider refused the email")
+)
+
+// outbox keeps every subscription request recorded before running it, with the status of its steps
+var outbox = store.NewCollection("outbox.json")
+
+// outboxMu keeps replays from running twice at once
+var outboxMu sync.Mutex
+
+// newOutboxEntry builds a pending request with the steps it needs: the subscription and its
+// tags, plus the follow-up sequence, the resource email and the notification of a lead magnet
+func newOutboxEntry(actor models.Actor, email string, attribution models.Attribution, tags []string, resource *models.ResourceEmailJobPayload) models.OutboxEntry {
+	names := []models.OutboxStepName{models.OutboxStepSubscribe, models.OutboxStepTags}
+	if resource != nil {
+		names = append(names, models.OutboxStepDrip, models.OutboxStepResourceEmail, models.OutboxStepNotify)
+	}
+
+	steps := make([]models.OutboxStep, 0, len(names))
+	for _, name := range names {
+		steps = append(steps, models.OutboxStep{Name: name, Status: models.OutboxStepPending})
+	}
+
+	now := time.Now().UTC()
+	return models.OutboxEntry{
+		ID:          generateUniqueID(),
+		Actor:       actor,
+		Email:       email,
+		Attribution: attribution,
+		Tags:        tags,
+		Resource:    resource,
+		Status:      models.OutboxPending,
+		Steps:       steps,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
+
+// QueueSubscription records a subscription the newsletter provider could not take, to replay it
+// once the provider answers again. resource is the resource asked for in a lead magnet, if any.
+func QueueSubscription(actor models.Actor, email string, attribution models.Attribution, tags []string, resource *models.ResourceEmailJobPayload) (*models.OutboxEntry, error) {
+	entry := newOutboxEntry(actor, email, attribution, tags, resource)
+	if err := outbox.Put(entry.ID, entry); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["OutboxError"], err.Error())
+		return nil, err
+	}
+
+	logger.LogFunction("warn", constants.Messages.Backend.Warn["SubscriptionQueued"], map[string]string{
+		"id":    entry.ID,
+		"email": email,
+	})
+	return &entry, nil
+}
+
+// SubmitSubscription records a subscription request and runs its steps right away. The returned
+// entry is done, failed with its completed steps undone, or still pending when a step has to be
+// retried in the background, the newsletter provider being unreachable for instance.
+func SubmitSubscription(actor models.Actor, email string, attribution models.Attribution, tags []string, resource *models.ResourceEmailJobPayload) (*models.OutboxEntry, error) {
+	entry := newOutboxEntry(actor, email, attribution, tags, resource)
+	if err := outbox.Put(entry.ID, entry); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["OutboxError"], err.Error())
+		return nil, err
+	}
+
+	dispatched, _, err := dispatchOutbox(entry)
+	return dispatched, err
+}
+
+// GetOutboxEntry returns an outbox entry with the status of its steps
+func GetOutboxEntry(id string) (*models.OutboxEntry, error) {
+	var entry models.OutboxEntry
+	found, err := outbox.Get(id, &entry)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrOutboxEntryNotFound
+	}
+	return &entry, nil
+}
+
+// ListOutbox returns the outbox entries with the given status, or all of them when status is
+// empty, oldest first
+func ListOutbox(status models.OutboxStatus) ([]models.OutboxEntry, error) {
+	entries := []models.OutboxEntry{}
+	err := outbox.ForEach(func(_ string, raw json.RawMessage) error {
+		var entry models.OutboxEntry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return err
+		}
+		if status == "" || entry.Status == status {
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+	return entries, nil
+}
+
+// ReplayOutbox runs the pending entries whose retry time has come, in the order they were
+// recorded, stopping as soon as the newsletter provider is unreachable again. Finished entries
+// are forgotten once the job retention period is over. It returns how many entries it completed.
+func ReplayOutbox() (int, error) {
+	if !outboxMu.TryLock() {
+		return 0, nil
+	}
+	defer outboxMu.Unlock()
+
+	entries, err := ListOutbox("")
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	completed := 0
+	for _, entry := range entries {
+		if entry.Status != models.OutboxPending {
+			if now.Sub(entry.UpdatedAt) > jobRetentionPeriod {
+				if err := outbox.Delete(entry.ID); err != nil {
+					return completed, err
+				}
+			}
+			continue
+		}
+		if entry.NextAttemptAt != nil && entry.NextAttemptAt.After(now) {
+			continue
+		}
+
+		dispatched, unavailable, err := dispatchOutbox(entry)
+		switch {
+		case errors.Is(err, ErrOutboxEntryNotFound):
+			continue
+		case err != nil:
+			return completed, err
+		case unavailable:
+			return completed, nil
+		case dispatched.Status == models.OutboxDone:
+			completed++
+		}
+	}
+	return completed, nil
+}
+
+// dispatchOutbox runs the pending steps of an entry in order under the lock of its email,
+// saving the entry after each of them. A step that fails is retried later with exponential
+// backoff; once it runs out of attempts, or retrying cannot help, the completed steps are
+// compensated and the entry fails. Failures to reach the provider do not use up attempts: the
+// circuit breaker paces them, and unavailable reports them so that replays can stop.
+func dispatchOutbox(entry models.OutboxEntry) (*models.OutboxEntry, bool, error) {
+	unlock := lockEmail(entry.Email)
+	defer unlock()
+
+	// Another dispatch may have moved the entry on while this one waited for the lock
+	found, err := outbox.Get(entry.ID, &entry)
+	if err != nil {
+		return nil, false, err
+	}
+	if !found {
+		return nil, false, ErrOutboxEntryNotFound
+	}
+	if entry.Status != models.OutboxPending {
+		return &entry, false, nil
+	}
+
+	for i := range entry.Steps {
+		step := &entry.Steps[i]
+		if step.Status != models.OutboxStepPending {
+			continue
+		}
+
+		skipped, stepErr := runOutboxStep(&entry, step.Name)
+		now := time.Now().UTC()
+		step.UpdatedAt = &now
+		entry.UpdatedAt = now
+
+		switch {
+		case stepErr == nil:
+			step.Status = models.OutboxStepDone
+			if skipped {
+				step.Status = models.OutboxStepSkipped
+			}
+			step.LastError = ""
+
+		case IsProviderUnavailable(stepErr):
+			step.LastError = stepErr.Error()
+			return &entry, true, saveOutboxEntry(entry)
+
+		default:
+			step.Attempts++
+			step.LastError = stepErr.Error()
+			if errors.Is(stepErr, errSubscriptionRefused) || step.Attempts >= defaultJobAttempts {
+				step.Status = models.OutboxStepFailed
+				compensateOutbox(&entry, i)
+				entry.Status = models.OutboxFailed
+				entry.NextAttemptAt = nil
+			} else {
+				next := now.Add(time.Duration(1<<step.Attempts) * time.Minute)
+				entry.NextAttemptAt = &next
+				logger.LogFunction("warn", constants.Messages.Backend.Warn["OutboxStepRetry"], map[string]string{
+					"id":    entry.ID,
+					"step":  string(step.Name),
+					"error": step.LastError,
+				})
+			}
+			if step.Name == models.OutboxStepSubscribe && step.Status == models.OutboxStepFailed {
+				RecordAudit(entry.Actor, models.AuditActionSubscribe, entry.Email, nil, nil, false, stepErr)
+			}
+			return &entry, false, saveOutboxEntry(entry)
+		}
+
+		if err := saveOutboxEntry(entry); err != nil {
+			return nil, false, err
+		}
+	}
+
+	entry.Status = models.OutboxDone
+	entry.NextAttemptAt = nil
+	if err := saveOutboxEntry(entry); err != nil {
+		return nil, false, err
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["OutboxDispatched"], map[string]string{
+		"id":    entry.ID,
+		"email": entry.Email,
+	})
+	return &entry, false, nil
+}
+
+// runOutboxStep runs one step of an entry, reporting whether there was nothing to do
+func runOutboxStep(entry *models.OutboxEntry, name models.OutboxStepName) (bool, error) {
+	switch name {
+	case models.OutboxStepSubscribe:
+		return false, outboxSubscribe(entry)
+
+	case models.OutboxStepTags:
+		tags := entry.Tags
+		if entry.Created {
+			tags = append([]string{string(models.SubscriptionTagNewSubscriber)}, tags...)
+		}
+		if len(tags) == 0 {
+			return true, nil
+		}
+		failed, err := AddTagsToSubscriber(entry.Actor, entry.SubscriberID, tags)
+		if len(failed) == 0 {
+			return false, nil
+		}
+		// An unreachable provider holds the entry until it answers again. Tags it refused do
+		// not undo the subscription: they are retried in the background, as for signups.
+		if IsProviderUnavailable(err) {
+			return false, fmt.Errorf("adding tags %s failed: %w", strings.Join(failed, ", "), err)
+		}
+		return false, retryTagsLater(entry.Email, entry.SubscriberID, failed)
+
+	case models.OutboxStepDrip:
+		enrollment, err := StartDrip(entry.Email, *entry.Resource)
+		if err != nil {
+			return false, err
+		}
+		entry.DripEnrollment = enrollment
+		return enrollment == "", nil
+
+	case models.OutboxStepResourceEmail:
+		// As the lead magnet always did, only existing subscribers are sent the resource here
+		if entry.Created {
+			return true, nil
+		}
+		return false, ScheduleResourceEmail(models.ResourceEmailScheduleOptions{
+			Email:        entry.Email,
+			ResourceID:   entry.Resource.ResourceID,
+			FileID:       entry.Resource.FileID,
+			DelayMinutes: 1,
+		})
+
+	case models.OutboxStepNotify:
+		Notify(models.NotificationResourceRequested, entry.Email, map[string]interface{}{
+			"resourceId":    entry.Resource.ResourceID,
+			"fileId":        entry.Resource.FileID,
+			"newSubscriber": entry.Created,
+		})
+		return false, nil
+
+	default:
+		return false, fmt.Errorf("unknown outbox step %q", name)
+	}
+}
+
+// outboxSubscribe finds or creates the subscriber of an entry, remembering what compensating
+// it would need: whether the subscriber is new and which tags it did not have yet
+func outboxSubscribe(entry *models.OutboxEntry) error {
+	check, err := CheckSubscriber(entry.Email)
+	if err != nil {
+		return err
+	}
+
+	if check.Success && check.Subscriber != nil {
+		entry.SubscriberID = check.Subscriber.ID
+		current := map[string]bool{}
+		for _, tag := range check.Subscriber.Tags {
+			current[strings.ToLower(tag)] = true
+		}
+		entry.AddedTags = nil
+		for _, tag := range entry.Tags {
+			if !current[strings.ToLower(tag)] {
+				entry.AddedTags = append(entry.AddedTags, tag)
+			}
+		}
+		RecordAttribution(entry.Email, entry.SubscriberID, false, entry.Attribution)
+	} else {
+		created, err := SubscribeUser(entry.Email, entry.Attribution)
+		if err != nil {
+			return err
+		}
+		if !created.Success || created.Subscriber == nil {
+			return errSubscriptionRefused
+		}
+		entry.SubscriberID = created.Subscriber.ID
+		entry.Created = true
+		RecordAttribution(entry.Email, entry.SubscriberID, true, entry.Attribution)
+		Notify(models.NotificationSubscriberCreated, entry.Email, map[string]interface{}{
+			"subscriberId": entry.SubscriberID,
+			"tags":         entry.Tags,
+			"attribution":  entry.Attribution,
+		})
+	}
+
+	RecordAudit(entry.Actor, models.AuditActionSubscribe, entry.Email,
+		map[string]bool{"subscribed": !entry.Created},
+		map[string]interface{}{"subscriberId": entry.SubscriberID, "tags": entry.Tags, "request": entry.ID},
+		true, nil)
+	return nil
+}
+
+// compensateOutbox undoes the completed steps before the failed one, newest first: the follow-up
+// sequence is cancelled, a subscriber the entry created is unsubscribed, and the tags it added to
+// an existing one are removed. The resource email and the notification need nothing, as no step
+// can fail after them. Compensation is best effort: a step that cannot be undone stays done, with
+// the error.
+func compensateOutbox(entry *models.OutboxEntry, failed int) {
+	for i := failed - 1; i >= 0; i-- {
+		step := &entry.Steps[i]
+		if step.Status != models.OutboxStepDone {
+			continue
+		}
+
+		var err error
+		switch step.Name {
+		case models.OutboxStepSubscribe:
+			if entry.Created {
+				var result *models.SubscriptionResult
+				result, err = recordedUnsubscribe(entry.Actor, entry.Email, true)
+				if err == nil && !result.Success {
+					err = errors.New(result.Message)
+				}
+			}
+		case models.OutboxStepDrip:
+			_, err = StopDrips(entry.Email, entry.Resource.ResourceID)
+		case models.OutboxStepTags:
+			if !entry.Created {
+				for _, tag := range entry.AddedTags {
+					if !RemoveTagFromSubscriber(entry.Actor, entry.SubscriberID, tag) {
+						err = fmt.Errorf("removing tag %q failed", tag)
+					}
+				}
+			}
+		}
+
+		now := time.Now().UTC()
+		step.UpdatedAt = &now
+		if err != nil {
+			step.LastError = "compensation failed: " + err.Error()
+			continue
+		}
+		step.Status = models.OutboxStepCompensated
+	}
+
+	logger.LogFunction("warn", constants.Messages.Backend.Warn["OutboxCompensated"], map[string]interface{}{
+		"id":    entry.ID,
+		"email": entry.Email,
+		"steps": entry.Steps,
+	})
+}
+
+// saveOutboxEntry stores the progress of an entry, unless it was cancelled or erased meanwhile
+func saveOutboxEntry(entry models.OutboxEntry) error {
+	err := outbox.Update(func(docs map[string]json.RawMessage) error {
+		if _, ok := docs[entry.ID]; !ok {
+			return nil
+		}
+		updated, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		docs[entry.ID] = updated
+		return nil
+	})
+	if err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["OutboxError"], err.Error())
+	}
+	return err
+}
+
+// cancelQueuedSubscriptions drops the pending requests of an email, so that an unsubscribe is
+// not undone by a later replay
+func cancelQueuedSubscriptions(email string) (int, error) {
+	return removeOutboxEntries(email, true)
+}
+
+// purgeOutbox removes every outbox entry of an email
+func purgeOutbox(email string) (int, error) {
+	return removeOutboxEntries(email, false)
+}
+
+// removeOutboxEntries removes the entries of an email, optionally only the pending ones
+func removeOutboxEntries(email string, pendingOnly bool) (int, error) {
+	removed := 0
+	err := outbox.Update(func(docs map[string]json.RawMessage) error {
+		for id, raw := range docs {
+			var entry models.OutboxEntry
+			if err := json.Unmarshal(raw, &entry); err != nil {
+				return err
+			}
+			if !sameEmail(entry.Email, email) || (pendingOnly && entry.Status != models.OutboxPending) {
+				continue
+			}
+			delete(docs, id)
+			removed++
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// GetProviderMetrics reports the circuits of the provider APIs and counts the outbox entries
+// by status
+func GetProviderMetrics() (*models.ProviderMetrics, error) {
+	metrics := &models.ProviderMetrics{
+		Provider: primaryProvider().Name(),
+		Circuits: CircuitStatuses(),
+		Outbox: map[models.OutboxStatus]int{
+			models.OutboxPending: 0,
+			models.OutboxDone:    0,
+			models.OutboxFailed:  0,
+		},
+	}
+
+	entries, err := ListOutbox("")
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		metrics.Outbox[entry.Status]++
+	}
+	return metrics, nil
+}
+
+// StartOutboxReplayer replays the pending outbox entries every interval until the context is
+// cancelled. While the circuit of the provider is open each replay stops at the first entry.
+func StartOutboxReplayer(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if _, err := ReplayOutbox(); err != nil {
+				logger.LogFunction("error", constants.Messages.Backend.Error["OutboxError"], err.Error())
+			}
+		}
+	}()
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+)
+
+// outboxTagsAPI fakes Beehiiv for a new subscriber whose tag request is answered by tags
+func outboxTagsAPI(t *testing.T, tags http.HandlerFunc) func() []providerCall {
+	lookup := beehiivPath("subscriptions/by_email/new@example.com")
+	return fakeProviderAPI(t, "beehiiv", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == lookup:
+			recordedResponse(t, w, http.StatusNotFound, "beehiiv/subscription_not_found.json")
+		case r.Method == http.MethodPost && r.URL.Path == beehiivPath("subscriptions"):
+			recordedResponse(t, w, http.StatusCreated, "beehiiv/subscription_tags.json")
+		case r.Method == http.MethodPost && r.URL.Path == beehiivPath("subscriptions/"+beehiivSubscriptionID+"/tags"):
+			tags(w, r)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+	})
+}
+
+// outboxStep returns the step of an entry with the given name
+func outboxStep(t *testing.T, entry *models.OutboxEntry, name models.OutboxStepName) models.OutboxStep {
+	t.Helper()
+	for _, step := range entry.Steps {
+		if step.Name == name {
+			return step
+		}
+	}
+	t.Fatalf("entry has no %s step", name)
+	return models.OutboxStep{}
+}
+
+func TestOutboxRetriesRefusedTagsWithoutUndoingTheSubscription(t *testing.T) {
+	outboxTagsAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		recordedResponse(t, w, http.StatusBadRequest, "beehiiv/invalid_tags.json")
+	})
+
+	entry, err := SubmitSubscription(models.FormActor("test"), "new@example.com", models.Attribution{}, []string{"homelab"}, nil)
+	if err != nil {
+		t.Fatalf("SubmitSubscription: %v", err)
+	}
+	if entry.Status != models.OutboxDone {
+		t.Fatalf("entry is %s, want done: %+v", entry.Status, entry.Steps)
+	}
+	if step := outboxStep(t, entry, models.OutboxStepSubscribe); step.Status != models.OutboxStepDone {
+		t.Errorf("subscribe step is %s, want it kept", step.Status)
+	}
+
+	pending, err := ListJobs(models.JobStatusPending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Type != models.JobTypeAddTags {
+		t.Fatalf("pending jobs = %+v, want the tags retry", pending)
+	}
+}
+
+func TestOutboxHoldsTagsWhileTheProviderIsUnreachable(t *testing.T) {
+	outboxTagsAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		// Drop the connection without an answer
+		panic(http.ErrAbortHandler)
+	})
+
+	entry, err := SubmitSubscription(models.FormActor("test"), "new@example.com", models.Attribution{}, []string{"homelab"}, nil)
+	if err != nil {
+		t.Fatalf("SubmitSubscription: %v", err)
+	}
+	if entry.Status != models.OutboxPending {
+		t.Fatalf("entry is %s, want pending: %+v", entry.Status, entry.Steps)
+	}
+	step := outboxStep(t, entry, models.OutboxStepTags)
+	if step.Status != models.OutboxStepPending || step.Attempts != 0 || step.LastError == "" {
+		t.Errorf("tags step = %+v, want pending without using an attempt", step)
+	}
+
+	if pending, _ := ListJobs(models.JobStatusPending); len(pending) != 0 {
+		t.Errorf("pending jobs = %+v, want none while the entry holds the tags", pending)
+	}
+}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/internal/store"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+// ErrNotSubscribed is returned when a preference change targets an email that is not subscribed
+var ErrNotSubscribed = errors.New("email is not subscribed")
+
+// pauses stores the active subscription pauses, keyed by email
+var pauses = store.NewCollection("pauses.json")
+
+// NewsletterTopics returns the topics a subscriber can choose in the preference center
+func NewsletterTopics() []string {
+	return conf().Newsletter.Topics
+}
+
+// findSubscriber returns the Beehiiv subscriber of an email or ErrNotSubscribed
+func findSubscriber(email string) (*models.Subscriber, error) {
+	subscriberCheck, err := CheckSubscriber(email)
+	if err != nil {
+		return nil, err
+	}
+	if !subscriberCheck.Success || subscriberCheck.Subscriber == nil {
+		return nil, ErrNotSubscribed
+	}
+	return subscriberCheck.Subscriber, nil
+}
+
+// buildPreferences describes the configured topics and pause state of a subscriber
+func buildPreferences(email string, tags []string) (*models.Preferences, error) {
+	current := map[string]bool{}
+	for _, tag := range tags {
+		current[strings.ToLower(tag)] = true
+	}
+
+	preferences := &models.Preferences{Email: email, Topics: []models.TopicPreference{}}
+	for _, topic := range conf().Newsletter.Topics {
+		preferences.Topics = append(preferences.Topics, models.TopicPreference{
+			Topic:      topic,
+			Subscribed: current[topic],
+		})
+	}
+
+	var pause models.SubscriptionPause
+	found, err := pauses.Get(canonicalEmail(email), &pause)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		preferences.PausedUntil = &pause.Until
+	}
+	return preferences, nil
+}
+
+// GetPreferences returns the topics a subscriber receives and whether their subscription is paused
+func GetPreferences(email string) (*models.Preferences, error) {
+	subscriber, err := findSubscriber(email)
+	if err != nil {
+		return nil, err
+	}
+	return buildPreferences(email, subscriber.Tags)
+}
+
+// UpdatePreferences sets the topic tags of a subscriber and pauses or resumes their subscription.
+// A nil topics list leaves the topics unchanged; pauseWeeks is ignored when resume is set.
+// Changes to the same email run one at a time.
+func UpdatePreferences(actor models.Actor, email string, topics []string, pauseWeeks int, resume bool) (*models.Preferences, error) {
+	unlock := lockEmail(email)
+	defer unlock()
+
+	subscriber, err := findSubscriber(email)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := map[string]bool{}
+	for _, tag := range subscriber.Tags {
+		tags[strings.ToLower(tag)] = true
+	}
+
+	if topics != nil {
+		wanted := map[string]bool{}
+		for _, topic := range topics {
+			wanted[topic] = true
+		}
+
+		for _, topic := range conf().Newsletter.Topics {
+			switch {
+			case wanted[topic] && !tags[topic]:
+				if !AddTagToSubscriber(actor, subscriber.ID, topic) {
+					return nil, fmt.Errorf("adding topic %q failed", topic)
+				}
+				tags[topic] = true
+			case !wanted[topic] && tags[topic]:
+				if !RemoveTagFromSubscriber(actor, subscriber.ID, topic) {
+					return nil, fmt.Errorf("removing topic %q failed", topic)
+				}
+				delete(tags, topic)
+			}
+		}
+	}
+
+	switch {
+	case resume:
+		if err := ResumeSubscription(actor, email); err != nil {
+			return nil, err
+		}
+	case pauseWeeks > 0:
+		if err := PauseSubscription(actor, email, subscriber.ID, pauseWeeks); err != nil {
+			return nil, err
+		}
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["PreferencesUpdated"], map[string]interface{}{
+		"email":      email,
+		"topics":     topics,
+		"pauseWeeks": pauseWeeks,
+		"resume":     resume,
+	})
+
+	current := make([]string, 0, len(tags))
+	for tag := range tags {
+		current = append(current, tag)
+	}
+	return buildPreferences(email, current)
+}
+
+// PauseSubscription tags a subscriber as paused for the given number of weeks and schedules
+// the job that lifts the pause. Pausing again replaces the previous pause.
+func PauseSubscription(actor models.Actor, email, subscriptionID string, weeks int) error {
+	until := time.Now().UTC().AddDate(0, 0, 7*weeks)
+	err := pauseSubscription(actor, email, subscriptionID, until)
+	RecordAudit(actor, models.AuditActionPause, email, nil, map[string]time.Time{"until": until}, err == nil, err)
+	return err
+}
+
+// pauseSubscription tags the subscriber as paused and schedules the resume job for until
+func pauseSubscription(actor models.Actor, email, subscriptionID string, until time.Time) error {
+	if !AddTagToSubscriber(actor, subscriptionID, string(models.SubscriptionTagPaused)) {
+		return fmt.Errorf("adding tag %q failed", models.SubscriptionTagPaused)
+	}
+
+	if _, err := CancelJobs(email, models.JobTypeResumeSubscription); err != nil {
+		return err
+	}
+
+	job, err := EnqueueJob(models.JobTypeResumeSubscription, email, nil, until)
+	if err != nil {
+		return err
+	}
+
+	err = pauses.Put(canonicalEmail(email), models.SubscriptionPause{
+		Email:     email,
+		Until:     until,
+		JobID:     job.ID,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["SubscriptionPaused"], map[string]string{
+		"email": email,
+		"until": until.Format(time.RFC3339),
+	})
+	return nil
+}
+
+// ResumeSubscription lifts the pause of a subscriber. Subscribers who left in the meantime
+// only have their pause record removed.
+func ResumeSubscription(actor models.Actor, email string) error {
+	var before interface{}
+	var pause models.SubscriptionPause
+	if found, _ := pauses.Get(canonicalEmail(email), &pause); found {
+		before = map[string]time.Time{"until": pause.Until}
+	}
+
+	err := resumeSubscription(actor, email)
+	RecordAudit(actor, models.AuditActionResume, email, before, nil, err == nil, err)
+	return err
+}
+
+// resumeSubscription removes the paused tag, the pending resume jobs and the pause record
+func resumeSubscription(actor models.Actor, email string) error {
+	subscriber, err := findSubscriber(email)
+	if err != nil && !errors.Is(err, ErrNotSubscribed) {
+		return err
+	}
+
+	if subscriber != nil && !RemoveTagFromSubscriber(actor, subscriber.ID, string(models.SubscriptionTagPaused)) {
+		return fmt.Errorf("removing tag %q failed", models.SubscriptionTagPaused)
+	}
+
+	if _, err := CancelJobs(email, models.JobTypeResumeSubscription); err != nil {
+		return err
+	}
+	if err := pauses.Delete(canonicalEmail(email)); err != nil {
+		return err
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["SubscriptionResumed"], email)
+	return nil
+}
+
+// SendPreferencesLink emails the preference center link to a subscriber. Unknown emails are
+// ignored without error, so the caller cannot use it to find out who is subscribed.
+func SendPreferencesLink(email string) error {
+	if _, err := findSubscriber(email); err != nil {
+		if errors.Is(err, ErrNotSubscribed) {
+			return nil
+		}
+		return err
+	}
+
+	link := PreferencesURL(email)
+	if link == "" {
+		return ErrSignedLinksDisabled
+	}
+
+	if err := SendPreferencesLinkEmail(email, link); err != nil {
+		return err
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["PreferencesLinkSent"], email)
+	return nil
+}
@@ -0,0 +1,321 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/internal/store"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+// erasureLog keeps a hashed tombstone of every data erasure
+var erasureLog = store.NewLog("erasures.jsonl")
+
+// HashEmail returns the HMAC-SHA256 of a normalized email keyed with the link signing secret,
+// used to reference people in records that must not contain their address. Without the key,
+// a list of candidate addresses cannot be matched against the hashes.
+func HashEmail(email string) string {
+	mac := hmac.New(sha256.New, []byte(conf().Security.LinkSecret))
+	mac.Write([]byte(canonicalEmail(email)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ExportData gathers everything Beehiiv and the local stores hold about an email
+func ExportData(email string) (*models.DataExport, error) {
+	export := &models.DataExport{
+		Email:        email,
+		GeneratedAt:  time.Now().UTC(),
+		Attributions: []models.AttributionRecord{},
+		Bookings:     []models.Booking{},
+		Jobs:         []models.Job{},
+	}
+
+	subscriber, err := findSubscriber(email)
+	if err != nil && !errors.Is(err, ErrNotSubscribed) {
+		return nil, err
+	}
+	export.Subscriber = subscriber
+
+	if export.Consents, err = FindConsents(email); err != nil {
+		return nil, err
+	}
+
+	err = attributionLog.Scan(func(raw json.RawMessage) error {
+		var record models.AttributionRecord
+		if err := json.Unmarshal(raw, &record); err != nil {
+			return err
+		}
+		if sameEmail(record.Email, email) {
+			export.Attributions = append(export.Attributions, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = bookings.ForEach(func(_ string, raw json.RawMessage) error {
+		var booking models.Booking
+		if err := json.Unmarshal(raw, &booking); err != nil {
+			return err
+		}
+		if sameEmail(booking.Email, email) {
+			export.Bookings = append(export.Bookings, booking)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	allJobs, err := ListJobs("")
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range allJobs {
+		if sameEmail(job.Email, email) {
+			export.Jobs = append(export.Jobs, job)
+		}
+	}
+
+	var pause models.SubscriptionPause
+	found, err := pauses.Get(canonicalEmail(email), &pause)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		export.Pause = &pause
+	}
+
+	if export.Mirror, _, err = MirrorRecord(email); err != nil {
+		return nil, err
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["DataExported"], HashEmail(email))
+	return export, nil
+}
+
+// EraseData deletes the Beehiiv subscription of an email, purges its local records and
+// queued jobs, and appends a tombstone that only holds the hash of the email
+func EraseData(actor models.Actor, email string) (*models.ErasureRecord, error) {
+	record, err := eraseData(actor, email)
+
+	var after interface{}
+	if record != nil {
+		after = record.Records
+	}
+	RecordAudit(actor, models.AuditActionEraseData, HashEmail(email), nil, after, err == nil, err)
+	return record, err
+}
+
+// eraseData deletes the subscription and the local records of an email and writes the tombstone
+func eraseData(actor models.Actor, email string) (*models.ErasureRecord, error) {
+	record := &models.ErasureRecord{
+		EmailHash: HashEmail(email),
+		Records:   map[string]int{},
+	}
+
+	subscriber, err := findSubscriber(email)
+	if err != nil && !errors.Is(err, ErrNotSubscribed) {
+		return nil, err
+	}
+	if subscriber != nil {
+		result, err := unsubscribeForErasure(actor, email)
+		if err != nil {
+			return nil, err
+		}
+		if !result.Success {
+			return nil, fmt.Errorf("deleting subscription failed: %s", result.Message)
+		}
+		record.ProviderErased = true
+
+		// Providers that keep the subscribers who leave need an explicit erasure
+		if eraser, ok := newsletter().(SubscriberEraser); ok {
+			err := eraser.EraseSubscriber(*subscriber)
+			switch {
+			case errors.Is(err, ErrErasureUnsupported):
+				record.ProviderErased = false
+				logger.LogFunction("warn", constants.Messages.Backend.Warn["ProviderErasure"], map[string]string{
+					"provider": newsletter().Name(),
+					"email":    HashEmail(email),
+				})
+			case err != nil:
+				return nil, err
+			}
+		}
+	}
+
+	if record.Records["attributions"], err = attributionLog.Purge(func(raw json.RawMessage) bool {
+		var attribution models.AttributionRecord
+		return json.Unmarshal(raw, &attribution) == nil && sameEmail(attribution.Email, email)
+	}); err != nil {
+		return nil, err
+	}
+
+	// Consents and audit entries are kept as tombstones under the hash of the email, so the
+	// ledger still proves when consent was given and what was done
+	if record.Records["consents"], err = eraseConsents(record.EmailHash); err != nil {
+		return nil, err
+	}
+
+	subscriberIDs := map[string]bool{}
+	if subscriber != nil && subscriber.ID != "" {
+		subscriberIDs[subscriber.ID] = true
+	}
+	if record.Records["audit"], err = eraseAudit(email, subscriberIDs); err != nil {
+		return nil, err
+	}
+
+	if record.Records["mirror"], err = eraseMirror(email); err != nil {
+		return nil, err
+	}
+
+	if record.Records["deadLetters"], err = purgeDeadLetters(email); err != nil {
+		return nil, err
+	}
+
+	if record.Records["divergences"], err = purgeDivergences(email); err != nil {
+		return nil, err
+	}
+
+	if record.Records["outbox"], err = purgeOutbox(email); err != nil {
+		return nil, err
+	}
+
+	if record.Records["jobs"], err = PurgeJobs(email); err != nil {
+		return nil, err
+	}
+
+	err = pauses.Update(func(docs map[string]json.RawMessage) error {
+		if _, ok := docs[canonicalEmail(email)]; ok {
+			delete(docs, canonicalEmail(email))
+			record.Records["pauses"]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = bookings.Update(func(docs map[string]json.RawMessage) error {
+		for id, raw := range docs {
+			var booking models.Booking
+			if err := json.Unmarshal(raw, &booking); err != nil {
+				return err
+			}
+			if sameEmail(booking.Email, email) {
+				delete(docs, id)
+				record.Records["bookings"]++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	record.ErasedAt = time.Now().UTC()
+	if err := erasureLog.Append(record); err != nil {
+		return nil, err
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["DataErased"], map[string]interface{}{
+		"emailHash":      record.EmailHash,
+		"providerErased": record.ProviderErased,
+		"records":        record.Records,
+	})
+	return record, nil
+}
+
+// eraseConsents turns the consent records of an email hash into tombstones without the IP
+// and user agent they were given from
+func eraseConsents(emailHash string) (int, error) {
+	return consentLog.Rewrite(func(raw json.RawMessage) (json.RawMessage, bool) {
+		var consent models.ConsentRecord
+		if json.Unmarshal(raw, &consent) != nil || consent.Erased || consent.EmailHash != emailHash {
+			return nil, false
+		}
+		consent.IP = ""
+		consent.UserAgent = ""
+		consent.Erased = true
+		tombstone, err := json.Marshal(consent)
+		return tombstone, err == nil
+	})
+}
+
+// eraseAudit turns the audit entries about an email, or about any subscriber ID it had, into
+// tombstones that only keep who did what and when, under the hash of the email. Tag changes
+// are audited under the subscriber ID, so the IDs recorded by its subscriptions are added to
+// the given ones.
+func eraseAudit(email string, subscriberIDs map[string]bool) (int, error) {
+	err := auditStore().Scan(func(raw json.RawMessage) error {
+		var entry models.AuditEntry
+		if json.Unmarshal(raw, &entry) != nil || !sameEmail(entry.Target, email) {
+			return nil
+		}
+		for _, details := range []interface{}{entry.Before, entry.After} {
+			if fields, ok := details.(map[string]interface{}); ok {
+				if id, ok := fields["subscriberId"].(string); ok && id != "" {
+					subscriberIDs[id] = true
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	emailHash := HashEmail(email)
+	return auditStore().Rewrite(func(raw json.RawMessage) (json.RawMessage, bool) {
+		var entry models.AuditEntry
+		if json.Unmarshal(raw, &entry) != nil || entry.Erased {
+			return nil, false
+		}
+		if !sameEmail(entry.Target, email) && !subscriberIDs[entry.Target] {
+			return nil, false
+		}
+		entry.Target = emailHash
+		entry.Before = nil
+		entry.After = nil
+		entry.Error = ""
+		entry.Erased = true
+		tombstone, err := json.Marshal(entry)
+		return tombstone, err == nil
+	})
+}
+
+// SendPrivacyLink emails the signed link that lets the owner of an email export or erase
+// their data. The link is sent whether or not the email is subscribed, since bookings
+// and other local records do not depend on the subscription.
+func SendPrivacyLink(email string, action models.PrivacyAction) error {
+	var link string
+	switch action {
+	case models.PrivacyActionExport:
+		link = DataExportURL(email)
+	case models.PrivacyActionErase:
+		link = DataErasureURL(email)
+	default:
+		return fmt.Errorf("unknown privacy action %q", action)
+	}
+	if link == "" {
+		return ErrSignedLinksDisabled
+	}
+
+	if err := SendPrivacyLinkEmail(email, action, link); err != nil {
+		return err
+	}
+
+	logger.LogFunction("info", constants.Messages.Backend.Info["PrivacyLinkSent"], map[string]string{
+		"emailHash": HashEmail(email),
+		"action":    string(action),
+	})
+	return nil
+}
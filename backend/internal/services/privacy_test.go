@@ -0,0 +1,107 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+)
+
+func TestEraseDataKeepsHashedTombstones(t *testing.T) {
+	fakeProviderAPI(t, "beehiiv", func(w http.ResponseWriter, r *http.Request) {
+		recordedResponse(t, w, http.StatusNotFound, "beehiiv/subscription_not_found.json")
+	})
+
+	email := "Ana@Example.com"
+	actor := models.FormActor("test")
+	if _, err := RecordConsent(email, models.SubscriptionSourceNewsletter, "203.0.113.7", "Mozilla/5.0"); err != nil {
+		t.Fatal(err)
+	}
+	RecordAudit(actor, models.AuditActionSubscribe, "ana@example.com", nil, map[string]string{"subscriberId": "sub_ana"}, true, nil)
+	RecordAudit(actor, models.AuditActionAddTag, "sub_ana", nil, map[string]string{"tag": "homelab"}, true, nil)
+	RecordAudit(actor, models.AuditActionSubscribe, "bob@example.com", nil, map[string]string{"subscriberId": "sub_bob"}, true, nil)
+
+	record, err := EraseData(actor, email)
+	if err != nil {
+		t.Fatalf("EraseData: %v", err)
+	}
+	if record.Records["consents"] != 1 || record.Records["audit"] != 2 {
+		t.Errorf("records = %v, want 1 consent and 2 audit entries", record.Records)
+	}
+
+	consents, err := FindConsents(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(consents) != 1 || !consents[0].Erased || consents[0].IP != "" || consents[0].UserAgent != "" {
+		t.Errorf("consents = %+v, want a single tombstone", consents)
+	}
+
+	hash := HashEmail(email)
+	tombstones := 0
+	err = auditStore().Scan(func(raw json.RawMessage) error {
+		var entry models.AuditEntry
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return err
+		}
+		switch {
+		case entry.Target == "ana@example.com" || entry.Target == "sub_ana":
+			t.Errorf("entry %s still names the erased subscriber", entry.ID)
+		case entry.Erased:
+			tombstones++
+			if entry.Target != hash || entry.After != nil {
+				t.Errorf("tombstone %+v keeps details", entry)
+			}
+		case entry.Target == "bob@example.com" && entry.After == nil:
+			t.Error("the entry of another subscriber lost its details")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tombstones != 2 {
+		t.Errorf("got %d tombstones, want 2", tombstones)
+	}
+}
+
+func TestUnsubscribeForErasureDoesNotNotify(t *testing.T) {
+	fakeProviderAPI(t, "beehiiv", recordedAPI(t, map[string]recordedRoute{
+		"GET " + beehiivPath("subscriptions/by_email/ana@example.com"):  {http.StatusOK, "beehiiv/subscription_tags.json"},
+		"DELETE " + beehiivPath("subscriptions/"+beehiivSubscriptionID): {http.StatusNoContent, ""},
+	}))
+	conf().Notify.URLs = []string{"https://hooks.example.com/newsletter"}
+	conf().Notify.Events = nil
+
+	result, err := unsubscribeForErasure(models.FormActor("test"), "ana@example.com")
+	if err != nil || !result.Success {
+		t.Fatalf("unsubscribeForErasure = %+v, %v", result, err)
+	}
+
+	// A notification job would carry the plaintext email, and could outlive the erasure
+	// as a dead letter
+	jobs, err := ListJobs("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 0 {
+		t.Errorf("jobs = %+v, want no notification", jobs)
+	}
+}
+
+func TestHashEmailIsKeyedWithTheLinkSecret(t *testing.T) {
+	useTestConfig(t)
+
+	conf().Security.LinkSecret = strings.Repeat("a", 32)
+	first := HashEmail("Ana@Example.com")
+	if first != HashEmail("ana@example.com") {
+		t.Error("the hash depends on the case of the email")
+	}
+
+	conf().Security.LinkSecret = strings.Repeat("b", 32)
+	if HashEmail("ana@example.com") == first {
+		t.Error("the hash does not depend on the secret")
+	}
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// providerCall is a request received by the fake provider API
+type providerCall struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   string
+}
+
+// redirectTransport sends every request to the fake provider API, whatever its host
+type redirectTransport struct {
+	target *url.URL
+	base   http.RoundTripper
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	redirected := req.Clone(req.Context())
+	redirected.URL.Scheme = t.target.Scheme
+	redirected.URL.Host = t.target.Host
+	return t.base.RoundTrip(redirected)
+}
+
+// fakeProviderAPI points the requests of every provider at handler, and the stores at a
+// temporary directory, until the test ends. It returns the requests received so far. Call it
+// once per test: each call redirects the transport left by the previous one.
+func fakeProviderAPI(t *testing.T, provider string, handler http.HandlerFunc) func() []providerCall {
+	t.Helper()
+
+	var mu sync.Mutex
+	var calls []providerCall
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		calls = append(calls, providerCall{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Query:  r.URL.Query(),
+			Header: r.Header.Clone(),
+			Body:   string(body),
+		})
+		mu.Unlock()
+		handler(w, r)
+	}))
+	target, _ := url.Parse(server.URL)
+
+	transport := http.DefaultTransport
+	useTestConfig(t)
+	http.DefaultTransport = redirectTransport{target: target, base: transport}
+	conf().Newsletter.Provider = provider
+	conf().Newsletter.Secondaries = nil
+	conf().Beehiiv.PubID = "pub_test"
+	conf().Beehiiv.APIKey = "beehiiv-key"
+	resetProviderState()
+
+	t.Cleanup(func() {
+		server.Close()
+		http.DefaultTransport = transport
+		resetProviderState()
+	})
+
+	return func() []providerCall {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]providerCall(nil), calls...)
+	}
+}
+
+// useTestConfig keeps the stores in a temporary directory and restores the configuration
+// changed by the test when it ends
+func useTestConfig(t *testing.T) {
+	t.Helper()
+	saved := *conf()
+	conf().Store.Dir = t.TempDir()
+	t.Cleanup(func() { *conf() = saved })
+}
+
+// resetProviderState forgets the circuit breakers and cached lookups left by other tests
+func resetProviderState() {
+	breakersMu.Lock()
+	breakers = map[string]*circuitBreaker{}
+	breakersMu.Unlock()
+
+	coalesceMu.Lock()
+	lookupCache = map[string]cachedLookup{}
+	coalesceMu.Unlock()
+}
+
+// recordedResponse answers with a provider response recorded in testdata
+func recordedResponse(t *testing.T, w http.ResponseWriter, status int, fixture string) {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatalf("reading fixture %s: %v", fixture, err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// recordedRoute is the answer of the fake provider API to a method and path
+type recordedRoute struct {
+	status  int
+	fixture string
+}
+
+// recordedAPI answers each request with the recorded response of its route, keyed by method
+// and path as in "GET /v3/tags". Routes without a fixture answer with an empty body, and
+// requests without a route fail the test.
+func recordedAPI(t *testing.T, routes map[string]recordedRoute) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		route, ok := routes[r.Method+" "+r.URL.Path]
+		if !ok {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		if route.fixture == "" {
+			w.WriteHeader(route.status)
+			return
+		}
+		recordedResponse(t, w, route.status, route.fixture)
+	}
+}
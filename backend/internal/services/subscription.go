@@ -1,16 +1,45 @@
 package services
 
 import (
+	"time"
+
 	"github.com/mlorentedev/mlorente-backend/internal/constants"
 	"github.com/mlorentedev/mlorente-backend/internal/models"
 	"github.com/mlorentedev/mlorente-backend/pkg/logger"
 )
 
 // ProcessSubscription processes a complete subscription (verification, creation, tagging)
-func ProcessSubscription(email, utmSource string, tags []string) (*models.SubscriptionResult, error) {
-	logger.LogFunction("info", constants.Messages.Backend.Info["RequestProcessing"], map[string]string{
-		"email":     email,
-		"utmSource": utmSource,
+// and records it in the audit log. Changes to the same email run one at a time.
+func ProcessSubscription(actor models.Actor, email string, attribution models.Attribution, tags []string) (*models.SubscriptionResult, error) {
+	unlock := lockEmail(email)
+	defer unlock()
+
+	result, err := processSubscription(actor, email, attribution, tags)
+
+	var before, after interface{}
+	success := false
+	if result != nil {
+		success = result.Success
+		before = map[string]bool{"subscribed": result.AlreadySubscribed}
+		after = map[string]interface{}{"subscriberId": result.SubscriberID, "tags": tags}
+	}
+	RecordAudit(actor, models.AuditActionSubscribe, email, before, after, success, err)
+	if success && !result.AlreadySubscribed {
+		Notify(models.NotificationSubscriberCreated, email, map[string]interface{}{
+			"subscriberId": result.SubscriberID,
+			"tags":         tags,
+			"attribution":  attribution,
+		})
+	}
+	return result, err
+}
+
+// processSubscription checks whether the email is already subscribed, creates the subscriber
+// when it is not and adds the tags
+func processSubscription(actor models.Actor, email string, attribution models.Attribution, tags []string) (*models.SubscriptionResult, error) {
+	logger.LogFunction("info", constants.Messages.Backend.Info["RequestProcessing"], map[string]interface{}{
+		"email":       email,
+		"attribution": attribution,
 	})
 
 	// Check if subscriber already exists
@@ -22,19 +51,12 @@ func ProcessSubscription(email, utmSource string, tags []string) (*models.Subscr
 
 	if subscriberCheck.Success && subscriberCheck.Subscriber != nil {
 		// Update tags for existing subscriber
-		for _, tag := range tags {
-			success := AddTagToSubscriber(subscriberCheck.Subscriber.ID, tag)
-			if !success {
-				logger.LogFunction("error", constants.Messages.Backend.Error["AddTagError"], map[string]string{
-					"email":        email,
-					"subscriberId": subscriberCheck.Subscriber.ID,
-					"tag":          tag,
-				})
-				return &models.SubscriptionResult{
-					Success: false,
-					Message: constants.Messages.Service.Subscription["TagsError"],
-				}, nil
-			}
+		pending, err := applySubscriptionTags(actor, email, subscriberCheck.Subscriber.ID, tags)
+		if err != nil {
+			return &models.SubscriptionResult{
+				Success: false,
+				Message: constants.Messages.Service.Subscription["TagsError"],
+			}, nil
 		}
 
 		logger.LogFunction("info", constants.Messages.Backend.Info["SubscriberExists"], map[string]string{
@@ -42,16 +64,19 @@ func ProcessSubscription(email, utmSource string, tags []string) (*models.Subscr
 			"id":    subscriberCheck.Subscriber.ID,
 		})
 
+		RecordAttribution(email, subscriberCheck.Subscriber.ID, false, attribution)
+
 		return &models.SubscriptionResult{
 			Success:           true,
-			Message:           constants.Messages.Service.Subscription["Updated"],
+			Message:           subscriptionMessage("Updated", pending),
 			SubscriberID:      subscriberCheck.Subscriber.ID,
 			AlreadySubscribed: true,
+			PendingTags:       pending,
 		}, nil
 	}
 
 	// Create a new subscriber
-	newSubscription, err := SubscribeUser(email, utmSource)
+	newSubscription, err := SubscribeUser(email, attribution)
 	if err != nil {
 		logger.LogFunction("error", constants.Messages.Backend.Error["CreateSubscriberError"], err.Error())
 		return nil, err
@@ -61,19 +86,12 @@ func ProcessSubscription(email, utmSource string, tags []string) (*models.Subscr
 		// Add tags to the new subscriber
 		allTags := append([]string{string(models.SubscriptionTagNewSubscriber)}, tags...)
 
-		for _, tag := range allTags {
-			success := AddTagToSubscriber(newSubscription.Subscriber.ID, tag)
-			if !success {
-				logger.LogFunction("error", constants.Messages.Backend.Error["AddTagError"], map[string]string{
-					"email":        email,
-					"subscriberId": newSubscription.Subscriber.ID,
-					"tag":          tag,
-				})
-				return &models.SubscriptionResult{
-					Success: false,
-					Message: constants.Messages.Service.Subscription["TagsError"],
-				}, nil
-			}
+		pending, err := applySubscriptionTags(actor, email, newSubscription.Subscriber.ID, allTags)
+		if err != nil {
+			return &models.SubscriptionResult{
+				Success: false,
+				Message: constants.Messages.Service.Subscription["TagsError"],
+			}, nil
 		}
 
 		logger.LogFunction("info", constants.Messages.Backend.Info["NewSubscriber"], map[string]string{
@@ -81,16 +99,19 @@ func ProcessSubscription(email, utmSource string, tags []string) (*models.Subscr
 			"id":    newSubscription.Subscriber.ID,
 		})
 
+		RecordAttribution(email, newSubscription.Subscriber.ID, true, attribution)
+
 		return &models.SubscriptionResult{
 			Success:      true,
-			Message:      constants.Messages.Service.Subscription["New"],
+			Message:      subscriptionMessage("New", pending),
 			SubscriberID: newSubscription.Subscriber.ID,
+			PendingTags:  pending,
 		}, nil
 	}
 
-	logger.LogFunction("error", constants.Messages.Backend.Error["SubscriptionError"], map[string]string{
-		"email":     email,
-		"utmSource": utmSource,
+	logger.LogFunction("error", constants.Messages.Backend.Error["SubscriptionError"], map[string]interface{}{
+		"email":       email,
+		"attribution": attribution,
 	})
 
 	return &models.SubscriptionResult{
@@ -98,3 +119,46 @@ func ProcessSubscription(email, utmSource string, tags []string) (*models.Subscr
 		Message: constants.Messages.Service.Subscription["Error"],
 	}, nil
 }
+
+// applySubscriptionTags adds the tags of a subscription. Tags that fail do not fail the
+// subscription: they are retried in the background and returned as pending. Only failing to
+// schedule that retry is an error.
+func applySubscriptionTags(actor models.Actor, email, subscriberID string, tags []string) ([]string, error) {
+	failed, _ := AddTagsToSubscriber(actor, subscriberID, tags)
+	if len(failed) == 0 {
+		return nil, nil
+	}
+	if err := retryTagsLater(email, subscriberID, failed); err != nil {
+		return nil, err
+	}
+	return failed, nil
+}
+
+// retryTagsLater schedules in the job queue the tags that could not be added to a subscriber
+func retryTagsLater(email, subscriberID string, failed []string) error {
+	payload := models.TagsJobPayload{SubscriberID: subscriberID, Tags: failed}
+	if _, err := EnqueueJob(models.JobTypeAddTags, email, payload, time.Now().Add(time.Minute)); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["AddTagError"], map[string]interface{}{
+			"email":        email,
+			"subscriberId": subscriberID,
+			"tags":         failed,
+		})
+		return err
+	}
+
+	logger.LogFunction("warn", constants.Messages.Backend.Warn["TagsRetry"], map[string]interface{}{
+		"email":        email,
+		"subscriberId": subscriberID,
+		"tags":         failed,
+	})
+	return nil
+}
+
+// subscriptionMessage returns the subscription message with the given key, or the one telling
+// that some tags are still pending
+func subscriptionMessage(key string, pending []string) string {
+	if len(pending) > 0 {
+		return constants.Messages.Service.Subscription["TagsPending"]
+	}
+	return constants.Messages.Service.Subscription[key]
+}
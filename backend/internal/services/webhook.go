@@ -0,0 +1,251 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+	"github.com/mlorentedev/mlorente-backend/internal/store"
+	"github.com/mlorentedev/mlorente-backend/pkg/logger"
+)
+
+const (
+	// BeehiivSignatureHeader carries the hex HMAC-SHA256 of "<timestamp>.<body>"
+	BeehiivSignatureHeader = "X-Beehiiv-Signature"
+	// BeehiivTimestampHeader carries the Unix time at which the webhook was signed
+	BeehiivTimestampHeader = "X-Beehiiv-Timestamp"
+
+	// webhookReceiptTTL is how long processed event IDs are remembered; Beehiiv retries
+	// a failed delivery for a few days with the same event ID
+	webhookReceiptTTL = 7 * 24 * time.Hour
+)
+
+var (
+	// ErrWebhooksDisabled is returned when no webhook secret is configured
+	ErrWebhooksDisabled = errors.New("inbound webhooks are disabled: BEEHIIV_WEBHOOK_SECRET is not set")
+	// ErrInvalidSignature is returned when a webhook signature is missing or does not match
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrStaleWebhook is returned when a webhook timestamp is outside the tolerance, as in a replay
+	ErrStaleWebhook = errors.New("webhook timestamp outside the accepted tolerance")
+	// ErrInvalidWebhook is returned when a webhook body cannot be parsed
+	ErrInvalidWebhook = errors.New("invalid webhook payload")
+)
+
+var (
+	// webhookReceipts remembers the processed event IDs to make deliveries idempotent
+	webhookReceipts = store.NewCollection("webhooks.json")
+
+	webhookMu sync.Mutex
+)
+
+// VerifyBeehiivWebhook checks the signature of a webhook body and rejects timestamps
+// older or newer than the configured tolerance
+func VerifyBeehiivWebhook(timestamp, signature string, body []byte) error {
+	if conf().Beehiiv.WebhookSecret == "" {
+		return ErrWebhooksDisabled
+	}
+
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil || len(expected) == 0 {
+		return ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(conf().Beehiiv.WebhookSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return ErrInvalidSignature
+	}
+
+	// The timestamp is covered by the signature, so it cannot be refreshed by a replay
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrStaleWebhook
+	}
+	age := time.Since(time.Unix(seconds, 0))
+	tolerance := time.Duration(conf().Beehiiv.WebhookToleranceSeconds) * time.Second
+	if age > tolerance || age < -tolerance {
+		return ErrStaleWebhook
+	}
+	return nil
+}
+
+// ParseBeehiivWebhook decodes a webhook body into its typed event. Event types that are
+// not handled return the envelope with a nil event.
+func ParseBeehiivWebhook(body []byte) (*models.BeehiivWebhook, interface{}, error) {
+	var webhook models.BeehiivWebhook
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+	if webhook.ID == "" || webhook.Type == "" {
+		return nil, nil, fmt.Errorf("%w: missing event ID or type", ErrInvalidWebhook)
+	}
+
+	switch webhook.Type {
+	case models.WebhookEventSubscriptionCreated, models.WebhookEventSubscriptionDeleted:
+		var subscriber models.Subscriber
+		if err := json.Unmarshal(webhook.Data, &subscriber); err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+		}
+		if subscriber.Email == "" {
+			return nil, nil, fmt.Errorf("%w: missing subscriber email", ErrInvalidWebhook)
+		}
+		if webhook.Type == models.WebhookEventSubscriptionCreated {
+			return &webhook, models.SubscriptionCreatedEvent{ID: webhook.ID, Subscriber: subscriber}, nil
+		}
+		return &webhook, models.SubscriptionDeletedEvent{ID: webhook.ID, Subscriber: subscriber}, nil
+
+	case models.WebhookEventTagsAdded, models.WebhookEventTagsRemoved:
+		event := models.TagsEvent{ID: webhook.ID, Added: webhook.Type == models.WebhookEventTagsAdded}
+		if err := json.Unmarshal(webhook.Data, &event); err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+		}
+		if event.SubscriptionID == "" {
+			return nil, nil, fmt.Errorf("%w: missing subscription ID", ErrInvalidWebhook)
+		}
+		return &webhook, event, nil
+	}
+
+	return &webhook, nil, nil
+}
+
+// HandleBeehiivWebhook applies a verified webhook to the local state. Deliveries of an event
+// ID already processed are acknowledged without applying them again, reporting duplicate.
+// Events that fail are not remembered, so that Beehiiv's retry applies them.
+func HandleBeehiivWebhook(body []byte) (eventID string, duplicate bool, err error) {
+	webhook, event, err := ParseBeehiivWebhook(body)
+	if err != nil {
+		return "", false, err
+	}
+
+	webhookMu.Lock()
+	defer webhookMu.Unlock()
+
+	var receipt models.WebhookReceipt
+	found, err := webhookReceipts.Get(webhook.ID, &receipt)
+	if err != nil {
+		return webhook.ID, false, err
+	}
+	if found {
+		logger.LogFunction("info", constants.Messages.Backend.Info["WebhookDuplicate"], map[string]string{
+			"id":   webhook.ID,
+			"type": string(webhook.Type),
+		})
+		return webhook.ID, true, nil
+	}
+
+	outcome := models.WebhookOutcomeProcessed
+	if event == nil {
+		outcome = models.WebhookOutcomeIgnored
+		logger.LogFunction("warn", constants.Messages.Backend.Warn["WebhookIgnored"], map[string]string{
+			"id":   webhook.ID,
+			"type": string(webhook.Type),
+		})
+	} else if err := applyWebhookEvent(event); err != nil {
+		logger.LogFunction("error", constants.Messages.Backend.Error["WebhookError"], map[string]string{
+			"id":    webhook.ID,
+			"type":  string(webhook.Type),
+			"error": err.Error(),
+		})
+		return webhook.ID, false, err
+	}
+
+	if err := rememberWebhook(models.WebhookReceipt{
+		ID:         webhook.ID,
+		Type:       webhook.Type,
+		Outcome:    outcome,
+		ReceivedAt: time.Now().UTC(),
+	}); err != nil {
+		return webhook.ID, false, err
+	}
+
+	if outcome == models.WebhookOutcomeProcessed {
+		logger.LogFunction("info", constants.Messages.Backend.Info["WebhookProcessed"], map[string]string{
+			"id":   webhook.ID,
+			"type": string(webhook.Type),
+		})
+	}
+	return webhook.ID, false, nil
+}
+
+// rememberWebhook stores a webhook receipt and drops the ones older than webhookReceiptTTL
+func rememberWebhook(receipt models.WebhookReceipt) error {
+	return webhookReceipts.Update(func(docs map[string]json.RawMessage) error {
+		cutoff := time.Now().Add(-webhookReceiptTTL)
+		for id, raw := range docs {
+			var previous models.WebhookReceipt
+			if err := json.Unmarshal(raw, &previous); err != nil {
+				return err
+			}
+			if previous.ReceivedAt.Before(cutoff) {
+				delete(docs, id)
+			}
+		}
+
+		encoded, err := json.Marshal(receipt)
+		if err != nil {
+			return err
+		}
+		docs[receipt.ID] = encoded
+		return nil
+	})
+}
+
+// applyWebhookEvent brings the local state in line with a Beehiiv event and audits it
+func applyWebhookEvent(event interface{}) error {
+	actor := models.WebhookActor("beehiiv")
+
+	switch e := event.(type) {
+	case models.SubscriptionCreatedEvent:
+		mirrorSubscriber(e.Subscriber)
+		forgetLookup(e.Subscriber.Email)
+		RecordAudit(actor, models.AuditActionSubscribe, e.Subscriber.Email, nil,
+			map[string]string{"subscriberId": e.Subscriber.ID, "event": e.ID}, true, nil)
+
+	case models.SubscriptionDeletedEvent:
+		// Someone who leaves from a Beehiiv email, or whose address bounces, has nothing left to resume
+		// and no follow-up email to receive
+		email := e.Subscriber.Email
+		// Unsubscribes made through this API were already notified and forgotten
+		if _, known := mirroredSubscriber(email); known {
+			Notify(models.NotificationSubscriberUnsubscribed, email, map[string]string{
+				"subscriberId": e.Subscriber.ID,
+				"status":       e.Subscriber.Status,
+			})
+		}
+		forgetSubscriber(email)
+		forgetLookup(email)
+		_, err := CancelJobs(email, models.JobTypeResumeSubscription)
+		if err == nil {
+			_, err = StopDrips(email, "")
+		}
+		if err == nil {
+			err = pauses.Delete(canonicalEmail(email))
+		}
+		RecordAudit(actor, models.AuditActionUnsubscribe, email,
+			map[string]string{"subscriberId": e.Subscriber.ID}, map[string]string{"event": e.ID, "status": e.Subscriber.Status},
+			err == nil, err)
+		return err
+
+	case models.TagsEvent:
+		action := models.AuditActionRemoveTag
+		if e.Added {
+			action = models.AuditActionAddTag
+		}
+		forgetLookupByID(e.SubscriptionID)
+		for _, tag := range e.Tags {
+			mirrorTag(e.SubscriptionID, tag, e.Added)
+			RecordAudit(actor, action, e.SubscriptionID, nil, map[string]string{"tag": tag, "event": e.ID}, true, nil)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Collection is a set of JSON documents indexed by key, persisted as a single JSON file.
+// Every write replaces the file atomically, so it is meant for small data sets.
+type Collection struct {
+	mu   sync.Mutex
+	name string
+}
+
+// NewCollection returns a collection stored in the data directory under the given file name
+func NewCollection(name string) *Collection {
+	return &Collection{name: name}
+}
+
+// Get decodes the document stored under key into v and reports whether it exists
+func (c *Collection) Get(key string, v interface{}) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	docs, err := c.load()
+	if err != nil {
+		return false, err
+	}
+
+	raw, ok := docs[key]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+// Put stores v under key, replacing any previous document
+func (c *Collection) Put(key string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return c.Update(func(docs map[string]json.RawMessage) error {
+		docs[key] = raw
+		return nil
+	})
+}
+
+// Delete removes the document stored under key, if any
+func (c *Collection) Delete(key string) error {
+	return c.Update(func(docs map[string]json.RawMessage) error {
+		delete(docs, key)
+		return nil
+	})
+}
+
+// ForEach calls fn with every document in key order, stopping at the first error
+func (c *Collection) ForEach(fn func(key string, raw json.RawMessage) error) error {
+	c.mu.Lock()
+	docs, err := c.load()
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(docs))
+	for key := range docs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := fn(key, docs[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Update runs fn with exclusive access to all documents and persists the changes it makes.
+// Nothing is written if fn returns an error, which makes it suitable for check-and-set logic.
+func (c *Collection) Update(fn func(docs map[string]json.RawMessage) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	docs, err := c.load()
+	if err != nil {
+		return err
+	}
+	if err := fn(docs); err != nil {
+		return err
+	}
+	return c.save(docs)
+}
+
+// load reads all documents from disk. A missing file is an empty collection.
+func (c *Collection) load() (map[string]json.RawMessage, error) {
+	docs := map[string]json.RawMessage{}
+
+	path, err := Path(c.name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return docs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return docs, nil
+	}
+	return docs, json.Unmarshal(data, &docs)
+}
+
+// save writes all documents to a temporary file and renames it over the collection file
+func (c *Collection) save(docs map[string]json.RawMessage) error {
+	path, err := Path(c.name)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(docs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
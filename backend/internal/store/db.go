@@ -0,0 +1,59 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// dbOpenTimeout bounds the wait for the file lock held by another process using the database
+const dbOpenTimeout = 5 * time.Second
+
+// DB is an embedded bbolt database for data that needs indexed lookups. The file is opened
+// for each transaction and closed afterwards, so the server and the CLI can take turns
+// using it, and it always lives in the data directory currently configured.
+type DB struct {
+	mu   sync.Mutex
+	name string
+}
+
+// NewDB returns a database stored in the data directory under the given file name
+func NewDB(name string) *DB {
+	return &DB{name: name}
+}
+
+// View runs fn in a read-only transaction
+func (d *DB) View(fn func(tx *bolt.Tx) error) error {
+	return d.run(func(db *bolt.DB) error {
+		return db.View(fn)
+	})
+}
+
+// Update runs fn in a read-write transaction. Nothing is written if fn returns an error.
+func (d *DB) Update(fn func(tx *bolt.Tx) error) error {
+	return d.run(func(db *bolt.DB) error {
+		return db.Update(fn)
+	})
+}
+
+// run opens the database file, runs fn and closes it again
+func (d *DB) run(fn func(db *bolt.DB) error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	path, err := Path(d.name)
+	if err != nil {
+		return err
+	}
+
+	db, err := bolt.Open(path, 0o640, &bolt.Options{Timeout: dbOpenTimeout})
+	if err != nil {
+		return err
+	}
+	if err := fn(db); err != nil {
+		db.Close()
+		return err
+	}
+	return db.Close()
+}
@@ -0,0 +1,214 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Log is an append-only JSON Lines file. Each record is written as a single line.
+// A rotating log moves the file aside once it grows beyond a size limit, keeping a
+// fixed number of older files named after the log with a ".1", ".2"... suffix.
+type Log struct {
+	mu       sync.Mutex
+	name     string
+	maxBytes int64
+	keep     int
+}
+
+// NewLog returns a log stored in the data directory under the given file name
+func NewLog(name string) *Log {
+	return &Log{name: name}
+}
+
+// NewRotatingLog returns a log that is rotated before it grows beyond maxBytes,
+// keeping at most keep rotated files. Older files are deleted.
+func NewRotatingLog(name string, maxBytes int64, keep int) *Log {
+	return &Log{name: name, maxBytes: maxBytes, keep: keep}
+}
+
+// paths returns the files of the log from the oldest rotated one to the current one
+func (l *Log) paths() ([]string, error) {
+	path, err := Path(l.name)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for i := l.keep; i >= 1; i-- {
+		paths = append(paths, fmt.Sprintf("%s.%d", path, i))
+	}
+	return append(paths, path), nil
+}
+
+// rotate shifts the rotated files by one position and moves the current file to ".1"
+func (l *Log) rotate(path string) error {
+	if l.keep <= 0 {
+		return os.Remove(path)
+	}
+
+	oldest := fmt.Sprintf("%s.%d", path, l.keep)
+	if err := os.Remove(oldest); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for i := l.keep - 1; i >= 1; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(path, path+".1")
+}
+
+// Append marshals the record and writes it at the end of the log
+func (l *Log) Append(record interface{}) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	path, err := Path(l.name)
+	if err != nil {
+		return err
+	}
+
+	if l.maxBytes > 0 {
+		info, err := os.Stat(path)
+		if err == nil && info.Size() > 0 && info.Size()+int64(len(line))+1 > l.maxBytes {
+			if err := l.rotate(path); err != nil {
+				return err
+			}
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// Scan calls fn with every record of the log, rotated files included, oldest first,
+// stopping at the first error
+func (l *Log) Scan(fn func(record json.RawMessage) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	paths, err := l.paths()
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := scanFile(path, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanFile calls fn with every record of a single log file. A missing file has no records.
+func scanFile(path string, fn func(record json.RawMessage) error) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := fn(append(json.RawMessage(nil), scanner.Bytes()...)); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Purge rewrites the log, rotated files included, without the records for which drop
+// returns true and reports how many were removed. Each file is replaced atomically.
+func (l *Log) Purge(drop func(record json.RawMessage) bool) (int, error) {
+	return l.rewrite(func(record json.RawMessage) (json.RawMessage, bool) {
+		return nil, drop(record)
+	})
+}
+
+// Rewrite rewrites the log, rotated files included, replacing every record for which edit
+// returns true with the record it returns, and reports how many were replaced. Each file
+// is replaced atomically.
+func (l *Log) Rewrite(edit func(record json.RawMessage) (json.RawMessage, bool)) (int, error) {
+	return l.rewrite(edit)
+}
+
+// rewrite applies edit to every file of the log. Records edited into nil are removed.
+func (l *Log) rewrite(edit func(record json.RawMessage) (json.RawMessage, bool)) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	paths, err := l.paths()
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, path := range paths {
+		changed, err := rewriteFile(path, edit)
+		total += changed
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// rewriteFile rewrites a single log file with the records edited by edit
+func rewriteFile(path string, edit func(record json.RawMessage) (json.RawMessage, bool)) (int, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var kept bytes.Buffer
+	changed := 0
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if replacement, ok := edit(json.RawMessage(line)); ok {
+			changed++
+			if len(replacement) == 0 {
+				continue
+			}
+			line = replacement
+		}
+		kept.Write(line)
+		kept.WriteByte('\n')
+	}
+	if changed == 0 {
+		return 0, nil
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, kept.Bytes(), 0o640); err != nil {
+		return 0, err
+	}
+	return changed, os.Rename(tmp, path)
+}
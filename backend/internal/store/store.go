@@ -0,0 +1,22 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/mlorentedev/mlorente-backend/pkg/config"
+)
+
+// Path returns the location of a data file inside the configured data directory,
+// creating the directory if it does not exist yet
+func Path(name string) (string, error) {
+	dir := "data"
+	if conf, err := config.GetConfig(); err == nil && conf.Store.Dir != "" {
+		dir = conf.Store.Dir
+	}
+
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
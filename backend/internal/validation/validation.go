@@ -0,0 +1,380 @@
+package validation
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/net/idna"
+
+	"github.com/mlorentedev/mlorente-backend/internal/constants"
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+)
+
+const (
+	// MaxEmailLength is the maximum length of an address accepted by SMTP (RFC 5321)
+	MaxEmailLength = 254
+	// MaxTags is the maximum number of tags accepted in a single request
+	MaxTags = 10
+	// MaxTagLength is the maximum length of a single tag
+	MaxTagLength = 50
+	// MaxUTMLength is the maximum length kept for UTM and attribution fields
+	MaxUTMLength = 100
+	// MaxURLLength is the maximum length kept for attribution URLs
+	MaxURLLength = 512
+	// MaxNameLength is the maximum length of a contact name
+	MaxNameLength = 100
+	// MaxSubjectLength is the maximum length of a contact subject
+	MaxSubjectLength = 150
+	// MinMessageLength is the minimum length of a contact message
+	MinMessageLength = 10
+	// MaxMessageLength is the maximum length of a contact message
+	MaxMessageLength = 5000
+	// MaxNotesLength is the maximum length of the notes attached to a booking
+	MaxNotesLength = 1000
+	// MaxPauseWeeks is the longest pause a subscriber can request from the preference center
+	MaxPauseWeeks = 12
+)
+
+var (
+	emailPattern      = regexp.MustCompile(`^[a-z0-9._%+-]+@[a-z0-9.-]+\.(?:[a-z]{2,}|xn--[a-z0-9-]+)$`)
+	tagPattern        = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	resourceIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+	fileIDPattern     = regexp.MustCompile(`^[A-Za-z0-9_-]{1,128}$`)
+)
+
+func init() {
+	// Report binding errors with the JSON field names used by the forms
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+			if name == "" || name == "-" {
+				return field.Name
+			}
+			return name
+		})
+	}
+}
+
+// NormalizeEmail trims and lowercases the address and converts internationalized domains
+// to punycode before checking its format. The result is the canonical form stored and
+// compared everywhere.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return "", errors.New("email must contain a local part and a domain")
+	}
+
+	domain, err := idna.Lookup.ToASCII(strings.ToLower(email[at+1:]))
+	if err != nil {
+		return "", err
+	}
+
+	normalized := strings.ToLower(email[:at]) + "@" + domain
+	if len(normalized) > MaxEmailLength || !emailPattern.MatchString(normalized) {
+		return "", errors.New("invalid email format")
+	}
+	return normalized, nil
+}
+
+// SanitizeUTM strips control and unexpected characters from an attribution value
+// and truncates it to MaxUTMLength
+func SanitizeUTM(value string) string {
+	value = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r):
+			return r
+		case strings.ContainsRune(" ._-+/:", r):
+			return r
+		}
+		return -1
+	}, strings.TrimSpace(value))
+
+	if runes := []rune(value); len(runes) > MaxUTMLength {
+		value = string(runes[:MaxUTMLength])
+	}
+	return strings.TrimSpace(value)
+}
+
+// SanitizeURL keeps an attribution URL only if it is an absolute http(s) URL,
+// dropping credentials and fragments and the query string if it is too long
+func SanitizeURL(value string) string {
+	parsed, err := url.Parse(strings.TrimSpace(value))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return ""
+	}
+
+	parsed.User = nil
+	parsed.Fragment = ""
+	if len(parsed.String()) > MaxURLLength {
+		parsed.RawQuery = ""
+	}
+	if result := parsed.String(); len(result) <= MaxURLLength {
+		return result
+	}
+	return ""
+}
+
+// SanitizeAttribution cleans every attribution field in place. The referring site
+// may be either a URL or a bare domain.
+func SanitizeAttribution(attribution *models.Attribution) {
+	attribution.UtmSource = SanitizeUTM(attribution.UtmSource)
+	attribution.UtmMedium = SanitizeUTM(attribution.UtmMedium)
+	attribution.UtmCampaign = SanitizeUTM(attribution.UtmCampaign)
+	attribution.UtmTerm = SanitizeUTM(attribution.UtmTerm)
+	attribution.UtmContent = SanitizeUTM(attribution.UtmContent)
+	attribution.LandingPage = SanitizeURL(attribution.LandingPage)
+
+	if site := SanitizeURL(attribution.ReferringSite); site != "" {
+		attribution.ReferringSite = site
+	} else {
+		attribution.ReferringSite = SanitizeUTM(attribution.ReferringSite)
+	}
+}
+
+// ValidateEmail normalizes the email in place and reports a field error if it is invalid
+func ValidateEmail(field string, email *string) []models.FieldError {
+	if strings.TrimSpace(*email) == "" {
+		return []models.FieldError{fieldError(field, "RequiredField")}
+	}
+	normalized, err := NormalizeEmail(*email)
+	if err != nil {
+		return []models.FieldError{fieldError(field, "InvalidEmail")}
+	}
+	*email = normalized
+	return nil
+}
+
+// ValidateTags normalizes and dedupes the tags in place, checking their format,
+// length, count and, when allowedTags is not empty, that they are in the whitelist
+func ValidateTags(field string, tags *[]string, allowedTags []string) []models.FieldError {
+	if len(*tags) > MaxTags {
+		return []models.FieldError{fieldError(field, "TooManyTags")}
+	}
+
+	allowed := map[string]bool{}
+	for _, tag := range allowedTags {
+		allowed[strings.ToLower(strings.TrimSpace(tag))] = true
+	}
+
+	var result []string
+	seen := map[string]bool{}
+	for _, tag := range *tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > MaxTagLength {
+			return []models.FieldError{fieldError(field, "FieldTooLong")}
+		}
+		if !tagPattern.MatchString(tag) || (len(allowed) > 0 && !allowed[tag]) {
+			return []models.FieldError{fieldError(field, "InvalidTag")}
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+
+	*tags = result
+	return nil
+}
+
+// ValidateResourceID checks that a resource identifier is a lowercase slug
+func ValidateResourceID(field string, resourceID *string) []models.FieldError {
+	*resourceID = strings.TrimSpace(*resourceID)
+	if *resourceID == "" {
+		return []models.FieldError{fieldError(field, "RequiredField")}
+	}
+	if !resourceIDPattern.MatchString(*resourceID) {
+		return []models.FieldError{fieldError(field, "InvalidResourceID")}
+	}
+	return nil
+}
+
+// ValidateFileID checks that an optional file identifier is safe to embed in a URL
+func ValidateFileID(field string, fileID *string) []models.FieldError {
+	*fileID = strings.TrimSpace(*fileID)
+	if *fileID != "" && !fileIDPattern.MatchString(*fileID) {
+		return []models.FieldError{fieldError(field, "InvalidFileID")}
+	}
+	return nil
+}
+
+// ValidateSubscriptionRequest normalizes and validates a subscription request in place
+func ValidateSubscriptionRequest(request *models.SubscriptionRequest, allowedTags []string) []models.FieldError {
+	var errs []models.FieldError
+	errs = append(errs, ValidateEmail("email", &request.Email)...)
+	errs = append(errs, ValidateTags("tags", &request.Tags, allowedTags)...)
+	SanitizeAttribution(&request.Attribution)
+	return errs
+}
+
+// ValidateUnsubscriptionRequest normalizes and validates an unsubscription request in place
+func ValidateUnsubscriptionRequest(request *models.UnsubscriptionRequest) []models.FieldError {
+	return ValidateEmail("email", &request.Email)
+}
+
+// ValidateResourceRequest normalizes and validates a lead magnet request in place
+func ValidateResourceRequest(request *models.ResourceRequest, allowedTags []string) []models.FieldError {
+	var errs []models.FieldError
+	errs = append(errs, ValidateEmail("email", &request.Email)...)
+	errs = append(errs, ValidateResourceID("resource_id", &request.ResourceID)...)
+	errs = append(errs, ValidateFileID("file_id", &request.FileID)...)
+	errs = append(errs, ValidateTags("tags", &request.Tags, allowedTags)...)
+	SanitizeAttribution(&request.Attribution)
+	return errs
+}
+
+// ValidateText trims a free text field, removes control characters (keeping line breaks
+// when multiline) and checks its length in characters
+func ValidateText(field string, value *string, minLength, maxLength int, multiline bool) []models.FieldError {
+	*value = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if multiline && (r == '\n' || r == '\t') {
+			return r
+		}
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, *value))
+
+	length := len([]rune(*value))
+	switch {
+	case length == 0 && minLength > 0:
+		return []models.FieldError{fieldError(field, "RequiredField")}
+	case length < minLength:
+		return []models.FieldError{fieldError(field, "FieldTooShort")}
+	case length > maxLength:
+		return []models.FieldError{fieldError(field, "FieldTooLong")}
+	}
+	return nil
+}
+
+// ValidateContactRequest normalizes and validates a contact message in place
+func ValidateContactRequest(request *models.ContactRequest) []models.FieldError {
+	var errs []models.FieldError
+	errs = append(errs, ValidateText("name", &request.Name, 1, MaxNameLength, false)...)
+	errs = append(errs, ValidateEmail("email", &request.Email)...)
+	errs = append(errs, ValidateText("subject", &request.Subject, 0, MaxSubjectLength, false)...)
+	errs = append(errs, ValidateText("message", &request.Message, MinMessageLength, MaxMessageLength, true)...)
+	return errs
+}
+
+// ValidateTime parses an RFC 3339 timestamp into target, reporting a field error if it is invalid
+func ValidateTime(field, value string, target *time.Time) []models.FieldError {
+	parsed, err := time.Parse(time.RFC3339, strings.TrimSpace(value))
+	if err != nil {
+		return []models.FieldError{fieldError(field, "InvalidSlot")}
+	}
+	*target = parsed
+	return nil
+}
+
+// ValidateBookingHoldRequest validates a slot hold request and returns the requested start time
+func ValidateBookingHoldRequest(request *models.BookingHoldRequest) (time.Time, []models.FieldError) {
+	var start time.Time
+	return start, ValidateTime("start", request.Start, &start)
+}
+
+// ValidateBookingRequest normalizes and validates a booking request in place
+// and returns the requested start time
+func ValidateBookingRequest(request *models.BookingRequest) (time.Time, []models.FieldError) {
+	var start time.Time
+	var errs []models.FieldError
+	errs = append(errs, ValidateText("name", &request.Name, 1, MaxNameLength, false)...)
+	errs = append(errs, ValidateEmail("email", &request.Email)...)
+	errs = append(errs, ValidateText("notes", &request.Notes, 0, MaxNotesLength, true)...)
+	errs = append(errs, ValidateTime("start", request.Start, &start)...)
+	request.HoldID = strings.TrimSpace(request.HoldID)
+	return start, errs
+}
+
+// ValidatePreferencesRequest normalizes and validates a preference center update in place.
+// Topics must be among the given newsletter topics.
+func ValidatePreferencesRequest(request *models.PreferencesRequest, newsletterTopics []string) []models.FieldError {
+	var errs []models.FieldError
+
+	request.Token = strings.TrimSpace(request.Token)
+	if request.Token == "" {
+		errs = append(errs, fieldError("token", "RequiredField"))
+	}
+
+	topics := map[string]bool{}
+	for _, topic := range newsletterTopics {
+		topics[strings.ToLower(strings.TrimSpace(topic))] = true
+	}
+
+	// A missing topics field leaves the subscriptions untouched, an empty list clears them
+	var result []string
+	if request.Topics != nil {
+		result = []string{}
+	}
+	seen := map[string]bool{}
+	for _, topic := range request.Topics {
+		topic = strings.ToLower(strings.TrimSpace(topic))
+		if topic == "" || seen[topic] {
+			continue
+		}
+		if !topics[topic] {
+			errs = append(errs, fieldError("topics", "InvalidTopic"))
+			break
+		}
+		seen[topic] = true
+		result = append(result, topic)
+	}
+	request.Topics = result
+
+	if request.PauseWeeks < 0 || request.PauseWeeks > MaxPauseWeeks {
+		errs = append(errs, fieldError("pause_weeks", "InvalidPause"))
+	}
+	return errs
+}
+
+// ValidatePreferencesLinkRequest normalizes and validates a preference center link request in place
+func ValidatePreferencesLinkRequest(request *models.PreferencesLinkRequest) []models.FieldError {
+	return ValidateEmail("email", &request.Email)
+}
+
+// ValidatePrivacyLinkRequest normalizes and validates a data export or erasure link request in place
+func ValidatePrivacyLinkRequest(request *models.PrivacyLinkRequest) []models.FieldError {
+	errs := ValidateEmail("email", &request.Email)
+
+	request.Action = models.PrivacyAction(strings.ToLower(strings.TrimSpace(string(request.Action))))
+	if request.Action != models.PrivacyActionExport && request.Action != models.PrivacyActionErase {
+		errs = append(errs, fieldError("action", "InvalidAction"))
+	}
+	return errs
+}
+
+// BindingErrors converts the error returned by gin's binding into field errors.
+// Errors that are not tied to a field (malformed bodies) are reported without one.
+func BindingErrors(err error) []models.FieldError {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return []models.FieldError{{Message: constants.Messages.Frontend.Errors["IncompleteData"]}}
+	}
+
+	var errs []models.FieldError
+	for _, fe := range validationErrors {
+		key := "IncompleteData"
+		if fe.Tag() == "required" {
+			key = "RequiredField"
+		}
+		errs = append(errs, fieldError(fe.Field(), key))
+	}
+	return errs
+}
+
+// fieldError builds a field error with the frontend message identified by key
+func fieldError(field, key string) models.FieldError {
+	return models.FieldError{
+		Field:   field,
+		Message: constants.Messages.Frontend.Errors[key],
+	}
+}
@@ -0,0 +1,152 @@
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mlorentedev/mlorente-backend/internal/models"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	cases := map[string]string{
+		"  Someone@Example.COM ": "someone@example.com",
+		"a@пример.рф":            "a@xn--e1afmkfd.xn--p1ai",
+		"user+tag@müller.de":     "user+tag@xn--mller-kva.de",
+	}
+	for input, want := range cases {
+		got, err := NormalizeEmail(input)
+		if err != nil {
+			t.Errorf("NormalizeEmail(%q) failed: %v", input, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("NormalizeEmail(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestNormalizeEmailRejectsInvalid(t *testing.T) {
+	for _, input := range []string{"", "no-at-sign", "@example.com", "someone@", "someone@example", "someone@example.c0m"} {
+		if got, err := NormalizeEmail(input); err == nil {
+			t.Errorf("NormalizeEmail(%q) = %q, want an error", input, got)
+		}
+	}
+}
+
+func TestValidateEmail(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  string
+		err   string
+	}{
+		{name: "ascii", input: " Ana@Example.com", want: "ana@example.com"},
+		{name: "idn domain", input: "ana@Bücher.example", want: "ana@xn--bcher-kva.example"},
+		{name: "punycode tld", input: "ana@example.xn--p1ai", want: "ana@example.xn--p1ai"},
+		{name: "idn tld", input: "ana@пример.рф", want: "ana@xn--e1afmkfd.xn--p1ai"},
+		{name: "empty", input: "  ", err: "RequiredField"},
+		{name: "numeric tld", input: "ana@example.123", err: "InvalidEmail"},
+		{name: "too long", input: strings.Repeat("a", MaxEmailLength) + "@example.com", err: "InvalidEmail"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			email := tc.input
+			errs := ValidateEmail("email", &email)
+			if tc.err != "" {
+				assertFieldError(t, errs, "email", tc.err)
+				return
+			}
+			if len(errs) > 0 {
+				t.Fatalf("ValidateEmail(%q) = %v, want no errors", tc.input, errs)
+			}
+			if email != tc.want {
+				t.Errorf("ValidateEmail(%q) normalized to %q, want %q", tc.input, email, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	tooMany := make([]string, MaxTags+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("tag-%d", i)
+	}
+
+	cases := []struct {
+		name    string
+		tags    []string
+		allowed []string
+		want    []string
+		err     string
+	}{
+		{name: "normalized and deduped", tags: []string{" Homelab", "homelab", "", "dev_ops"}, want: []string{"homelab", "dev_ops"}},
+		{name: "allowed mixed case", tags: []string{"homelab"}, allowed: []string{" HomeLab "}, want: []string{"homelab"}},
+		{name: "not in whitelist", tags: []string{"homelab", "spam"}, allowed: []string{"homelab"}, err: "InvalidTag"},
+		{name: "invalid characters", tags: []string{"home lab"}, err: "InvalidTag"},
+		{name: "leading hyphen", tags: []string{"-homelab"}, err: "InvalidTag"},
+		{name: "too long", tags: []string{strings.Repeat("a", MaxTagLength+1)}, err: "FieldTooLong"},
+		{name: "too many", tags: tooMany, err: "TooManyTags"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tags := tc.tags
+			errs := ValidateTags("tags", &tags, tc.allowed)
+			if tc.err != "" {
+				assertFieldError(t, errs, "tags", tc.err)
+				return
+			}
+			if len(errs) > 0 {
+				t.Fatalf("ValidateTags(%q) = %v, want no errors", tc.tags, errs)
+			}
+			if !reflect.DeepEqual(tags, tc.want) {
+				t.Errorf("ValidateTags(%q) normalized to %q, want %q", tc.tags, tags, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidatePreferencesRequest(t *testing.T) {
+	topics := []string{"homelab", "DevOps-Checklists"}
+
+	cases := []struct {
+		name    string
+		request models.PreferencesRequest
+		want    []string
+		err     string
+		field   string
+	}{
+		{name: "topics normalized", request: models.PreferencesRequest{Token: "t", Topics: []string{" HomeLab", "devops-checklists", "homelab"}}, want: []string{"homelab", "devops-checklists"}},
+		{name: "missing topics untouched", request: models.PreferencesRequest{Token: "t"}},
+		{name: "empty topics clear", request: models.PreferencesRequest{Token: "t", Topics: []string{}}, want: []string{}},
+		{name: "unknown topic", request: models.PreferencesRequest{Token: "t", Topics: []string{"crypto"}}, field: "topics", err: "InvalidTopic"},
+		{name: "missing token", request: models.PreferencesRequest{Topics: []string{"homelab"}}, field: "token", err: "RequiredField"},
+		{name: "pause too long", request: models.PreferencesRequest{Token: "t", PauseWeeks: MaxPauseWeeks + 1}, field: "pause_weeks", err: "InvalidPause"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := tc.request
+			errs := ValidatePreferencesRequest(&request, topics)
+			if tc.err != "" {
+				assertFieldError(t, errs, tc.field, tc.err)
+				return
+			}
+			if len(errs) > 0 {
+				t.Fatalf("ValidatePreferencesRequest() = %v, want no errors", errs)
+			}
+			if !reflect.DeepEqual(request.Topics, tc.want) {
+				t.Errorf("topics = %#v, want %#v", request.Topics, tc.want)
+			}
+		})
+	}
+}
+
+// assertFieldError fails unless errs holds exactly the error identified by key on field
+func assertFieldError(t *testing.T, errs []models.FieldError, field, key string) {
+	t.Helper()
+	want := fieldError(field, key)
+	if len(errs) != 1 || errs[0] != want {
+		t.Errorf("errors = %v, want [%v]", errs, want)
+	}
+}
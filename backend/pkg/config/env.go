@@ -1,13 +1,17 @@
 package config
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
+	"net"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/rs/zerolog/log"
@@ -25,8 +29,75 @@ type Config struct {
 		URL    string
 	}
 	Beehiiv struct {
+		APIKey                  string
+		PubID                   string
+		WebhookSecret           string
+		WebhookToleranceSeconds int
+	}
+	Mailchimp struct {
+		APIKey string
+		ListID string
+	}
+	ConvertKit struct {
+		APIKey    string
+		APISecret string
+		FormID    string
+	}
+	Buttondown struct {
 		APIKey string
-		PubID  string
+	}
+	Newsletter struct {
+		Provider               string
+		Secondaries            []string
+		SecondaryPolicy        string
+		AllowedTags            []string
+		Topics                 []string
+		TimeoutSeconds         int
+		BreakerThreshold       int
+		BreakerCooldownSeconds int
+	}
+	Security struct {
+		LinkSecret     string
+		TrustedProxies []string
+	}
+	Admin struct {
+		APIKeys  []string
+		User     string
+		Password string
+	}
+	Privacy struct {
+		PolicyVersion string
+	}
+	Store struct {
+		Dir string
+	}
+	Audit struct {
+		MaxSizeMB int
+		MaxFiles  int
+	}
+	Bulk struct {
+		ImportRatePerMinute int
+	}
+	Mirror struct {
+		Lookups        bool
+		ReconcileHours int
+	}
+	Notify struct {
+		URLs   []string
+		Secret string
+		Events []string
+	}
+	Drip struct {
+		File      string
+		Sequences map[string][]DripStep
+	}
+	Booking struct {
+		Timezone       string
+		Windows        []string
+		SlotMinutes    int
+		HoldMinutes    int
+		HorizonDays    int
+		MinNoticeHours int
 	}
 	Email struct {
 		Host   string
@@ -38,6 +109,14 @@ type Config struct {
 	}
 }
 
+// DripStep is one follow-up email of a drip sequence, sent Day days after the resource request.
+// Template is the path of its HTML body, relative to the sequences file.
+type DripStep struct {
+	Day      int    `json:"day"`
+	Subject  string `json:"subject"`
+	Template string `json:"template"`
+}
+
 var config *Config
 
 // GetConfig retrieves the global configuration
@@ -114,6 +193,88 @@ func populateConfig() (*Config, error) {
 	// Beehiiv Configuration
 	cfg.Beehiiv.APIKey = os.Getenv("BEEHIIV_API_KEY")
 	cfg.Beehiiv.PubID = os.Getenv("BEEHIIV_PUB_ID")
+	cfg.Beehiiv.WebhookSecret = os.Getenv("BEEHIIV_WEBHOOK_SECRET")
+	cfg.Beehiiv.WebhookToleranceSeconds = getIntEnv("BEEHIIV_WEBHOOK_TOLERANCE_SECONDS", 300)
+
+	// Alternative Newsletter Providers
+	cfg.Mailchimp.APIKey = os.Getenv("MAILCHIMP_API_KEY")
+	cfg.Mailchimp.ListID = os.Getenv("MAILCHIMP_LIST_ID")
+	cfg.ConvertKit.APIKey = os.Getenv("CONVERTKIT_API_KEY")
+	cfg.ConvertKit.APISecret = os.Getenv("CONVERTKIT_API_SECRET")
+	cfg.ConvertKit.FormID = os.Getenv("CONVERTKIT_FORM_ID")
+	cfg.Buttondown.APIKey = os.Getenv("BUTTONDOWN_API_KEY")
+
+	// Newsletter Configuration
+	cfg.Newsletter.Provider = strings.ToLower(getEnvWithFallback("NEWSLETTER_PROVIDER", "beehiiv"))
+	for _, name := range getListEnv("NEWSLETTER_SECONDARY_PROVIDERS") {
+		cfg.Newsletter.Secondaries = append(cfg.Newsletter.Secondaries, strings.ToLower(name))
+	}
+	cfg.Newsletter.SecondaryPolicy = strings.ToLower(getEnvWithFallback("NEWSLETTER_SECONDARY_POLICY", "retry"))
+	// Tags and topics are compared in lowercase, the form in which validation leaves them
+	for _, tag := range getListEnv("NEWSLETTER_ALLOWED_TAGS") {
+		cfg.Newsletter.AllowedTags = append(cfg.Newsletter.AllowedTags, strings.ToLower(tag))
+	}
+	for _, topic := range getListEnv("NEWSLETTER_TOPICS") {
+		cfg.Newsletter.Topics = append(cfg.Newsletter.Topics, strings.ToLower(topic))
+	}
+	if len(cfg.Newsletter.Topics) == 0 {
+		cfg.Newsletter.Topics = []string{"homelab", "devops-checklists"}
+	}
+	cfg.Newsletter.TimeoutSeconds = getIntEnv("NEWSLETTER_TIMEOUT_SECONDS", 10)
+	cfg.Newsletter.BreakerThreshold = getIntEnv("NEWSLETTER_BREAKER_THRESHOLD", 5)
+	cfg.Newsletter.BreakerCooldownSeconds = getIntEnv("NEWSLETTER_BREAKER_COOLDOWN_SECONDS", 30)
+
+	// Security Configuration
+	cfg.Security.LinkSecret = os.Getenv("LINK_SIGNING_SECRET")
+	cfg.Security.TrustedProxies = getListEnv("TRUSTED_PROXIES")
+
+	// Admin API Configuration
+	cfg.Admin.APIKeys = getListEnv("ADMIN_API_KEYS")
+	cfg.Admin.User = os.Getenv("ADMIN_USER")
+	cfg.Admin.Password = os.Getenv("ADMIN_PASSWORD")
+
+	// Privacy Configuration
+	cfg.Privacy.PolicyVersion = getEnvWithFallback("PRIVACY_POLICY_VERSION", "1")
+
+	// Local Storage Configuration
+	cfg.Store.Dir = getEnvWithFallback("DATA_DIR", "data")
+
+	// Audit Log Configuration
+	cfg.Audit.MaxSizeMB = getIntEnv("AUDIT_MAX_SIZE_MB", 10)
+	cfg.Audit.MaxFiles = getIntEnv("AUDIT_MAX_FILES", 5)
+
+	// Bulk Import Configuration
+	cfg.Bulk.ImportRatePerMinute = getIntEnv("BULK_IMPORT_RATE_PER_MINUTE", 60)
+
+	// Subscriber Mirror Configuration
+	cfg.Mirror.Lookups = getBoolEnv("SUBSCRIBER_MIRROR_LOOKUPS", false)
+	cfg.Mirror.ReconcileHours = getIntEnv("SUBSCRIBER_MIRROR_RECONCILE_HOURS", 6)
+
+	// Outbound Notification Configuration
+	cfg.Notify.URLs = getListEnv("NOTIFY_WEBHOOK_URLS")
+	cfg.Notify.Secret = os.Getenv("NOTIFY_WEBHOOK_SECRET")
+	cfg.Notify.Events = getListEnv("NOTIFY_WEBHOOK_EVENTS")
+
+	// Drip Sequence Configuration
+	cfg.Drip.File = os.Getenv("DRIP_SEQUENCES_FILE")
+	if cfg.Drip.File != "" {
+		sequences, err := loadDripSequences(cfg.Drip.File)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Drip.Sequences = sequences
+	}
+
+	// Booking Configuration
+	cfg.Booking.Timezone = getEnvWithFallback("BOOKING_TIMEZONE", "Europe/Madrid")
+	cfg.Booking.Windows = getListEnv("BOOKING_WINDOWS")
+	if len(cfg.Booking.Windows) == 0 {
+		cfg.Booking.Windows = []string{"mon-fri 09:00-14:00"}
+	}
+	cfg.Booking.SlotMinutes = getIntEnv("BOOKING_SLOT_MINUTES", 45)
+	cfg.Booking.HoldMinutes = getIntEnv("BOOKING_HOLD_MINUTES", 10)
+	cfg.Booking.HorizonDays = getIntEnv("BOOKING_HORIZON_DAYS", 30)
+	cfg.Booking.MinNoticeHours = getIntEnv("BOOKING_MIN_NOTICE_HOURS", 24)
 
 	// Email Configuration
 	cfg.Email.Host = getEnvWithFallback("EMAIL_HOST", "smtp.gmail.com")
@@ -169,6 +330,93 @@ func getBoolEnv(key string, defaultValue bool) bool {
 	return boolValue
 }
 
+// getIntEnv parses an integer environment variable
+func getIntEnv(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	intValue, err := strconv.Atoi(value)
+	if err != nil {
+		log.Warn().Str("key", key).Msg("Invalid integer value, using default")
+		return defaultValue
+	}
+	return intValue
+}
+
+// getListEnv parses a comma-separated environment variable, skipping empty items
+func getListEnv(key string) []string {
+	var values []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+// loadDripSequences reads the drip sequences file: a JSON object mapping each resource ID to its
+// steps. Template paths are resolved against the directory of the file.
+func loadDripSequences(path string) (map[string][]DripStep, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading DRIP_SEQUENCES_FILE: %w", err)
+	}
+
+	var sequences map[string][]DripStep
+	if err := json.Unmarshal(raw, &sequences); err != nil {
+		return nil, fmt.Errorf("parsing DRIP_SEQUENCES_FILE: %w", err)
+	}
+
+	for _, steps := range sequences {
+		for i := range steps {
+			if steps[i].Template != "" && !filepath.IsAbs(steps[i].Template) {
+				steps[i].Template = filepath.Join(filepath.Dir(path), steps[i].Template)
+			}
+		}
+	}
+	return sequences, nil
+}
+
+// validateDripSequences checks that every step of every sequence can be sent, in day order
+func validateDripSequences(sequences map[string][]DripStep) error {
+	for resourceID, steps := range sequences {
+		previous := 0
+		for i, step := range steps {
+			if step.Day <= 0 || step.Day < previous {
+				return fmt.Errorf("drip sequence %s: step %d must have a positive day, not before the previous step", resourceID, i+1)
+			}
+			previous = step.Day
+			if step.Subject == "" || step.Template == "" {
+				return fmt.Errorf("drip sequence %s: step %d needs a subject and a template", resourceID, i+1)
+			}
+			if _, err := template.ParseFiles(step.Template); err != nil {
+				return fmt.Errorf("drip sequence %s: step %d: %w", resourceID, i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateProvider checks that a newsletter provider exists and has the settings it needs
+func validateProvider(cfg *Config, name string) error {
+	switch name {
+	case "beehiiv", "buttondown", "local":
+	case "mailchimp":
+		// The data center of the API host is the suffix of the key ("...-us6")
+		if !strings.Contains(cfg.Mailchimp.APIKey, "-") || cfg.Mailchimp.ListID == "" {
+			return errors.New("MAILCHIMP_API_KEY (with its data center suffix) and MAILCHIMP_LIST_ID are required by the mailchimp provider")
+		}
+	case "convertkit":
+		if cfg.ConvertKit.APIKey == "" || cfg.ConvertKit.APISecret == "" || cfg.ConvertKit.FormID == "" {
+			return errors.New("CONVERTKIT_API_KEY, CONVERTKIT_API_SECRET and CONVERTKIT_FORM_ID are required by the convertkit provider")
+		}
+	default:
+		return fmt.Errorf("invalid newsletter provider: %s. Must be beehiiv, mailchimp, convertkit, buttondown or local", name)
+	}
+	return nil
+}
+
 // validateConfig checks the configuration for completeness and correctness
 func validateConfig(cfg *Config) error {
 	// Validate environment
@@ -190,6 +438,103 @@ func validateConfig(cfg *Config) error {
 		return fmt.Errorf("invalid site URL: %s. Must start with http:// or https://", cfg.Site.URL)
 	}
 
+	// Validate booking configuration
+	if _, err := time.LoadLocation(cfg.Booking.Timezone); err != nil {
+		return fmt.Errorf("invalid booking timezone: %s", cfg.Booking.Timezone)
+	}
+
+	if cfg.Booking.SlotMinutes <= 0 || cfg.Booking.HoldMinutes <= 0 || cfg.Booking.HorizonDays <= 0 {
+		return errors.New("booking slot, hold and horizon durations must be positive")
+	}
+
+	// Validate audit log rotation
+	if cfg.Audit.MaxSizeMB <= 0 || cfg.Audit.MaxFiles < 0 {
+		return errors.New("AUDIT_MAX_SIZE_MB must be positive and AUDIT_MAX_FILES cannot be negative")
+	}
+
+	// Validate bulk import rate
+	if cfg.Bulk.ImportRatePerMinute <= 0 {
+		return errors.New("BULK_IMPORT_RATE_PER_MINUTE must be positive")
+	}
+
+	// Validate mirror reconciliation interval (0 disables the periodic reconciliation)
+	if cfg.Mirror.ReconcileHours < 0 {
+		return errors.New("SUBSCRIBER_MIRROR_RECONCILE_HOURS cannot be negative")
+	}
+
+	// Validate outbound notifications (disabled when no URL is set)
+	for _, url := range cfg.Notify.URLs {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			return fmt.Errorf("invalid NOTIFY_WEBHOOK_URLS entry: %s. Must start with http:// or https://", url)
+		}
+	}
+	if len(cfg.Notify.URLs) > 0 && len(cfg.Notify.Secret) < 32 {
+		return errors.New("NOTIFY_WEBHOOK_SECRET must be at least 32 characters long when NOTIFY_WEBHOOK_URLS is set")
+	}
+
+	// Validate drip sequences (none are sent when DRIP_SEQUENCES_FILE is empty)
+	if err := validateDripSequences(cfg.Drip.Sequences); err != nil {
+		return err
+	}
+
+	// Validate trusted proxies (X-Forwarded-For is ignored when none are set)
+	for _, proxy := range cfg.Security.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				return fmt.Errorf("invalid TRUSTED_PROXIES entry: %s. Must be an IP address or a CIDR range", proxy)
+			}
+		}
+	}
+
+	// Validate link signing secret (signed links are disabled when it is empty)
+	if cfg.Security.LinkSecret != "" && len(cfg.Security.LinkSecret) < 32 {
+		return errors.New("LINK_SIGNING_SECRET must be at least 32 characters long")
+	}
+
+	// Validate newsletter providers and the settings they need
+	if err := validateProvider(cfg, cfg.Newsletter.Provider); err != nil {
+		return err
+	}
+	seen := map[string]bool{cfg.Newsletter.Provider: true}
+	for _, name := range cfg.Newsletter.Secondaries {
+		if seen[name] {
+			return fmt.Errorf("NEWSLETTER_SECONDARY_PROVIDERS repeats the provider %s", name)
+		}
+		seen[name] = true
+		if err := validateProvider(cfg, name); err != nil {
+			return err
+		}
+	}
+	switch cfg.Newsletter.SecondaryPolicy {
+	case "retry", "fail", "ignore":
+	default:
+		return fmt.Errorf("invalid NEWSLETTER_SECONDARY_POLICY: %s. Must be retry, fail or ignore", cfg.Newsletter.SecondaryPolicy)
+	}
+	if cfg.Newsletter.TimeoutSeconds <= 0 || cfg.Newsletter.BreakerThreshold <= 0 || cfg.Newsletter.BreakerCooldownSeconds <= 0 {
+		return errors.New("NEWSLETTER_TIMEOUT_SECONDS, NEWSLETTER_BREAKER_THRESHOLD and NEWSLETTER_BREAKER_COOLDOWN_SECONDS must be positive")
+	}
+
+	// Validate Beehiiv webhook secret (inbound webhooks are rejected when it is empty)
+	if cfg.Beehiiv.WebhookSecret != "" && len(cfg.Beehiiv.WebhookSecret) < 32 {
+		return errors.New("BEEHIIV_WEBHOOK_SECRET must be at least 32 characters long")
+	}
+	if cfg.Beehiiv.WebhookToleranceSeconds <= 0 {
+		return errors.New("BEEHIIV_WEBHOOK_TOLERANCE_SECONDS must be positive")
+	}
+
+	// Validate admin credentials (the admin API rejects every request when none are set)
+	for _, key := range cfg.Admin.APIKeys {
+		if len(key) < 32 {
+			return errors.New("every ADMIN_API_KEYS entry must be at least 32 characters long")
+		}
+	}
+	if (cfg.Admin.User == "") != (cfg.Admin.Password == "") {
+		return errors.New("ADMIN_USER and ADMIN_PASSWORD must be set together")
+	}
+	if cfg.Admin.Password != "" && len(cfg.Admin.Password) < 16 {
+		return errors.New("ADMIN_PASSWORD must be at least 16 characters long")
+	}
+
 	// Validate email configuration in production
 	if cfg.Env == "production" {
 		if cfg.Email.Host == "" || cfg.Email.Port == "" || cfg.Email.User == "" || cfg.Email.Pass == "" {
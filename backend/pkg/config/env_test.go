@@ -0,0 +1,22 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPopulateConfigLowercasesTopicsAndTags(t *testing.T) {
+	t.Setenv("NEWSLETTER_TOPICS", " HomeLab, DevOps-Checklists ,")
+	t.Setenv("NEWSLETTER_ALLOWED_TAGS", "Homelab,AI")
+
+	cfg, err := populateConfig()
+	if err != nil {
+		t.Fatalf("populateConfig() failed: %v", err)
+	}
+	if want := []string{"homelab", "devops-checklists"}; !reflect.DeepEqual(cfg.Newsletter.Topics, want) {
+		t.Errorf("topics = %q, want %q", cfg.Newsletter.Topics, want)
+	}
+	if want := []string{"homelab", "ai"}; !reflect.DeepEqual(cfg.Newsletter.AllowedTags, want) {
+		t.Errorf("allowed tags = %q, want %q", cfg.Newsletter.AllowedTags, want)
+	}
+}
@@ -3,6 +3,7 @@ package logger
 import (
 	"os"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -37,6 +38,54 @@ func NewLogger() *zerolog.Logger {
 	return &logger
 }
 
+// recentErrorsCapacity es el número de errores recientes que se conservan en memoria
+const recentErrorsCapacity = 100
+
+// ErrorEntry representa un error registrado con LogFunction
+type ErrorEntry struct {
+	Time     time.Time   `json:"time"`
+	Function string      `json:"function"`
+	Message  string      `json:"message"`
+	Data     interface{} `json:"data,omitempty"`
+}
+
+var (
+	recentErrorsMu sync.Mutex
+	recentErrors   []ErrorEntry
+	recentNext     int
+)
+
+// rememberError guarda un error en el búfer circular de errores recientes
+func rememberError(entry ErrorEntry) {
+	recentErrorsMu.Lock()
+	defer recentErrorsMu.Unlock()
+
+	if len(recentErrors) < recentErrorsCapacity {
+		recentErrors = append(recentErrors, entry)
+		return
+	}
+	recentErrors[recentNext] = entry
+	recentNext = (recentNext + 1) % recentErrorsCapacity
+}
+
+// RecentErrors devuelve los últimos errores registrados, del más reciente al más antiguo
+func RecentErrors(limit int) []ErrorEntry {
+	recentErrorsMu.Lock()
+	defer recentErrorsMu.Unlock()
+
+	if limit <= 0 || limit > len(recentErrors) {
+		limit = len(recentErrors)
+	}
+
+	result := make([]ErrorEntry, 0, limit)
+	for i := 0; i < limit; i++ {
+		// The newest entry sits just before the next write position
+		index := (recentNext - 1 - i + 2*len(recentErrors)) % len(recentErrors)
+		result = append(result, recentErrors[index])
+	}
+	return result
+}
+
 // LogFunction registra un mensaje con información de la función que lo llama
 func LogFunction(level string, message string, data interface{}) {
 	// Obtener información de la función que llama
@@ -59,6 +108,7 @@ func LogFunction(level string, message string, data interface{}) {
 		event.Warn().Msg(message)
 	case "error":
 		event.Error().Msg(message)
+		rememberError(ErrorEntry{Time: time.Now().UTC(), Function: funcName, Message: message, Data: data})
 	default:
 		event.Info().Msg(message)
 	}
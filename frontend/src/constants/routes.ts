@@ -2,12 +2,15 @@ export const ROUTES = {
   HOME: '/',
   ABOUT: '/about',
   CONTACT: '/contact',
+  MY_DATA: '/my-data',
+  PREFERENCES: '/preferences',
   PRIVACY: '/legal/privacy',
   UNSUBSCRIBE: '/unsubscribe',
   PROJECTS: '/projects',
   RESOURCES: '/resources',
   SUCCESS: {
     BOOKING: '/success/booking',
+    CONTACT: '/success/contact',
     RESOURCE: '/success/resource',
     SUBSCRIPTION: '/success/subscription',
     UNSUBSCRIBE: '/success/unsubscribe',